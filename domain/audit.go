@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditEventType string
+
+const (
+	AuditLogin              AuditEventType = "login"
+	AuditLoginFailed        AuditEventType = "login_failed"
+	AuditRefreshTokenReused AuditEventType = "refresh_token_reused"
+	AuditPasswordChanged    AuditEventType = "password_changed"
+	AuditPasswordReset      AuditEventType = "password_reset"
+	AuditEmailChanged       AuditEventType = "email_changed"
+	AuditMFAEnabled         AuditEventType = "mfa_enabled"
+	AuditMFADisabled        AuditEventType = "mfa_disabled"
+	AuditPasskeyAdded       AuditEventType = "passkey_added"
+	AuditPasskeyRemoved     AuditEventType = "passkey_removed"
+	AuditProviderLinked     AuditEventType = "provider_linked"
+	AuditProviderUnlinked   AuditEventType = "provider_unlinked"
+	AuditAccountDeleted     AuditEventType = "account_deleted"
+	AuditAccountRestored    AuditEventType = "account_restored"
+	AuditDataExported       AuditEventType = "data_exported"
+)
+
+// AuditEvent is a security relevant change to an account, kept so users can see what
+// happened to it. Detail names what was changed, like a provider or passkey.
+type AuditEvent struct {
+	ID        int
+	UserID    uuid.UUID
+	Type      AuditEventType
+	Detail    string
+	SessionID string
+	IPAddress string
+	UserAgent string
+	CreatedAt time.Time
+}
@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CommentStatus decides who sees a comment. Held and hidden comments are only shown
+// to their author and moderators.
+type CommentStatus string
+
+const (
+	CommentVisible CommentStatus = "visible"
+	CommentHeld    CommentStatus = "held"
+	CommentHidden  CommentStatus = "hidden"
+)
+
+var CommentStatuses = []interface{}{CommentVisible, CommentHeld, CommentHidden}
+
+type Comment struct {
+	ID         int
+	SightingID int
+	ParentID   *int
+
+	// AuthorID is nil once the author's account is purged.
+	AuthorID       *uuid.UUID
+	AuthorUsername string
+
+	Body     string
+	Status   CommentStatus
+	Mentions []string
+
+	CreatedAt time.Time
+	EditedAt  *time.Time
+	DeletedAt *time.Time
+}
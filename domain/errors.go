@@ -3,11 +3,60 @@ package domain
 import "errors"
 
 var (
-	ErrUserAccountActive   = errors.New("user's account is already active")
 	ErrUserAccountNotFound = errors.New("user's account was not found")
+	ErrAccountDeleted      = errors.New("account is scheduled for deletion, use the link we emailed you to restore it")
+	ErrExportNotFound      = errors.New("data export was not found or has expired")
 	ErrUsernameExists      = errors.New("username already exists")
+	ErrEmailTaken          = errors.New("email is already in use")
 	ErrInvalidCredentials  = errors.New("invalid credentials")
 	ErrSamePassword        = errors.New("new password cannot match your old password")
+	ErrPasswordTooWeak     = errors.New("password is too easy to guess")
+	ErrPasswordBreached    = errors.New("password has appeared in a data breach, choose another one")
+	ErrFollowSelf          = errors.New("you cannot follow yourself")
+
+	ErrSightingNotFound     = errors.New("sighting was not found")
+	ErrSightingForbidden    = errors.New("only the reporter or a moderator can do this")
+	ErrConfirmOwnSighting   = errors.New("you cannot confirm your own sighting")
+	ErrConfirmationNotFound = errors.New("you have not confirmed this sighting")
+
+	ErrCommentNotFound  = errors.New("comment was not found")
+	ErrCommentForbidden = errors.New("only the author can change this comment")
+	ErrInvalidParent    = errors.New("replies must be to a comment on the same sighting")
+	ErrModeratorOnly    = errors.New("only moderators can do this")
+
+	ErrOrganizationNotFound  = errors.New("organization was not found")
+	ErrOrganizationForbidden = errors.New("your role in this organization does not allow this")
+	ErrMemberNotFound        = errors.New("member was not found")
+	ErrAlreadyMember         = errors.New("user is already a member of this organization")
+	ErrLastOwner             = errors.New("an organization needs at least one owner")
+	ErrInviteNotFound        = errors.New("invite was not found or has expired")
+	ErrInviteEmailMismatch   = errors.New("this invite was sent to a different email address")
+
+	ErrAlertAreaNotFound    = errors.New("alert area was not found")
+	ErrTooManyAlertAreas    = errors.New("you have saved the maximum number of alert areas")
+	ErrInvalidAlertArea     = errors.New("alert area must be a valid polygon or a point with a radius")
+	ErrNotificationNotFound = errors.New("notification was not found")
+	ErrPushUnavailable      = errors.New("push notifications are not available")
 
 	ErrIncorrectCode = errors.New("incorrect verification code")
+
+	ErrMFAAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled      = errors.New("two-factor authentication is not enabled")
+	ErrMFAEnrollmentEnded = errors.New("two-factor enrollment expired, start again")
+	ErrTooManyAttempts    = errors.New("too many attempts")
+
+	ErrPasskeyNotFound     = errors.New("passkey was not found")
+	ErrPasskeyVerification = errors.New("passkey could not be verified")
+
+	ErrOAuthAccountExists    = errors.New("an account with this email already exists, log in and link this provider from your settings")
+	ErrOAuthIdentityTaken    = errors.New("this provider account is linked to another user")
+	ErrOAuthProviderLinked   = errors.New("a different account from this provider is already linked")
+	ErrOAuthIdentityNotFound = errors.New("provider is not linked")
+	ErrLastLoginMethod       = errors.New("cannot unlink your only way to log in")
+
+	ErrInvalidAuthorizationCode = errors.New("invalid or expired authorization code")
+
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	ErrSessionNotFound    = errors.New("session was not found")
 )
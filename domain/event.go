@@ -0,0 +1,41 @@
+package domain
+
+import "github.com/google/uuid"
+
+type SightingEventType string
+
+const (
+	SightingCreated SightingEventType = "created"
+	SightingUpdated SightingEventType = "updated"
+	SightingDeleted SightingEventType = "deleted"
+)
+
+// SightingEvent tells stream subscribers about a change to a sighting. Deleted events
+// only carry the sighting's ID.
+type SightingEvent struct {
+	Type     SightingEventType
+	Sighting Sighting
+}
+
+// SightingAudience is who a sighting is limited to besides its reporter and
+// moderators. Streams resolve it once per event and check every subscriber against it.
+type SightingAudience struct {
+	// Followers of the reporter, only loaded for sightings limited to them.
+	Followers map[uuid.UUID]bool
+
+	// Members of the organization the sighting is shared with.
+	Members map[uuid.UUID]bool
+}
+
+// SightingFilter is the part of the map a client is looking at.
+type SightingFilter struct {
+	MinLng        float64
+	MinLat        float64
+	MaxLng        float64
+	MaxLat        float64
+	MinConfidence float64
+}
+
+func (f SightingFilter) Contains(lat float64, lng float64) bool {
+	return lat >= f.MinLat && lat <= f.MaxLat && lng >= f.MinLng && lng <= f.MaxLng
+}
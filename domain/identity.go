@@ -0,0 +1,17 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuthIdentity is an account at an external provider that can be used to log in as a user.
+type OAuthIdentity struct {
+	ID             int
+	UserID         uuid.UUID
+	Provider       string
+	ProviderUserID string
+	Email          string
+	CreatedAt      time.Time
+}
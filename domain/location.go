@@ -0,0 +1,14 @@
+package domain
+
+// LocationPrecision is how precisely a sighting's location is shown to people other
+// than its reporter, moderators and partners.
+type LocationPrecision string
+
+const (
+	PrecisionExact  LocationPrecision = "exact"
+	Precision100m   LocationPrecision = "100m"
+	Precision1km    LocationPrecision = "1km"
+	PrecisionHidden LocationPrecision = "hidden"
+)
+
+var LocationPrecisions = []interface{}{PrecisionExact, Precision100m, Precision1km, PrecisionHidden}
@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AlertArea is a part of the map a user wants to hear about new sightings in. It is
+// either a polygon or a circle around a point.
+type AlertArea struct {
+	ID     int
+	UserID uuid.UUID
+	Name   string
+
+	// Polygon is a closed ring of [longitude, latitude] pairs, as in GeoJSON. It is
+	// empty for circles.
+	Polygon [][2]float64
+
+	Latitude     float64
+	Longitude    float64
+	RadiusMeters float64
+
+	CreatedAt time.Time
+}
+
+type NotificationChannel string
+
+const (
+	ChannelEmail NotificationChannel = "email"
+	ChannelInApp NotificationChannel = "in_app"
+	ChannelPush  NotificationChannel = "push"
+)
+
+type NotificationStatus string
+
+const (
+	NotificationPending NotificationStatus = "pending"
+	NotificationSent    NotificationStatus = "sent"
+	NotificationFailed  NotificationStatus = "failed"
+)
+
+// NotificationPreferences decide how a user hears about sightings in their areas.
+// Throttling and quiet hours only hold back email and push, in-app notifications
+// are never disruptive.
+type NotificationPreferences struct {
+	Email bool
+	InApp bool
+	Push  bool
+
+	// MaxPerHour caps the email and push alerts a user gets in an hour, the rest only
+	// show up in the app.
+	MaxPerHour int
+
+	// QuietStart and QuietEnd are "15:04" times in TimeZone, both empty for none.
+	// Alerts during quiet hours go out when they end.
+	QuietStart string
+	QuietEnd   string
+	TimeZone   string
+}
+
+var DefaultNotificationPreferences = NotificationPreferences{
+	Email:      true,
+	InApp:      true,
+	MaxPerHour: 5,
+	TimeZone:   "UTC",
+}
+
+// AreaMatch is a user with an area a new sighting falls in.
+type AreaMatch struct {
+	UserID      uuid.UUID
+	AreaID      int
+	Preferences NotificationPreferences
+
+	// RecentAlerts is how many email and push alerts the user got in the last hour.
+	RecentAlerts int
+}
+
+// Notification tells a user about a sighting in one of their areas, over one channel.
+type Notification struct {
+	ID         int
+	UserID     uuid.UUID
+	SightingID int
+	AreaID     *int
+	AreaName   string
+	Animal     string
+	Channel    NotificationChannel
+	Status     NotificationStatus
+	Attempts   int
+	DeliverAt  time.Time
+	ReadAt     *time.Time
+	CreatedAt  time.Time
+
+	// Recipient is the user's email address, set for notifications being delivered.
+	Recipient string
+}
@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	OrgRoleOwner       = "owner"
+	OrgRoleCoordinator = "coordinator"
+	OrgRoleVolunteer   = "volunteer"
+)
+
+var OrgRoles = []interface{}{OrgRoleOwner, OrgRoleCoordinator, OrgRoleVolunteer}
+
+// Organization is a rescue group. Its members see each other's organization
+// sightings at their exact location.
+type Organization struct {
+	ID        int
+	Name      string
+	CreatedAt time.Time
+
+	// Role is the caller's role when the organization is listed for them.
+	Role string
+}
+
+type OrganizationMember struct {
+	OrganizationID int
+	UserID         uuid.UUID
+	Username       string
+	Role           string
+	CreatedAt      time.Time
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a single login on a device, shared by every refresh token rotated from it.
+type Session struct {
+	ID         string
+	UserID     uuid.UUID
+	DeviceName string
+	IPAddress  string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	UserID    uuid.UUID
+	Email     string
+	Role      string
+	SessionID string
+}
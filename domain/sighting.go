@@ -1,6 +1,22 @@
 package domain
 
-import "time"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Visibility decides who can see a sighting at all, LocationPrecision how precisely.
+type Visibility string
+
+const (
+	VisibilityPublic       Visibility = "public"
+	VisibilityFollowers    Visibility = "followers"
+	VisibilityOrganization Visibility = "organization"
+	VisibilityPrivate      Visibility = "private"
+)
+
+var Visibilities = []interface{}{VisibilityPublic, VisibilityFollowers, VisibilityOrganization, VisibilityPrivate}
 
 type Sighting struct {
 	ID          int
@@ -8,10 +24,36 @@ type Sighting struct {
 	Description string
 	PhotoURL    string
 	Reporter    string
+	Visibility  Visibility
+
+	// OrganizationID shares the sighting with an organization the reporter belongs to.
+	OrganizationID *int
+
+	// Precision overrides the reporter's default when set. Sightings read back
+	// carry the one in effect.
+	Precision LocationPrecision
 
 	Latitude  float64
 	Longitude float64
 	Timestamp time.Time
+
+	// CommentCount counts the comments everyone can see.
+	CommentCount int
+
+	// Confidence is how likely the sighting is real, from 0 to 1.
+	Confidence        float64
+	ConfirmationCount int
+}
+
+// Confirmation is another user vouching for a sighting, optionally with their own
+// photo or the place they saw the animal.
+type Confirmation struct {
+	SightingID int
+	UserID     uuid.UUID
+	PhotoURL   string
+	Latitude   *float64
+	Longitude  *float64
+	CreatedAt  time.Time
 }
 
 // TODO: define possible interfaces for service/repo here
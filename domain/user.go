@@ -6,14 +6,52 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RolePartner   = "partner"
+)
+
 type User struct {
 	ID        uuid.UUID
-	OAuthID   string
 	Username  string
 	Email     string
 	Password  string
+	Role      string
 	CreatedAt time.Time
 	IsActive  bool
+
+	// DeletedAt is set while the account waits out its deletion grace period.
+	DeletedAt *time.Time
+
+	DisplayName string
+	Bio         string
+	AvatarURL   string
+	HomeArea    string
+
+	// LocationPrecision applies to the user's sightings that don't set their own.
+	LocationPrecision LocationPrecision
+
+	TOTPSecret  string
+	TOTPEnabled bool
+}
+
+// ProfileUpdate holds the profile fields a user asked to change, nil fields are left as they are.
+type ProfileUpdate struct {
+	Username    *string
+	DisplayName *string
+	Bio         *string
+	AvatarURL   *string
+	HomeArea    *string
+
+	LocationPrecision *LocationPrecision
+}
+
+// Follow is the other side of a follow, the followee or the follower depending on
+// which list it comes from.
+type Follow struct {
+	Username  string
+	CreatedAt time.Time
 }
 
 // TODO: define possible interfaces for service/repo here
@@ -0,0 +1,17 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// WebAuthnCredential is a passkey registered to a user.
+type WebAuthnCredential struct {
+	UserID     uuid.UUID
+	Name       string
+	Credential webauthn.Credential
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
@@ -0,0 +1,139 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/papacatzzi-server/domain"
+	"github.com/papacatzzi-server/password"
+)
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+func (req changePasswordRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.NewPassword, validation.Required, validation.Length(password.MinLength, password.MaxLength)),
+	)
+}
+
+func (s *Server) changePassword(w http.ResponseWriter, r *http.Request) {
+	var req changePasswordRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	err := s.authService.ChangePassword(identityFromContext(r.Context()), req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrInvalidCredentials):
+			s.errorResponse(w, http.StatusUnauthorized, "Current password is incorrect")
+		case errors.Is(err, domain.ErrSamePassword):
+			s.errorResponse(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrPasswordTooWeak), errors.Is(err, domain.ErrPasswordBreached):
+			s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "failed to change password")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+type beginEmailChangeRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (req beginEmailChangeRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Email, validation.Required, is.Email),
+	)
+}
+
+func (s *Server) beginEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req beginEmailChangeRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	err := s.authService.BeginEmailChange(identityFromContext(r.Context()), req.Password, req.Email)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrInvalidCredentials):
+			s.errorResponse(w, http.StatusUnauthorized, "Password is incorrect")
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "failed to change email")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+type confirmEmailChangeRequest struct {
+	Code string `json:"code"`
+}
+
+func (req confirmEmailChangeRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Code, validation.Required),
+	)
+}
+
+func (s *Server) confirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req confirmEmailChangeRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	err := s.authService.ConfirmEmailChange(identityFromContext(r.Context()), req.Code)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrIncorrectCode):
+			s.errorResponse(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrTooManyAttempts):
+			s.errorResponse(w, http.StatusTooManyRequests, "Too many incorrect codes, please request a new one")
+		case errors.Is(err, domain.ErrEmailTaken):
+			s.errorResponse(w, http.StatusConflict, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "failed to change email")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -4,18 +4,17 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
-	"github.com/markbates/goth/gothic"
 	"github.com/papacatzzi-server/domain"
-	"github.com/papacatzzi-server/service"
+	"github.com/papacatzzi-server/password"
 )
 
 type loginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Device   string `json:"device"`
 }
 
 func (req loginRequest) Validate() (err error) {
@@ -25,9 +24,12 @@ func (req loginRequest) Validate() (err error) {
 	)
 }
 
+// loginResponse carries either the token pair or, for users with two-factor
+// authentication, the mfa token to complete the login with.
 type loginResponse struct {
-	AccessToken  string `json:"access"`
-	RefreshToken string `json:"refresh"`
+	AccessToken  string `json:"access,omitempty"`
+	RefreshToken string `json:"refresh,omitempty"`
+	MFAToken     string `json:"mfa,omitempty"`
 }
 
 func (s *Server) login(w http.ResponseWriter, r *http.Request) {
@@ -44,21 +46,28 @@ func (s *Server) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, refreshToken, err := s.authService.Login(req.Email, req.Password)
+	accessToken, refreshToken, mfaToken, err := s.authService.Login(req.Email, req.Password, clientSession(r, req.Device))
 	if err != nil {
 		s.logger.Error().Msg(err.Error())
 		switch {
 		case errors.Is(err, domain.ErrInvalidCredentials):
 			s.errorResponse(w, http.StatusUnauthorized, "Invalid username or password")
+		case errors.Is(err, domain.ErrAccountDeleted):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
 		default:
 			s.errorResponse(w, http.StatusInternalServerError, "Failed to process log in")
 		}
 		return
 	}
 
+	if accessToken != "" {
+		s.setAuthCookies(w, accessToken, refreshToken)
+	}
+
 	res := loginResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
+		MFAToken:     mfaToken,
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -92,7 +101,12 @@ func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
 	err := s.authService.Logout(req.RefreshToken)
 	if err != nil {
 		s.logger.Error().Msg(err.Error())
-		s.errorResponse(w, http.StatusInternalServerError, "Failed to process log out")
+		switch {
+		case errors.Is(err, domain.ErrInvalidToken):
+			s.errorResponse(w, http.StatusUnauthorized, "Invalid refresh token")
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Failed to process log out")
+		}
 		return
 	}
 
@@ -126,12 +140,7 @@ func (s *Server) beginSignUp(w http.ResponseWriter, r *http.Request) {
 	err := s.authService.BeginSignUp(req.Email)
 	if err != nil {
 		s.logger.Error().Msg(err.Error())
-		switch {
-		case errors.Is(err, domain.ErrUserAccountActive):
-			s.errorResponse(w, http.StatusBadRequest, err.Error())
-		default:
-			s.errorResponse(w, http.StatusInternalServerError, "failed to begin sign up")
-		}
+		s.errorResponse(w, http.StatusInternalServerError, "failed to begin sign up")
 		return
 	}
 
@@ -171,6 +180,8 @@ func (s *Server) verifySignUp(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.Is(err, domain.ErrIncorrectCode):
 			s.errorResponse(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrTooManyAttempts):
+			s.errorResponse(w, http.StatusTooManyRequests, "Too many incorrect codes, please request a new one")
 		default:
 			s.errorResponse(w, http.StatusInternalServerError, "failed to verify sign up")
 		}
@@ -191,7 +202,7 @@ func (req finishSignUpRequest) Validate() (err error) {
 	return validation.ValidateStruct(&req,
 		validation.Field(&req.Username, validation.Required),
 		validation.Field(&req.Email, validation.Required, is.Email),
-		validation.Field(&req.Password, validation.Required, validation.Length(10, 20)),
+		validation.Field(&req.Password, validation.Required, validation.Length(password.MinLength, password.MaxLength)),
 	)
 }
 
@@ -213,8 +224,10 @@ func (s *Server) finishSignUp(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		s.logger.Error().Msg(err.Error())
 		switch {
-		case errors.Is(err, domain.ErrUsernameExists):
+		case errors.Is(err, domain.ErrUsernameExists), errors.Is(err, domain.ErrEmailTaken):
 			s.errorResponse(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrPasswordTooWeak), errors.Is(err, domain.ErrPasswordBreached):
+			s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
 		default:
 			s.errorResponse(w, http.StatusInternalServerError, "failed to finish sign up")
 		}
@@ -253,12 +266,7 @@ func (s *Server) forgotPassword(w http.ResponseWriter, r *http.Request) {
 	err := s.authService.ForgotPassword(req.Email)
 	if err != nil {
 		s.logger.Error().Msg(err.Error())
-		switch {
-		case errors.Is(err, domain.ErrUserAccountNotFound):
-			s.errorResponse(w, http.StatusBadRequest, err.Error())
-		default:
-			s.errorResponse(w, http.StatusInternalServerError, "failed to begin password reset")
-		}
+		s.errorResponse(w, http.StatusInternalServerError, "failed to begin password reset")
 		return
 	}
 
@@ -273,7 +281,7 @@ type resetPasswordRequest struct {
 func (req resetPasswordRequest) Validate() (err error) {
 	return validation.ValidateStruct(&req,
 		validation.Field(&req.Token, validation.Required),
-		validation.Field(&req.NewPassword, validation.Required, validation.Length(10, 20)),
+		validation.Field(&req.NewPassword, validation.Required, validation.Length(password.MinLength, password.MaxLength)),
 	)
 }
 
@@ -297,6 +305,10 @@ func (s *Server) resetPassword(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.Is(err, domain.ErrSamePassword):
 			s.errorResponse(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrPasswordTooWeak), errors.Is(err, domain.ErrPasswordBreached):
+			s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		case errors.Is(err, domain.ErrInvalidToken):
+			s.errorResponse(w, http.StatusBadRequest, "Invalid or expired password reset link")
 		default:
 			s.errorResponse(w, http.StatusInternalServerError, "failed to change password")
 		}
@@ -308,6 +320,7 @@ func (s *Server) resetPassword(w http.ResponseWriter, r *http.Request) {
 
 type refreshTokenRequest struct {
 	RefreshToken string `json:"refresh"`
+	Device       string `json:"device"`
 }
 
 func (req refreshTokenRequest) Validate() (err error) {
@@ -317,7 +330,8 @@ func (req refreshTokenRequest) Validate() (err error) {
 }
 
 type refreshTokenResponse struct {
-	AccessToken string `json:"access"`
+	AccessToken  string `json:"access"`
+	RefreshToken string `json:"refresh"`
 }
 
 func (s *Server) refreshToken(w http.ResponseWriter, r *http.Request) {
@@ -334,57 +348,30 @@ func (s *Server) refreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, err := s.authService.RefreshToken(req.RefreshToken)
+	accessToken, refreshToken, err := s.authService.RefreshToken(req.RefreshToken, clientSession(r, req.Device))
 	if err != nil {
 		s.logger.Error().Msg(err.Error())
-		s.errorResponse(w, http.StatusInternalServerError, "Error refreshing token")
+		switch {
+		case errors.Is(err, domain.ErrInvalidToken), errors.Is(err, domain.ErrRefreshTokenReused):
+			s.errorResponse(w, http.StatusUnauthorized, "Invalid refresh token")
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error refreshing token")
+		}
 		return
 	}
 
 	res := refreshTokenResponse{
-		AccessToken: accessToken,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(res)
 }
 
-func (s *Server) beginOAuth(w http.ResponseWriter, r *http.Request) {
-	gothic.BeginAuthHandler(w, r)
-}
-
-func (s *Server) completeOAuth(w http.ResponseWriter, r *http.Request) {
-	user, err := gothic.CompleteUserAuth(w, r)
-	if err != nil {
-		s.logger.Error().Msg(err.Error())
-		s.errorResponse(w, http.StatusInternalServerError, "Error authenticating user")
-		return
-	}
-
-	accessToken, refreshToken, err := s.authService.CompleteOAuth(user.UserID, user.Email)
-	if err != nil {
-		s.logger.Error().Msg(err.Error())
-		s.errorResponse(w, http.StatusInternalServerError, "Error generating tokens")
-		return
-	}
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "accessToken",
-		Value:    accessToken,
-		HttpOnly: true,
-		Secure:   false, // Set to true in production (HTTPS only)
-		Path:     "/",
-		Expires:  time.Now().Add(service.AccessTokenExpiration),
-	})
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refreshToken",
-		Value:    refreshToken,
-		HttpOnly: true,
-		Secure:   false, // Set to true in production (HTTPS only)
-		Path:     "/",
-		Expires:  time.Now().Add(service.RefreshTokenExpiration),
-	})
-
-	http.Redirect(w, r, "http://localhost:5173/", http.StatusTemporaryRedirect)
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s.authService.JWKS())
 }
@@ -0,0 +1,266 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gorilla/mux"
+	"github.com/papacatzzi-server/domain"
+)
+
+const maxCommentLength = 2000
+
+type commentResponse struct {
+	ID         int                `json:"id"`
+	SightingID int                `json:"sightingId"`
+	ParentID   *int               `json:"parentId"`
+	Author     string             `json:"author"`
+	Body       string             `json:"body"`
+	Status     string             `json:"status"`
+	Mentions   []string           `json:"mentions"`
+	Deleted    bool               `json:"deleted"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	EditedAt   *time.Time         `json:"editedAt"`
+	Replies    []*commentResponse `json:"replies"`
+}
+
+func newCommentResponse(c domain.Comment) *commentResponse {
+	mentions := c.Mentions
+	if mentions == nil {
+		mentions = make([]string, 0)
+	}
+
+	return &commentResponse{
+		ID:         c.ID,
+		SightingID: c.SightingID,
+		ParentID:   c.ParentID,
+		Author:     c.AuthorUsername,
+		Body:       c.Body,
+		Status:     string(c.Status),
+		Mentions:   mentions,
+		Deleted:    c.DeletedAt != nil,
+		CreatedAt:  c.CreatedAt,
+		EditedAt:   c.EditedAt,
+		Replies:    make([]*commentResponse, 0),
+	}
+}
+
+// commentThreads nests replies under their parents. Comments come oldest first, so a
+// parent is always seen before its replies.
+func commentThreads(comments []domain.Comment) []*commentResponse {
+	threads := make([]*commentResponse, 0)
+	byID := make(map[int]*commentResponse)
+
+	for _, c := range comments {
+		res := newCommentResponse(c)
+		byID[c.ID] = res
+
+		if c.ParentID != nil {
+			if parent, ok := byID[*c.ParentID]; ok {
+				parent.Replies = append(parent.Replies, res)
+				continue
+			}
+		}
+
+		threads = append(threads, res)
+	}
+
+	return threads
+}
+
+func (s *Server) listComments(w http.ResponseWriter, r *http.Request) {
+	comments, err := s.commentService.List(identityFromContext(r.Context()), mux.Vars(r)["id"])
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrSightingNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error fetching comments")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(commentThreads(comments))
+}
+
+type createCommentRequest struct {
+	Body     string `json:"body"`
+	ParentID *int   `json:"parentId"`
+}
+
+func (req createCommentRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Body, validation.Required, validation.RuneLength(1, maxCommentLength)),
+	)
+}
+
+func (s *Server) createComment(w http.ResponseWriter, r *http.Request) {
+	var req createCommentRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	comment, err := s.commentService.Create(
+		identityFromContext(r.Context()),
+		mux.Vars(r)["id"],
+		domain.Comment{Body: req.Body, ParentID: req.ParentID},
+	)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrSightingNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, domain.ErrInvalidParent):
+			s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error creating comment")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newCommentResponse(comment))
+}
+
+type updateCommentRequest struct {
+	Body string `json:"body"`
+}
+
+func (req updateCommentRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Body, validation.Required, validation.RuneLength(1, maxCommentLength)),
+	)
+}
+
+func (s *Server) updateComment(w http.ResponseWriter, r *http.Request) {
+	var req updateCommentRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	comment, err := s.commentService.Update(identityFromContext(r.Context()), id, req.Body)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrCommentNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, domain.ErrCommentForbidden):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error updating comment")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newCommentResponse(comment))
+}
+
+func (s *Server) deleteComment(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	err := s.commentService.Delete(identityFromContext(r.Context()), id)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrCommentNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, domain.ErrCommentForbidden):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error deleting comment")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listHeldComments(w http.ResponseWriter, r *http.Request) {
+	comments, err := s.commentService.ListHeld(identityFromContext(r.Context()))
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrModeratorOnly):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error fetching comments")
+		}
+		return
+	}
+
+	res := make([]*commentResponse, 0)
+	for _, c := range comments {
+		res = append(res, newCommentResponse(c))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+type moderateCommentRequest struct {
+	Status domain.CommentStatus `json:"status"`
+}
+
+func (req moderateCommentRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Status, validation.Required, validation.In(domain.CommentStatuses...)),
+	)
+}
+
+func (s *Server) moderateComment(w http.ResponseWriter, r *http.Request) {
+	var req moderateCommentRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	err := s.commentService.Moderate(identityFromContext(r.Context()), id, req.Status)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrCommentNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, domain.ErrModeratorOnly):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error moderating comment")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,44 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// Config holds the settings that differ between environments.
+type Config struct {
+	// OAuthRedirectURIs lists the only places an OAuth login may send the user back
+	// to, matched exactly. Native apps register their custom scheme URIs here.
+	OAuthRedirectURIs []string
+
+	// FrontendURL is where the web app is served, links opened on the API are sent
+	// on to it.
+	FrontendURL string
+
+	// CookieSecure should be set wherever the API is served over HTTPS.
+	CookieSecure   bool
+	CookieSameSite http.SameSite
+
+	CORS CORSConfig
+}
+
+func (c Config) allowedRedirectURI(uri string) bool {
+	for _, allowed := range c.OAuthRedirectURIs {
+		if uri == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nativeRedirectURI reports whether uri belongs to an app rather than a website. Apps
+// can't keep a client secret and any app can claim a scheme, so they must use PKCE.
+func nativeRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return true
+	}
+
+	return u.Scheme != "http" && u.Scheme != "https"
+}
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/gorilla/mux"
+	"github.com/papacatzzi-server/domain"
+)
+
+type confirmSightingRequest struct {
+	PhotoURL  string   `json:"photoURL"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+}
+
+func (req confirmSightingRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.PhotoURL, is.URL),
+		validation.Field(&req.Latitude, validation.When(req.Longitude != nil, validation.NotNil), validation.Min(-90.0), validation.Max(90.0)),
+		validation.Field(&req.Longitude, validation.When(req.Latitude != nil, validation.NotNil), validation.Min(-180.0), validation.Max(180.0)),
+	)
+}
+
+func (s *Server) confirmSighting(w http.ResponseWriter, r *http.Request) {
+	var req confirmSightingRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	confirmation := domain.Confirmation{
+		PhotoURL:  req.PhotoURL,
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+	}
+
+	err := s.sightingService.Confirm(identityFromContext(r.Context()), mux.Vars(r)["id"], confirmation)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrSightingNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, domain.ErrConfirmOwnSighting):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error confirming sighting")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) unconfirmSighting(w http.ResponseWriter, r *http.Request) {
+	err := s.sightingService.Unconfirm(identityFromContext(r.Context()), mux.Vars(r)["id"])
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrSightingNotFound), errors.Is(err, domain.ErrConfirmationNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error withdrawing confirmation")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,162 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/papacatzzi-server/domain"
+	"github.com/papacatzzi-server/service"
+)
+
+const (
+	accessTokenCookie  = "accessToken"
+	refreshTokenCookie = "refreshToken"
+	csrfTokenCookie    = "csrfToken"
+	oauthLinkCookie    = "oauthLink"
+
+	csrfTokenHeader = "X-CSRF-Token"
+)
+
+func (s *Server) setCookie(w http.ResponseWriter, name string, value string, maxAge time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		HttpOnly: true,
+		Secure:   s.config.CookieSecure,
+		SameSite: s.config.CookieSameSite,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+	})
+}
+
+// setAuthCookies also sets a fresh CSRF token. It is the only cookie scripts can read,
+// the frontend echoes it back in the X-CSRF-Token header.
+func (s *Server) setAuthCookies(w http.ResponseWriter, accessToken string, refreshToken string) {
+	s.setCookie(w, accessTokenCookie, accessToken, service.AccessTokenExpiration)
+	s.setCookie(w, refreshTokenCookie, refreshToken, service.RefreshTokenExpiration)
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		s.logger.Error().Err(err).Msg("failed to generate csrf token")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfTokenCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(b),
+		Secure:   s.config.CookieSecure,
+		SameSite: s.config.CookieSameSite,
+		Path:     "/",
+		MaxAge:   int(service.RefreshTokenExpiration.Seconds()),
+	})
+}
+
+// clearCookie tells the browser to delete a cookie. A negative MaxAge is what sends
+// Max-Age=0, a zero one sends no Max-Age and leaves an empty session cookie behind.
+func (s *Server) clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		HttpOnly: true,
+		Secure:   s.config.CookieSecure,
+		SameSite: s.config.CookieSameSite,
+		Path:     "/",
+		MaxAge:   -1,
+	})
+}
+
+func (s *Server) clearAuthCookies(w http.ResponseWriter) {
+	for _, name := range []string{accessTokenCookie, refreshTokenCookie, csrfTokenCookie} {
+		s.clearCookie(w, name)
+	}
+}
+
+// validCSRFToken is a double submit check, another site can make the browser send our
+// cookies but can't read them to copy the token into the header. Safe methods pass.
+func validCSRFToken(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie, err := r.Cookie(csrfTokenCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	header := r.Header.Get(csrfTokenHeader)
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) == 1
+}
+
+type refreshCookieRequest struct {
+	Device string `json:"device"`
+}
+
+// refreshCookie is refreshToken for the browser, the tokens only ever travel in cookies.
+func (s *Server) refreshCookie(w http.ResponseWriter, r *http.Request) {
+	var req refreshCookieRequest
+
+	// the body is optional
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.logger.Error().Err(err).Msg("failed to parse request")
+			s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+			return
+		}
+	}
+
+	cookie, err := r.Cookie(refreshTokenCookie)
+	if err != nil {
+		s.errorResponse(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+
+	if !validCSRFToken(r) {
+		s.errorResponse(w, http.StatusForbidden, "Invalid CSRF token")
+		return
+	}
+
+	accessToken, refreshToken, err := s.authService.RefreshToken(cookie.Value, clientSession(r, req.Device))
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrInvalidToken), errors.Is(err, domain.ErrRefreshTokenReused):
+			s.clearAuthCookies(w)
+			s.errorResponse(w, http.StatusUnauthorized, "Invalid refresh token")
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error refreshing token")
+		}
+		return
+	}
+
+	s.setAuthCookies(w, accessToken, refreshToken)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) logoutCookie(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(refreshTokenCookie)
+	if err != nil {
+		s.clearAuthCookies(w)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if !validCSRFToken(r) {
+		s.errorResponse(w, http.StatusForbidden, "Invalid CSRF token")
+		return
+	}
+
+	err = s.authService.Logout(cookie.Value)
+	if err != nil && !errors.Is(err, domain.ErrInvalidToken) {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to process log out")
+		return
+	}
+
+	s.clearAuthCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
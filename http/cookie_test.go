@@ -0,0 +1,87 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClearAuthCookies(t *testing.T) {
+	s := &Server{config: Config{CookieSameSite: http.SameSiteLaxMode}}
+
+	w := httptest.NewRecorder()
+	s.clearAuthCookies(w)
+
+	cleared := make(map[string]bool)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge >= 0 {
+			t.Errorf("cookie %s has MaxAge %d, browsers would keep it", cookie.Name, cookie.MaxAge)
+		}
+
+		if cookie.Value != "" {
+			t.Errorf("cookie %s has value %q", cookie.Name, cookie.Value)
+		}
+
+		cleared[cookie.Name] = true
+	}
+
+	for _, name := range []string{accessTokenCookie, refreshTokenCookie, csrfTokenCookie} {
+		if !cleared[name] {
+			t.Errorf("cookie %s was not cleared", name)
+		}
+	}
+}
+
+func TestValidCSRFToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		cookie string
+		header string
+		want   bool
+	}{
+		{"safe method", http.MethodGet, "", "", true},
+		{"matching token", http.MethodPost, "token", "token", true},
+		{"missing header", http.MethodPost, "token", "", false},
+		{"missing cookie", http.MethodPost, "", "token", false},
+		{"both empty", http.MethodPost, "", "", false},
+		{"different token", http.MethodDelete, "token", "other", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: csrfTokenCookie, Value: tt.cookie})
+			}
+
+			if tt.header != "" {
+				r.Header.Set(csrfTokenHeader, tt.header)
+			}
+
+			if got := validCSRFToken(r); got != tt.want {
+				t.Errorf("validCSRFToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptionalAuthIgnoresClearedCookie(t *testing.T) {
+	s := &Server{}
+
+	called := false
+	handler := s.optionalAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/sightings", nil)
+	r.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: ""})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if !called || w.Code != http.StatusOK {
+		t.Errorf("got status %d, want the request to go through anonymously", w.Code)
+	}
+}
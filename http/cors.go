@@ -0,0 +1,81 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig decides which frontends may call the API from a browser.
+type CORSConfig struct {
+	// AllowedOrigins are matched exactly. A "*" entry allows any origin, but then
+	// browsers won't send cookies since credentials can't be allowed for everyone.
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	MaxAge         time.Duration
+}
+
+func (c CORSConfig) allowOrigin(origin string) (allowed bool, wildcard bool) {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			wildcard = true
+			continue
+		}
+
+		if o == origin {
+			return true, false
+		}
+	}
+
+	return wildcard, wildcard
+}
+
+// cors wraps the whole router rather than being a mux middleware, mux skips its
+// middleware when no route matches the method, which is every preflight request to a
+// route registered without OPTIONS.
+func cors(config CORSConfig, next http.Handler) http.Handler {
+	methods := strings.Join(config.AllowedMethods, ", ")
+	headers := strings.Join(config.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(config.MaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		w.Header().Add("Vary", "Origin")
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		allowed, wildcard := config.allowOrigin(origin)
+		if origin != "" && allowed {
+			if wildcard {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if !preflight {
+			if origin != "" && allowed {
+				w.Header().Set("Access-Control-Expose-Headers", "Retry-After")
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// a disallowed origin gets an answer without any allow headers, which the browser treats as a refusal
+		if origin != "" && allowed {
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			w.Header().Set("Access-Control-Max-Age", maxAge)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,153 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	allowList := CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders: []string{"Content-Type"},
+		MaxAge:         time.Hour,
+	}
+
+	wildcard := allowList
+	wildcard.AllowedOrigins = []string{"*"}
+
+	tests := []struct {
+		name        string
+		config      CORSConfig
+		method      string
+		origin      string
+		preflight   bool
+		status      int
+		allowOrigin string
+		credentials string
+		allowMethod string
+		reachedNext bool
+	}{
+		{
+			name:        "allowed origin",
+			config:      allowList,
+			method:      http.MethodGet,
+			origin:      "https://app.example.com",
+			status:      http.StatusOK,
+			allowOrigin: "https://app.example.com",
+			credentials: "true",
+			reachedNext: true,
+		},
+		{
+			name:        "disallowed origin",
+			config:      allowList,
+			method:      http.MethodGet,
+			origin:      "https://evil.example.com",
+			status:      http.StatusOK,
+			reachedNext: true,
+		},
+		{
+			name:        "no origin",
+			config:      allowList,
+			method:      http.MethodPost,
+			status:      http.StatusOK,
+			reachedNext: true,
+		},
+		{
+			name:        "allowed preflight",
+			config:      allowList,
+			method:      http.MethodOptions,
+			origin:      "https://app.example.com",
+			preflight:   true,
+			status:      http.StatusNoContent,
+			allowOrigin: "https://app.example.com",
+			credentials: "true",
+			allowMethod: "GET, POST",
+		},
+		{
+			name:      "disallowed preflight",
+			config:    allowList,
+			method:    http.MethodOptions,
+			origin:    "https://evil.example.com",
+			preflight: true,
+			status:    http.StatusNoContent,
+		},
+		{
+			name:        "options without preflight headers",
+			config:      allowList,
+			method:      http.MethodOptions,
+			origin:      "https://app.example.com",
+			status:      http.StatusOK,
+			allowOrigin: "https://app.example.com",
+			credentials: "true",
+			reachedNext: true,
+		},
+		{
+			name:        "wildcard",
+			config:      wildcard,
+			method:      http.MethodGet,
+			origin:      "https://anyone.example.com",
+			status:      http.StatusOK,
+			allowOrigin: "*",
+			reachedNext: true,
+		},
+		{
+			name:        "wildcard preflight",
+			config:      wildcard,
+			method:      http.MethodOptions,
+			origin:      "https://anyone.example.com",
+			preflight:   true,
+			status:      http.StatusNoContent,
+			allowOrigin: "*",
+			allowMethod: "GET, POST",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached := false
+			handler := cors(tt.config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			r := httptest.NewRequest(tt.method, "/sightings", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+
+			if tt.preflight {
+				r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+
+			if reached != tt.reachedNext {
+				t.Errorf("reached next handler = %v, want %v", reached, tt.reachedNext)
+			}
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.credentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.credentials)
+			}
+
+			if got := w.Header().Get("Access-Control-Allow-Methods"); got != tt.allowMethod {
+				t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, tt.allowMethod)
+			}
+
+			if got := w.Header().Values("Vary"); len(got) == 0 || got[0] != "Origin" {
+				t.Errorf("Vary = %v, want it to start with Origin", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gorilla/mux"
+	"github.com/papacatzzi-server/domain"
+)
+
+type deleteAccountRequest struct {
+	Password string `json:"password"`
+
+	// Code is for accounts without a password, see beginAccountDeletion.
+	Code string `json:"code"`
+}
+
+func (s *Server) beginAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	err := s.authService.BeginAccountDeletion(identityFromContext(r.Context()))
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrUserAccountNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "failed to send confirmation code")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	var req deleteAccountRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	err := s.authService.DeleteAccount(identityFromContext(r.Context()), req.Password, req.Code)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrInvalidCredentials):
+			s.errorResponse(w, http.StatusUnauthorized, "Password is incorrect")
+		case errors.Is(err, domain.ErrIncorrectCode):
+			s.errorResponse(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrTooManyAttempts):
+			s.errorResponse(w, http.StatusTooManyRequests, "Too many incorrect codes, please request a new one")
+		case errors.Is(err, domain.ErrUserAccountNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "failed to delete account")
+		}
+		return
+	}
+
+	s.clearAuthCookies(w)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type restoreAccountRequest struct {
+	Token string `json:"token"`
+}
+
+func (req restoreAccountRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Token, validation.Required),
+	)
+}
+
+func (s *Server) restoreAccount(w http.ResponseWriter, r *http.Request) {
+	var req restoreAccountRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	err := s.authService.RestoreAccount(req.Token)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrInvalidToken), errors.Is(err, domain.ErrUserAccountNotFound):
+			s.errorResponse(w, http.StatusBadRequest, "Invalid or expired restore link")
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "failed to restore account")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) exportData(w http.ResponseWriter, r *http.Request) {
+	identity := identityFromContext(r.Context())
+
+	sessions, err := s.authService.ListSessions(identity.UserID)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "failed to export data")
+		return
+	}
+
+	err = s.userService.ExportData(identity, sessions)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrUserAccountNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "failed to export data")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) downloadExport(w http.ResponseWriter, r *http.Request) {
+	path, err := s.userService.GetExport(identityFromContext(r.Context()), mux.Vars(r)["token"])
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrExportNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "failed to download export")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="papacatzzi-export.zip"`)
+	http.ServeFile(w, r, path)
+}
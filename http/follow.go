@@ -0,0 +1,43 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/papacatzzi-server/domain"
+)
+
+func (s *Server) follow(w http.ResponseWriter, r *http.Request) {
+	err := s.userService.Follow(identityFromContext(r.Context()), mux.Vars(r)["username"])
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrUserAccountNotFound):
+			s.errorResponse(w, http.StatusNotFound, "User not found")
+		case errors.Is(err, domain.ErrFollowSelf):
+			s.errorResponse(w, http.StatusBadRequest, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error following user")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) unfollow(w http.ResponseWriter, r *http.Request) {
+	err := s.userService.Unfollow(identityFromContext(r.Context()), mux.Vars(r)["username"])
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrUserAccountNotFound):
+			s.errorResponse(w, http.StatusNotFound, "User not found")
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error unfollowing user")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
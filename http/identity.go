@@ -0,0 +1,125 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gorilla/mux"
+	"github.com/markbates/goth"
+	"github.com/papacatzzi-server/domain"
+	"github.com/papacatzzi-server/service"
+)
+
+type identityResponse struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type linkIdentityResponse struct {
+	URL string `json:"url"`
+}
+
+func (s *Server) listIdentities(w http.ResponseWriter, r *http.Request) {
+	identity := identityFromContext(r.Context())
+
+	identities, err := s.authService.ListIdentities(identity)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "Error listing linked accounts")
+		return
+	}
+
+	res := make([]identityResponse, 0)
+	for _, i := range identities {
+		res = append(res, identityResponse{
+			Provider:  i.Provider,
+			Email:     i.Email,
+			CreatedAt: i.CreatedAt,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+type linkIdentityRequest struct {
+	RedirectURI string `json:"redirectUri"`
+}
+
+func (req linkIdentityRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.RedirectURI, validation.Required),
+	)
+}
+
+// linkIdentity returns the URL the browser should navigate to. Navigations don't carry
+// the Authorization header, so the state in the URL is what ties the callback to the
+// user. The cookie makes sure only this browser can use that state.
+func (s *Server) linkIdentity(w http.ResponseWriter, r *http.Request) {
+	var req linkIdentityRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if !s.config.allowedRedirectURI(req.RedirectURI) {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid redirectUri")
+		return
+	}
+
+	provider := mux.Vars(r)["provider"]
+
+	if _, err := goth.GetProvider(provider); err != nil {
+		s.errorResponse(w, http.StatusNotFound, "Unknown provider")
+		return
+	}
+
+	state, err := s.authService.BeginOAuthLink(identityFromContext(r.Context()), req.RedirectURI)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "Error linking account")
+		return
+	}
+
+	s.setCookie(w, oauthLinkCookie, state, service.OAuthStateExpiration)
+
+	res := linkIdentityResponse{
+		URL: "/auth/" + url.PathEscape(provider) + "?state=" + url.QueryEscape(state),
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) unlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	identity := identityFromContext(r.Context())
+	provider := mux.Vars(r)["provider"]
+
+	err := s.authService.UnlinkIdentity(identity, provider)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrOAuthIdentityNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, domain.ErrLastLoginMethod):
+			s.errorResponse(w, http.StatusConflict, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error unlinking account")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
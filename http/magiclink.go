@@ -0,0 +1,107 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/papacatzzi-server/domain"
+)
+
+type beginMagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+func (req beginMagicLinkRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Email, validation.Required, is.Email),
+	)
+}
+
+func (s *Server) beginMagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	var req beginMagicLinkRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	err := s.authService.BeginMagicLinkLogin(req.Email)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "failed to send login link")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+type completeMagicLinkRequest struct {
+	Token  string `json:"token"`
+	Device string `json:"device"`
+}
+
+func (req completeMagicLinkRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Token, validation.Required),
+	)
+}
+
+// redirectMagicLink sends a login link opened on the API on to the web app, which
+// completes the login with a POST. Mail scanners and link previews fetch links with
+// GET, so a GET must never use up the token.
+func (s *Server) redirectMagicLink(w http.ResponseWriter, r *http.Request) {
+	target := s.config.FrontendURL + "/login/magic?token=" + url.QueryEscape(r.URL.Query().Get("token"))
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func (s *Server) completeMagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	var req completeMagicLinkRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	accessToken, refreshToken, mfaToken, err := s.authService.CompleteMagicLinkLogin(req.Token, clientSession(r, req.Device))
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrInvalidToken):
+			s.errorResponse(w, http.StatusUnauthorized, "Invalid or expired login link")
+		case errors.Is(err, domain.ErrAccountDeleted):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Failed to process log in")
+		}
+		return
+	}
+
+	if accessToken != "" {
+		s.setAuthCookies(w, accessToken, refreshToken)
+	}
+
+	res := loginResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		MFAToken:     mfaToken,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,207 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/papacatzzi-server/domain"
+)
+
+type completeMFALoginRequest struct {
+	MFAToken string `json:"mfa"`
+	Code     string `json:"code"`
+	Device   string `json:"device"`
+}
+
+func (req completeMFALoginRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.MFAToken, validation.Required),
+		validation.Field(&req.Code, validation.Required),
+	)
+}
+
+func (s *Server) completeMFALogin(w http.ResponseWriter, r *http.Request) {
+	var req completeMFALoginRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	accessToken, refreshToken, err := s.authService.CompleteMFALogin(req.MFAToken, req.Code, clientSession(r, req.Device))
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrIncorrectCode):
+			s.errorResponse(w, http.StatusUnauthorized, err.Error())
+		case errors.Is(err, domain.ErrInvalidToken), errors.Is(err, domain.ErrTooManyAttempts):
+			s.errorResponse(w, http.StatusUnauthorized, "Login expired, please log in again")
+		case errors.Is(err, domain.ErrAccountDeleted):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Failed to process log in")
+		}
+		return
+	}
+
+	s.setAuthCookies(w, accessToken, refreshToken)
+
+	res := loginResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+type totpEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode string `json:"qrCode"`
+}
+
+func (s *Server) beginTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	identity := identityFromContext(r.Context())
+
+	secret, uri, qrCode, err := s.authService.BeginTOTPEnrollment(identity)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrMFAAlreadyEnabled):
+			s.errorResponse(w, http.StatusBadRequest, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "failed to begin two-factor enrollment")
+		}
+		return
+	}
+
+	res := totpEnrollmentResponse{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode),
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+func (req mfaCodeRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Code, validation.Required),
+	)
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+func (s *Server) confirmTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	var req mfaCodeRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	identity := identityFromContext(r.Context())
+
+	recoveryCodes, err := s.authService.ConfirmTOTPEnrollment(identity, req.Code)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrIncorrectCode),
+			errors.Is(err, domain.ErrMFAAlreadyEnabled),
+			errors.Is(err, domain.ErrMFAEnrollmentEnded):
+			s.errorResponse(w, http.StatusBadRequest, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "failed to confirm two-factor enrollment")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(recoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+func (s *Server) disableTOTP(w http.ResponseWriter, r *http.Request) {
+	var req mfaCodeRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	identity := identityFromContext(r.Context())
+
+	err := s.authService.DisableTOTP(identity, req.Code)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrIncorrectCode), errors.Is(err, domain.ErrMFANotEnabled):
+			s.errorResponse(w, http.StatusBadRequest, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "failed to disable two-factor authentication")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req mfaCodeRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	identity := identityFromContext(r.Context())
+
+	recoveryCodes, err := s.authService.RegenerateRecoveryCodes(identity, req.Code)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrIncorrectCode), errors.Is(err, domain.ErrMFANotEnabled):
+			s.errorResponse(w, http.StatusBadRequest, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "failed to regenerate recovery codes")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(recoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
@@ -0,0 +1,350 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gorilla/mux"
+	"github.com/papacatzzi-server/domain"
+)
+
+const (
+	defaultNotificationLimit = 50
+	maxNotificationLimit     = 100
+)
+
+var clockPattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+type alertAreaResponse struct {
+	ID           int          `json:"id"`
+	Name         string       `json:"name"`
+	Polygon      [][2]float64 `json:"polygon,omitempty"`
+	Latitude     *float64     `json:"latitude,omitempty"`
+	Longitude    *float64     `json:"longitude,omitempty"`
+	RadiusMeters float64      `json:"radiusMeters,omitempty"`
+	CreatedAt    time.Time    `json:"createdAt"`
+}
+
+func newAlertAreaResponse(area domain.AlertArea) (res alertAreaResponse) {
+	res = alertAreaResponse{
+		ID:        area.ID,
+		Name:      area.Name,
+		Polygon:   area.Polygon,
+		CreatedAt: area.CreatedAt,
+	}
+
+	if len(area.Polygon) == 0 {
+		res.Latitude, res.Longitude = &area.Latitude, &area.Longitude
+		res.RadiusMeters = area.RadiusMeters
+	}
+
+	return
+}
+
+// createAlertAreaRequest takes either a polygon of [longitude, latitude] pairs, as in
+// GeoJSON, or a point and a radius around it.
+type createAlertAreaRequest struct {
+	Name         string       `json:"name"`
+	Polygon      [][2]float64 `json:"polygon"`
+	Latitude     *float64     `json:"latitude"`
+	Longitude    *float64     `json:"longitude"`
+	RadiusMeters float64      `json:"radiusMeters"`
+}
+
+func (req createAlertAreaRequest) Validate() (err error) {
+	circle := len(req.Polygon) == 0
+
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Name, validation.Required, validation.Length(1, 100)),
+		validation.Field(&req.Polygon, validation.When(!circle, validation.Length(4, 200), validation.By(validRing))),
+		validation.Field(&req.Latitude, validation.When(circle, validation.NotNil), validation.Min(-90.0), validation.Max(90.0)),
+		validation.Field(&req.Longitude, validation.When(circle, validation.NotNil), validation.Min(-180.0), validation.Max(180.0)),
+		validation.Field(&req.RadiusMeters, validation.When(circle, validation.Required, validation.Min(50.0), validation.Max(50000.0))),
+	)
+}
+
+// validRing checks a polygon is closed and stays on the map. Whether it crosses itself
+// is left to PostGIS.
+func validRing(value interface{}) error {
+	ring, _ := value.([][2]float64)
+
+	for _, p := range ring {
+		if p[0] < -180 || p[0] > 180 || p[1] < -90 || p[1] > 90 {
+			return errors.New("must only contain valid [longitude, latitude] pairs")
+		}
+	}
+
+	if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+		return errors.New("must end where it starts")
+	}
+
+	return nil
+}
+
+func (s *Server) createAlertArea(w http.ResponseWriter, r *http.Request) {
+	var req createAlertAreaRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	area := domain.AlertArea{
+		Name:    req.Name,
+		Polygon: req.Polygon,
+	}
+
+	if len(req.Polygon) == 0 {
+		area.Latitude, area.Longitude, area.RadiusMeters = *req.Latitude, *req.Longitude, req.RadiusMeters
+	}
+
+	id, err := s.notificationService.CreateArea(identityFromContext(r.Context()), area)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrInvalidAlertArea):
+			s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		case errors.Is(err, domain.ErrTooManyAlertAreas):
+			s.errorResponse(w, http.StatusConflict, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error creating alert area")
+		}
+		return
+	}
+
+	area.ID = id
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newAlertAreaResponse(area))
+}
+
+func (s *Server) listAlertAreas(w http.ResponseWriter, r *http.Request) {
+	areas, err := s.notificationService.ListAreas(identityFromContext(r.Context()))
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "Error listing alert areas")
+		return
+	}
+
+	res := make([]alertAreaResponse, 0)
+	for _, area := range areas {
+		res = append(res, newAlertAreaResponse(area))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) deleteAlertArea(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	err := s.notificationService.DeleteArea(identityFromContext(r.Context()), id)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrAlertAreaNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error deleting alert area")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type notificationPreferencesRequest struct {
+	Email      bool   `json:"email"`
+	InApp      bool   `json:"inApp"`
+	Push       bool   `json:"push"`
+	MaxPerHour int    `json:"maxPerHour"`
+	QuietStart string `json:"quietStart"`
+	QuietEnd   string `json:"quietEnd"`
+	TimeZone   string `json:"timeZone"`
+}
+
+func (req notificationPreferencesRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.MaxPerHour, validation.Min(0), validation.Max(60)),
+		validation.Field(&req.QuietStart, validation.When(req.QuietEnd != "", validation.Required), validation.Match(clockPattern)),
+		validation.Field(&req.QuietEnd, validation.When(req.QuietStart != "", validation.Required), validation.Match(clockPattern)),
+		validation.Field(&req.TimeZone, validation.Required, validation.By(validTimeZone)),
+	)
+}
+
+func validTimeZone(value interface{}) error {
+	name, _ := value.(string)
+
+	if _, err := time.LoadLocation(name); err != nil {
+		return errors.New("must be an IANA time zone such as Europe/Paris")
+	}
+
+	return nil
+}
+
+type notificationPreferencesResponse notificationPreferencesRequest
+
+func (s *Server) getNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	prefs, err := s.notificationService.GetPreferences(identityFromContext(r.Context()))
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "Error fetching notification preferences")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(notificationPreferencesResponse(prefs))
+}
+
+func (s *Server) updateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	var req notificationPreferencesRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	err := s.notificationService.UpdatePreferences(identityFromContext(r.Context()), domain.NotificationPreferences(req))
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrPushUnavailable):
+			s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error updating notification preferences")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type pushDeviceRequest struct {
+	Token string `json:"token"`
+}
+
+func (req pushDeviceRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Token, validation.Required, validation.Length(1, 4096)),
+	)
+}
+
+func (s *Server) registerPushDevice(w http.ResponseWriter, r *http.Request) {
+	var req pushDeviceRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	err := s.notificationService.RegisterPushDevice(identityFromContext(r.Context()), req.Token)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrPushUnavailable):
+			s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error registering push device")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) unregisterPushDevice(w http.ResponseWriter, r *http.Request) {
+	err := s.notificationService.UnregisterPushDevice(identityFromContext(r.Context()), mux.Vars(r)["token"])
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "Error unregistering push device")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type notificationResponse struct {
+	ID         int        `json:"id"`
+	SightingID int        `json:"sightingId"`
+	AreaID     *int       `json:"areaId"`
+	AreaName   string     `json:"areaName"`
+	Animal     string     `json:"animal"`
+	ReadAt     *time.Time `json:"readAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func (s *Server) listNotifications(w http.ResponseWriter, r *http.Request) {
+	limit := defaultNotificationLimit
+	if param := r.URL.Query().Get("limit"); param != "" {
+		var err error
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > maxNotificationLimit {
+			s.errorResponse(w, http.StatusBadRequest, "Invalid limit, must be between 1 and 100")
+			return
+		}
+	}
+
+	notifications, err := s.notificationService.List(identityFromContext(r.Context()), limit)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "Error fetching notifications")
+		return
+	}
+
+	res := make([]notificationResponse, 0)
+	for _, n := range notifications {
+		res = append(res, notificationResponse{
+			ID:         n.ID,
+			SightingID: n.SightingID,
+			AreaID:     n.AreaID,
+			AreaName:   n.AreaName,
+			Animal:     n.Animal,
+			ReadAt:     n.ReadAt,
+			CreatedAt:  n.CreatedAt,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) markNotificationRead(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	err := s.notificationService.MarkRead(identityFromContext(r.Context()), id)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrNotificationNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error updating notification")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,173 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/markbates/goth/gothic"
+	"github.com/papacatzzi-server/domain"
+	"github.com/papacatzzi-server/service"
+)
+
+// beginOAuth sends the browser to the provider. Clients pass the redirect_uri to come
+// back to and, with PKCE, a code_challenge and code_challenge_method=S256.
+func (s *Server) beginOAuth(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// link flows already have their state, bound to this browser by linkIdentity's cookie
+	if state := query.Get("state"); state != "" {
+		cookie, err := r.Cookie(oauthLinkCookie)
+		if err != nil || cookie.Value != state {
+			s.errorResponse(w, http.StatusBadRequest, "Invalid state")
+			return
+		}
+
+		s.clearCookie(w, oauthLinkCookie)
+		gothic.BeginAuthHandler(w, r)
+		return
+	}
+
+	redirectURI := query.Get("redirect_uri")
+	codeChallenge := query.Get("code_challenge")
+	codeChallengeMethod := query.Get("code_challenge_method")
+
+	if !s.config.allowedRedirectURI(redirectURI) {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid redirect_uri")
+		return
+	}
+
+	if codeChallenge == "" && nativeRedirectURI(redirectURI) {
+		s.errorResponse(w, http.StatusBadRequest, "code_challenge is required")
+		return
+	}
+
+	if codeChallenge != "" && codeChallengeMethod != service.PKCEChallengeMethodS256 {
+		s.errorResponse(w, http.StatusBadRequest, "code_challenge_method must be S256")
+		return
+	}
+
+	state, err := s.authService.BeginOAuth(redirectURI, codeChallenge, codeChallengeMethod)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "Error authenticating user")
+		return
+	}
+
+	// gothic forwards a state found in the query to the provider
+	query.Set("state", state)
+	r.URL.RawQuery = query.Encode()
+
+	gothic.BeginAuthHandler(w, r)
+}
+
+// completeOAuth sends the browser back to the client with a one time code, or with an
+// error the client can show. Tokens are only handed out by exchangeOAuthCode.
+func (s *Server) completeOAuth(w http.ResponseWriter, r *http.Request) {
+	user, err := gothic.CompleteUserAuth(w, r)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "Error authenticating user")
+		return
+	}
+
+	redirectURI, code, err := s.authService.CompleteOAuth(gothic.GetState(r), user.Provider, user.UserID, user.Email)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrInvalidToken):
+			s.errorResponse(w, http.StatusBadRequest, "Invalid or expired state")
+		case errors.Is(err, domain.ErrOAuthAccountExists),
+			errors.Is(err, domain.ErrOAuthIdentityTaken),
+			errors.Is(err, domain.ErrOAuthProviderLinked):
+			s.redirectWithParams(w, r, redirectURI, url.Values{"error": {err.Error()}})
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error authenticating user")
+		}
+		return
+	}
+
+	// link flows return without a code, the user is already logged in
+	if code == "" {
+		s.redirectWithParams(w, r, redirectURI, url.Values{"linked": {user.Provider}})
+		return
+	}
+
+	s.redirectWithParams(w, r, redirectURI, url.Values{"code": {code}})
+}
+
+type exchangeOAuthCodeRequest struct {
+	Code         string `json:"code"`
+	CodeVerifier string `json:"codeVerifier"`
+	RedirectURI  string `json:"redirectUri"`
+	Device       string `json:"device"`
+}
+
+func (req exchangeOAuthCodeRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Code, validation.Required),
+		validation.Field(&req.RedirectURI, validation.Required),
+	)
+}
+
+// exchangeOAuthCode returns tokens in the body for apps and also sets them as
+// HttpOnly cookies for the browser.
+func (s *Server) exchangeOAuthCode(w http.ResponseWriter, r *http.Request) {
+	var req exchangeOAuthCodeRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	accessToken, refreshToken, mfaToken, err := s.authService.ExchangeOAuthCode(req.Code, req.CodeVerifier, req.RedirectURI, clientSession(r, req.Device))
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrInvalidAuthorizationCode):
+			s.errorResponse(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrAccountDeleted):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error generating tokens")
+		}
+		return
+	}
+
+	if accessToken != "" {
+		s.setAuthCookies(w, accessToken, refreshToken)
+	}
+
+	res := loginResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		MFAToken:     mfaToken,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) redirectWithParams(w http.ResponseWriter, r *http.Request, uri string, params url.Values) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Invalid redirect_uri")
+		return
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
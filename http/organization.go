@@ -0,0 +1,314 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/papacatzzi-server/domain"
+)
+
+type organizationResponse struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type organizationDetailsResponse struct {
+	organizationResponse
+	Members []memberResponse `json:"members"`
+}
+
+type memberResponse struct {
+	UserID   string    `json:"userId"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+func newOrganizationResponse(org domain.Organization) organizationResponse {
+	return organizationResponse{
+		ID:        org.ID,
+		Name:      org.Name,
+		Role:      org.Role,
+		CreatedAt: org.CreatedAt,
+	}
+}
+
+type createOrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+func (req createOrganizationRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Name, validation.Required, validation.Length(2, 100)),
+	)
+}
+
+func (s *Server) createOrganization(w http.ResponseWriter, r *http.Request) {
+	var req createOrganizationRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	org, err := s.orgService.Create(identityFromContext(r.Context()), req.Name)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "Error creating organization")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newOrganizationResponse(org))
+}
+
+func (s *Server) listOrganizations(w http.ResponseWriter, r *http.Request) {
+	orgs, err := s.orgService.List(identityFromContext(r.Context()))
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "Error listing organizations")
+		return
+	}
+
+	res := make([]organizationResponse, 0)
+	for _, org := range orgs {
+		res = append(res, newOrganizationResponse(org))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) getOrganization(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	org, members, err := s.orgService.Get(identityFromContext(r.Context()), id)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrOrganizationNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error fetching organization")
+		}
+		return
+	}
+
+	res := organizationDetailsResponse{
+		organizationResponse: newOrganizationResponse(org),
+		Members:              make([]memberResponse, 0),
+	}
+
+	for _, m := range members {
+		res.Members = append(res.Members, memberResponse{
+			UserID:   m.UserID.String(),
+			Username: m.Username,
+			Role:     m.Role,
+			JoinedAt: m.CreatedAt,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) deleteOrganization(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	err := s.orgService.Delete(identityFromContext(r.Context()), id)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrOrganizationNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, domain.ErrOrganizationForbidden):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error deleting organization")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type inviteMemberRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+func (req inviteMemberRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Email, validation.Required, is.Email),
+		validation.Field(&req.Role, validation.Required, validation.In(domain.OrgRoles...)),
+	)
+}
+
+func (s *Server) inviteMember(w http.ResponseWriter, r *http.Request) {
+	var req inviteMemberRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	err := s.orgService.Invite(identityFromContext(r.Context()), id, req.Email, req.Role)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrOrganizationNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, domain.ErrOrganizationForbidden):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error sending invite")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type acceptInviteRequest struct {
+	Token string `json:"token"`
+}
+
+func (req acceptInviteRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Token, validation.Required),
+	)
+}
+
+func (s *Server) acceptInvite(w http.ResponseWriter, r *http.Request) {
+	var req acceptInviteRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	org, err := s.orgService.AcceptInvite(identityFromContext(r.Context()), req.Token)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrInviteNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, domain.ErrInviteEmailMismatch):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error accepting invite")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newOrganizationResponse(org))
+}
+
+type updateMemberRequest struct {
+	Role string `json:"role"`
+}
+
+func (req updateMemberRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Role, validation.Required, validation.In(domain.OrgRoles...)),
+	)
+}
+
+func (s *Server) updateMember(w http.ResponseWriter, r *http.Request) {
+	var req updateMemberRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	userID, err := uuid.Parse(mux.Vars(r)["userId"])
+	if err != nil {
+		s.errorResponse(w, http.StatusNotFound, domain.ErrMemberNotFound.Error())
+		return
+	}
+
+	err = s.orgService.UpdateMemberRole(identityFromContext(r.Context()), id, userID, req.Role)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrOrganizationNotFound), errors.Is(err, domain.ErrMemberNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, domain.ErrOrganizationForbidden):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, domain.ErrLastOwner):
+			s.errorResponse(w, http.StatusConflict, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error updating member")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) removeMember(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	userID, err := uuid.Parse(mux.Vars(r)["userId"])
+	if err != nil {
+		s.errorResponse(w, http.StatusNotFound, domain.ErrMemberNotFound.Error())
+		return
+	}
+
+	err = s.orgService.RemoveMember(identityFromContext(r.Context()), id, userID)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrOrganizationNotFound), errors.Is(err, domain.ErrMemberNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, domain.ErrOrganizationForbidden):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, domain.ErrLastOwner):
+			s.errorResponse(w, http.StatusConflict, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error removing member")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
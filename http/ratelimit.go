@@ -0,0 +1,125 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/papacatzzi-server/ratelimit"
+)
+
+// rateLimitPolicy limits a route per client IP and, for routes that take an
+// email in their JSON body, per email so one account can't be targeted from
+// many addresses.
+type rateLimitPolicy struct {
+	Name     string
+	PerIP    ratelimit.Rate
+	PerEmail ratelimit.Rate
+}
+
+var (
+	loginRateLimit = rateLimitPolicy{
+		Name:     "login",
+		PerIP:    ratelimit.Rate{Limit: 30, Window: time.Minute * 15},
+		PerEmail: ratelimit.Rate{Limit: 10, Window: time.Minute * 15},
+	}
+
+	mfaRateLimit = rateLimitPolicy{
+		Name:  "mfa",
+		PerIP: ratelimit.Rate{Limit: 20, Window: time.Minute * 15},
+	}
+
+	passkeyRateLimit = rateLimitPolicy{
+		Name:  "passkey",
+		PerIP: ratelimit.Rate{Limit: 30, Window: time.Minute * 15},
+	}
+
+	// these routes send email, keep them well below the mail quota
+	emailRateLimit = rateLimitPolicy{
+		Name:     "email",
+		PerIP:    ratelimit.Rate{Limit: 10, Window: time.Hour},
+		PerEmail: ratelimit.Rate{Limit: 3, Window: time.Hour},
+	}
+
+	verifyCodeRateLimit = rateLimitPolicy{
+		Name:     "verify_code",
+		PerIP:    ratelimit.Rate{Limit: 20, Window: time.Minute * 15},
+		PerEmail: ratelimit.Rate{Limit: 10, Window: time.Minute * 15},
+	}
+
+	commentRateLimit = rateLimitPolicy{
+		Name:  "comment",
+		PerIP: ratelimit.Rate{Limit: 30, Window: time.Minute * 10},
+	}
+)
+
+// maxPeekedBody is more than any request that is rate limited per email needs.
+const maxPeekedBody = 1 << 20
+
+var errBodyTooLarge = errors.New("request body too large")
+
+func (s *Server) rateLimit(policy rateLimitPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buckets := []ratelimit.Bucket{
+			{Key: policy.Name + "_ip_" + clientIP(r), Rate: policy.PerIP},
+		}
+
+		if policy.PerEmail.Limit > 0 {
+			email, err := peekEmail(r)
+			if errors.Is(err, errBodyTooLarge) {
+				s.errorResponse(w, http.StatusRequestEntityTooLarge, "Request body too large")
+				return
+			}
+
+			if email != "" {
+				buckets = append(buckets, ratelimit.Bucket{Key: policy.Name + "_email_" + email, Rate: policy.PerEmail})
+			}
+		}
+
+		allowed, retryAfter, err := s.limiter.AllowAll(r.Context(), buckets...)
+		if err != nil {
+			// fail open, an unavailable redis shouldn't lock everyone out
+			s.logger.Error().Err(err).Msg("failed to check rate limit")
+		} else if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			s.errorResponse(w, http.StatusTooManyRequests, "Too many requests, please try again later")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// peekEmail reads the email field of a JSON body and restores the body for the handler.
+// Bodies over maxPeekedBody are refused, an email hidden past what was read would
+// otherwise skip its limit.
+func peekEmail(r *http.Request) (email string, err error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekedBody+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+
+	if err != nil {
+		return
+	}
+
+	if len(body) > maxPeekedBody {
+		err = errBodyTooLarge
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	json.Unmarshal(body, &req)
+
+	email = strings.ToLower(strings.TrimSpace(req.Email))
+	return
+}
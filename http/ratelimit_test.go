@@ -0,0 +1,140 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/papacatzzi-server/log"
+	"github.com/papacatzzi-server/ratelimit"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+func newRateLimitedServer(t *testing.T) *Server {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	nop := zerolog.Nop()
+
+	return &Server{
+		logger:  log.Logger{Logger: &nop},
+		limiter: ratelimit.NewLimiter(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+	}
+}
+
+func TestRateLimitChecksEveryBucketBeforeCounting(t *testing.T) {
+	s := newRateLimitedServer(t)
+
+	policy := rateLimitPolicy{
+		Name:     "test",
+		PerIP:    ratelimit.Rate{Limit: 3, Window: time.Minute},
+		PerEmail: ratelimit.Rate{Limit: 1, Window: time.Minute},
+	}
+
+	handler := s.rateLimit(policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// the repeated email is turned away without using up the address' allowance
+	for i, tt := range []struct {
+		email  string
+		status int
+	}{
+		{"tabby@example.com", http.StatusOK},
+		{"Tabby@example.com", http.StatusTooManyRequests},
+		{"calico@example.com", http.StatusOK},
+		{"siamese@example.com", http.StatusOK},
+		{"sphynx@example.com", http.StatusTooManyRequests},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(fmt.Sprintf(`{"email": %q}`, tt.email)))
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("request %d for %v: status = %d, want %d", i+1, tt.email, w.Code, tt.status)
+		}
+
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("request %d: no Retry-After", i+1)
+		}
+	}
+}
+
+func TestRateLimitBody(t *testing.T) {
+	padded := func(size int) []byte {
+		body := []byte(`{"email": "tabby@example.com", "padding": "`)
+		body = append(body, bytes.Repeat([]byte("x"), size-len(body)-2)...)
+		return append(body, `"}`...)
+	}
+
+	tests := []struct {
+		name        string
+		policy      rateLimitPolicy
+		body        []byte
+		status      int
+		reachedNext bool
+	}{
+		{
+			name:        "small body",
+			policy:      loginRateLimit,
+			body:        []byte(`{"email": "tabby@example.com", "password": "hunter22"}`),
+			status:      http.StatusOK,
+			reachedNext: true,
+		},
+		{
+			name:        "body at the limit",
+			policy:      loginRateLimit,
+			body:        padded(maxPeekedBody),
+			status:      http.StatusOK,
+			reachedNext: true,
+		},
+		{
+			name:   "body over the limit",
+			policy: loginRateLimit,
+			body:   padded(maxPeekedBody + 1),
+			status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:        "large body on a route without email limits",
+			policy:      commentRateLimit,
+			body:        padded(2 * maxPeekedBody),
+			status:      http.StatusOK,
+			reachedNext: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRateLimitedServer(t)
+
+			var received []byte
+			reachedNext := false
+
+			handler := s.rateLimit(tt.policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reachedNext = true
+				received, _ = io.ReadAll(r.Body)
+			}))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body)))
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+
+			if reachedNext != tt.reachedNext {
+				t.Fatalf("reached next = %v, want %v", reachedNext, tt.reachedNext)
+			}
+
+			if reachedNext && !bytes.Equal(received, tt.body) {
+				t.Errorf("handler received %d bytes, want the full %d", len(received), len(tt.body))
+			}
+		})
+	}
+}
@@ -1,61 +1,168 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/papacatzzi-server/domain"
 	"github.com/papacatzzi-server/log"
+	"github.com/papacatzzi-server/ratelimit"
 	"github.com/papacatzzi-server/service"
 )
 
+type contextKey string
+
+const identityContextKey contextKey = "identity"
+
 type Server struct {
-	server          *http.Server
-	logger          log.Logger
-	authService     service.AuthService
-	sightingService service.SightingService
+	server              *http.Server
+	logger              log.Logger
+	config              Config
+	limiter             ratelimit.Limiter
+	authService         service.AuthService
+	userService         service.UserService
+	sightingService     service.SightingService
+	orgService          service.OrganizationService
+	commentService      service.CommentService
+	notificationService service.NotificationService
 }
 
 func NewServer(
 	logger log.Logger,
+	config Config,
+	limiter ratelimit.Limiter,
 	authService service.AuthService,
+	userService service.UserService,
 	sightingService service.SightingService,
+	orgService service.OrganizationService,
+	commentService service.CommentService,
+	notificationService service.NotificationService,
 ) (s *Server) {
 
 	s = &Server{
-		server:          &http.Server{Addr: ":8080"},
-		logger:          logger,
-		authService:     authService,
-		sightingService: sightingService,
+		server:              &http.Server{Addr: ":8080"},
+		logger:              logger,
+		config:              config,
+		limiter:             limiter,
+		authService:         authService,
+		userService:         userService,
+		sightingService:     sightingService,
+		orgService:          orgService,
+		commentService:      commentService,
+		notificationService: notificationService,
 	}
 
-	s.server.Handler = s.setupRouter()
+	s.server.Handler = cors(config.CORS, s.setupRouter())
 	return
 }
 
 func (s *Server) setupRouter() (r *mux.Router) {
 	r = mux.NewRouter()
 
-	r.HandleFunc("/login", s.login).Methods("POST")
+	r.Handle("/login", s.rateLimit(loginRateLimit, http.HandlerFunc(s.login))).Methods("POST")
+	r.Handle("/login/mfa", s.rateLimit(mfaRateLimit, http.HandlerFunc(s.completeMFALogin))).Methods("POST")
+	r.Handle("/login/magic", s.rateLimit(emailRateLimit, http.HandlerFunc(s.beginMagicLinkLogin))).Methods("POST")
+	r.HandleFunc("/login/magic/verify", s.redirectMagicLink).Methods("GET")
+	r.HandleFunc("/login/magic/verify", s.completeMagicLinkLogin).Methods("POST")
 	r.HandleFunc("/logout", s.logout).Methods("POST")
+	r.HandleFunc("/logout/cookie", s.logoutCookie).Methods("POST")
 
-	r.HandleFunc("/signup/begin", s.beginSignUp).Methods("POST")
-	r.HandleFunc("/signup/verify", s.verifySignUp).Methods("POST")
+	r.Handle("/signup/begin", s.rateLimit(emailRateLimit, http.HandlerFunc(s.beginSignUp))).Methods("POST")
+	r.Handle("/signup/verify", s.rateLimit(verifyCodeRateLimit, http.HandlerFunc(s.verifySignUp))).Methods("POST")
 	r.HandleFunc("/signup/finish", s.finishSignUp).Methods("POST")
 
-	r.HandleFunc("/forgot-password", s.forgotPassword).Methods("POST")
+	r.Handle("/forgot-password", s.rateLimit(emailRateLimit, http.HandlerFunc(s.forgotPassword))).Methods("POST")
 	r.HandleFunc("/reset-password", s.resetPassword).Methods("POST")
 
+	r.HandleFunc("/account/restore", s.restoreAccount).Methods("POST")
+
+	r.Handle("/auth/webauthn/register/begin", s.auth(http.HandlerFunc(s.beginWebAuthnRegistration))).Methods("POST")
+	r.Handle("/auth/webauthn/register/finish", s.auth(http.HandlerFunc(s.finishWebAuthnRegistration))).Methods("POST")
+	r.HandleFunc("/auth/webauthn/login/begin", s.beginWebAuthnLogin).Methods("POST")
+	r.Handle("/auth/webauthn/login/finish", s.rateLimit(passkeyRateLimit, http.HandlerFunc(s.finishWebAuthnLogin))).Methods("POST")
+
 	r.HandleFunc("/auth/{provider}", s.beginOAuth).Methods("GET")
-	r.HandleFunc("/auth/{provider}/callback", s.completeOAuth).Methods("GET")
+	// apple posts the callback as a form
+	r.HandleFunc("/auth/{provider}/callback", s.completeOAuth).Methods("GET", "POST")
 
-	r.HandleFunc("/refresh/token", s.refreshToken).Methods("POST")
+	r.HandleFunc("/oauth/token", s.exchangeOAuthCode).Methods("POST")
 
-	r.HandleFunc("/sightings", s.listSightings).Methods("GET")
-	r.Handle("/sightings", s.auth(http.HandlerFunc(s.createSighting))).Methods("POST", "OPTIONS")
-	r.HandleFunc("/sightings/{id}", s.getSighting).Methods("GET")
-	r.Use(corsMiddleware)
+	r.HandleFunc("/refresh/token", s.refreshToken).Methods("POST")
+	r.HandleFunc("/refresh/cookie", s.refreshCookie).Methods("POST")
+
+	r.HandleFunc("/.well-known/jwks.json", s.jwks).Methods("GET")
+
+	r.Handle("/me", s.auth(http.HandlerFunc(s.getMe))).Methods("GET")
+	r.Handle("/me", s.auth(http.HandlerFunc(s.updateMe))).Methods("PATCH")
+	r.Handle("/me", s.rateLimit(loginRateLimit, s.auth(http.HandlerFunc(s.deleteAccount)))).Methods("DELETE")
+	r.Handle("/me/deletion-code", s.rateLimit(emailRateLimit, s.auth(http.HandlerFunc(s.beginAccountDeletion)))).Methods("POST")
+
+	r.Handle("/me/export", s.rateLimit(emailRateLimit, s.auth(http.HandlerFunc(s.exportData)))).Methods("POST")
+	r.Handle("/me/export/{token}", s.auth(http.HandlerFunc(s.downloadExport))).Methods("GET")
+
+	r.Handle("/me/password", s.rateLimit(loginRateLimit, s.auth(http.HandlerFunc(s.changePassword)))).Methods("POST")
+	r.Handle("/me/email", s.rateLimit(emailRateLimit, s.auth(http.HandlerFunc(s.beginEmailChange)))).Methods("POST")
+	r.Handle("/me/email/confirm", s.rateLimit(verifyCodeRateLimit, s.auth(http.HandlerFunc(s.confirmEmailChange)))).Methods("POST")
+
+	r.Handle("/me/sessions", s.auth(http.HandlerFunc(s.listSessions))).Methods("GET")
+	r.Handle("/me/sessions", s.auth(http.HandlerFunc(s.revokeAllSessions))).Methods("DELETE")
+	r.Handle("/me/sessions/{id}", s.auth(http.HandlerFunc(s.revokeSession))).Methods("DELETE")
+
+	r.Handle("/me/passkeys", s.auth(http.HandlerFunc(s.listWebAuthnCredentials))).Methods("GET")
+	r.Handle("/me/passkeys/{id}", s.auth(http.HandlerFunc(s.deleteWebAuthnCredential))).Methods("DELETE")
+
+	r.Handle("/me/identities", s.auth(http.HandlerFunc(s.listIdentities))).Methods("GET")
+	r.Handle("/me/identities/{provider}", s.auth(http.HandlerFunc(s.linkIdentity))).Methods("POST")
+	r.Handle("/me/identities/{provider}", s.auth(http.HandlerFunc(s.unlinkIdentity))).Methods("DELETE")
+
+	r.Handle("/me/mfa/totp", s.auth(http.HandlerFunc(s.beginTOTPEnrollment))).Methods("POST")
+	r.Handle("/me/mfa/totp/confirm", s.auth(http.HandlerFunc(s.confirmTOTPEnrollment))).Methods("POST")
+	r.Handle("/me/mfa/totp/disable", s.auth(http.HandlerFunc(s.disableTOTP))).Methods("POST")
+	r.Handle("/me/mfa/recovery-codes", s.auth(http.HandlerFunc(s.regenerateRecoveryCodes))).Methods("POST")
+
+	r.Handle("/users/{username}", s.optionalAuth(http.HandlerFunc(s.getProfile))).Methods("GET")
+	r.Handle("/users/{username}/follow", s.auth(http.HandlerFunc(s.follow))).Methods("POST")
+	r.Handle("/users/{username}/follow", s.auth(http.HandlerFunc(s.unfollow))).Methods("DELETE")
+
+	r.Handle("/sightings", s.optionalAuth(http.HandlerFunc(s.listSightings))).Methods("GET")
+	r.Handle("/sightings", s.auth(http.HandlerFunc(s.createSighting))).Methods("POST")
+	r.Handle("/sightings/stream", s.optionalAuth(http.HandlerFunc(s.streamSightings))).Methods("GET")
+	r.Handle("/sightings/ws", s.optionalAuth(http.HandlerFunc(s.streamSightingsSocket))).Methods("GET")
+	r.Handle("/sightings/{id}", s.optionalAuth(http.HandlerFunc(s.getSighting))).Methods("GET")
+	r.Handle("/sightings/{id}", s.auth(http.HandlerFunc(s.deleteSighting))).Methods("DELETE")
+
+	r.Handle("/sightings/{id}/confirmations", s.auth(http.HandlerFunc(s.confirmSighting))).Methods("POST")
+	r.Handle("/sightings/{id}/confirmations", s.auth(http.HandlerFunc(s.unconfirmSighting))).Methods("DELETE")
+
+	r.Handle("/sightings/{id}/comments", s.optionalAuth(http.HandlerFunc(s.listComments))).Methods("GET")
+	r.Handle("/sightings/{id}/comments", s.rateLimit(commentRateLimit, s.auth(http.HandlerFunc(s.createComment)))).Methods("POST")
+	r.Handle("/comments/{id:[0-9]+}", s.auth(http.HandlerFunc(s.updateComment))).Methods("PATCH")
+	r.Handle("/comments/{id:[0-9]+}", s.auth(http.HandlerFunc(s.deleteComment))).Methods("DELETE")
+
+	r.Handle("/moderation/comments", s.auth(http.HandlerFunc(s.listHeldComments))).Methods("GET")
+	r.Handle("/moderation/comments/{id:[0-9]+}", s.auth(http.HandlerFunc(s.moderateComment))).Methods("PATCH")
+
+	r.Handle("/organizations", s.auth(http.HandlerFunc(s.createOrganization))).Methods("POST")
+	r.Handle("/me/organizations", s.auth(http.HandlerFunc(s.listOrganizations))).Methods("GET")
+	r.Handle("/organizations/{id:[0-9]+}", s.auth(http.HandlerFunc(s.getOrganization))).Methods("GET")
+	r.Handle("/organizations/{id:[0-9]+}", s.auth(http.HandlerFunc(s.deleteOrganization))).Methods("DELETE")
+	r.Handle("/organizations/{id:[0-9]+}/invites", s.rateLimit(emailRateLimit, s.auth(http.HandlerFunc(s.inviteMember)))).Methods("POST")
+	r.Handle("/organizations/{id:[0-9]+}/members/{userId}", s.auth(http.HandlerFunc(s.updateMember))).Methods("PATCH")
+	r.Handle("/organizations/{id:[0-9]+}/members/{userId}", s.auth(http.HandlerFunc(s.removeMember))).Methods("DELETE")
+	r.Handle("/invites/accept", s.auth(http.HandlerFunc(s.acceptInvite))).Methods("POST")
+
+	r.Handle("/me/alert-areas", s.auth(http.HandlerFunc(s.listAlertAreas))).Methods("GET")
+	r.Handle("/me/alert-areas", s.auth(http.HandlerFunc(s.createAlertArea))).Methods("POST")
+	r.Handle("/me/alert-areas/{id:[0-9]+}", s.auth(http.HandlerFunc(s.deleteAlertArea))).Methods("DELETE")
+	r.Handle("/me/notification-preferences", s.auth(http.HandlerFunc(s.getNotificationPreferences))).Methods("GET")
+	r.Handle("/me/notification-preferences", s.auth(http.HandlerFunc(s.updateNotificationPreferences))).Methods("PUT")
+	r.Handle("/me/push-devices", s.auth(http.HandlerFunc(s.registerPushDevice))).Methods("POST")
+	r.Handle("/me/push-devices/{token}", s.auth(http.HandlerFunc(s.unregisterPushDevice))).Methods("DELETE")
+	r.Handle("/me/notifications", s.auth(http.HandlerFunc(s.listNotifications))).Methods("GET")
+	r.Handle("/me/notifications/{id:[0-9]+}/read", s.auth(http.HandlerFunc(s.markNotificationRead))).Methods("POST")
 	return
 }
 
@@ -69,44 +176,60 @@ func (s *Server) errorResponse(w http.ResponseWriter, status int, message string
 	json.NewEncoder(w).Encode(message)
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("Access-Control-Allow-Origin", "*")
-		w.Header().Add("Access-Control-Allow-Credentials", "true")
-		w.Header().Add("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		w.Header().Add("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-
-		if r.Method == "OPTIONS" {
-			http.Error(w, "No Content", http.StatusNoContent)
-			return
-		}
+// auth accepts either an Authorization header, for apps, or the HttpOnly access token
+// cookie, for the browser. Browsers attach cookies to cross-site requests on their own,
+// so cookie authenticated requests that change state must also pass the CSRF check.
+func (s *Server) auth(next http.Handler) http.Handler {
+	return s.authenticate(next, true)
+}
 
-		next.ServeHTTP(w, r)
-	})
+// optionalAuth identifies the caller when they sent credentials and lets anonymous
+// requests through. Invalid credentials are still rejected, so clients know to refresh.
+func (s *Server) optionalAuth(next http.Handler) http.Handler {
+	return s.authenticate(next, false)
 }
 
-func (s *Server) auth(next http.Handler) http.Handler {
+func (s *Server) authenticate(next http.Handler, required bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-		if header == "" {
-			s.errorResponse(w, http.StatusUnauthorized, "Authorization header required")
+		var token string
+
+		if header := r.Header.Get("Authorization"); header != "" {
+			parts := strings.Split(header, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				s.errorResponse(w, http.StatusUnauthorized, "Invalid authorization header")
+				return
+			}
+
+			token = parts[1]
+		} else if cookie, err := r.Cookie(accessTokenCookie); err == nil && cookie.Value != "" {
+			if !validCSRFToken(r) {
+				s.errorResponse(w, http.StatusForbidden, "Invalid CSRF token")
+				return
+			}
+
+			token = cookie.Value
+		} else if !required {
+			next.ServeHTTP(w, r)
 			return
-		}
-
-		parts := strings.Split(header, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			s.errorResponse(w, http.StatusUnauthorized, "Invalid authorization header")
+		} else {
+			s.errorResponse(w, http.StatusUnauthorized, "Authorization header required")
 			return
 		}
 
-		token := parts[1]
-		_, err := s.authService.VerifyToken(token)
+		identity, err := s.authService.Authenticate(token)
 		if err != nil {
 			s.logger.Error().Msg(err.Error())
 			s.errorResponse(w, http.StatusUnauthorized, "Error verifying token")
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		ctx := context.WithValue(r.Context(), identityContextKey, identity)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// identityFromContext returns the caller stored by the auth middleware.
+func identityFromContext(ctx context.Context) domain.Identity {
+	identity, _ := ctx.Value(identityContextKey).(domain.Identity)
+	return identity
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/papacatzzi-server/domain"
+)
+
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"deviceName"`
+	IPAddress  string    `json:"ipAddress"`
+	UserAgent  string    `json:"userAgent"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	Current    bool      `json:"current"`
+}
+
+func (s *Server) listSessions(w http.ResponseWriter, r *http.Request) {
+	identity := identityFromContext(r.Context())
+
+	sessions, err := s.authService.ListSessions(identity.UserID)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to list sessions")
+		s.errorResponse(w, http.StatusInternalServerError, "Error listing sessions")
+		return
+	}
+
+	res := make([]sessionResponse, 0)
+	for _, session := range sessions {
+		res = append(res, sessionResponse{
+			ID:         session.ID,
+			DeviceName: session.DeviceName,
+			IPAddress:  session.IPAddress,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			Current:    session.ID == identity.SessionID,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) revokeSession(w http.ResponseWriter, r *http.Request) {
+	identity := identityFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	err := s.authService.RevokeSession(identity.UserID, id)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to revoke session")
+		switch {
+		case errors.Is(err, domain.ErrSessionNotFound):
+			s.errorResponse(w, http.StatusNotFound, "Session not found")
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error revoking session")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) revokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	identity := identityFromContext(r.Context())
+
+	err := s.authService.RevokeAllSessions(identity.UserID)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to revoke sessions")
+		s.errorResponse(w, http.StatusInternalServerError, "Error revoking sessions")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clientSession describes the device a request comes from.
+func clientSession(r *http.Request, deviceName string) domain.Session {
+	return domain.Session{
+		DeviceName: deviceName,
+		IPAddress:  clientIP(r),
+		UserAgent:  r.UserAgent(),
+	}
+}
+
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
@@ -2,7 +2,10 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -12,40 +15,63 @@ import (
 )
 
 type coordinates struct {
-	ID        int       `json:"id"`
-	Latitude  float64   `json:"latitude"`
-	Longitude float64   `json:"longitude"`
-	Timestamp time.Time `json:"timestamp"`
+	ID         int       `json:"id"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	Timestamp  time.Time `json:"timestamp"`
+	Confidence float64   `json:"confidence"`
 }
 
-func (s *Server) listSightings(w http.ResponseWriter, r *http.Request) {
-	queryParams := r.URL.Query()
+func newCoordinates(s domain.Sighting) coordinates {
+	return coordinates{
+		ID:         s.ID,
+		Latitude:   s.Latitude,
+		Longitude:  s.Longitude,
+		Timestamp:  s.Timestamp,
+		Confidence: s.Confidence,
+	}
+}
 
-	minLng, err := strconv.ParseFloat(queryParams.Get("minLng"), 64)
-	if err != nil {
-		s.errorResponse(w, http.StatusBadRequest, "Invalid or missing minLat")
-		return
+// parseSightingFilter reads the bounding box, and optional minimum confidence, of the
+// map a client is looking at.
+func parseSightingFilter(queryParams url.Values) (filter domain.SightingFilter, err error) {
+	params := []struct {
+		name  string
+		value *float64
+	}{
+		{"minLng", &filter.MinLng},
+		{"minLat", &filter.MinLat},
+		{"maxLng", &filter.MaxLng},
+		{"maxLat", &filter.MaxLat},
 	}
 
-	minLat, err := strconv.ParseFloat(queryParams.Get("minLat"), 64)
-	if err != nil {
-		s.errorResponse(w, http.StatusBadRequest, "Invalid or missing minLat")
-		return
+	for _, p := range params {
+		*p.value, err = strconv.ParseFloat(queryParams.Get(p.name), 64)
+		if err != nil {
+			err = fmt.Errorf("Invalid or missing %s", p.name)
+			return
+		}
 	}
 
-	maxLng, err := strconv.ParseFloat(queryParams.Get("maxLng"), 64)
-	if err != nil {
-		s.errorResponse(w, http.StatusBadRequest, "Invalid or missing maxLng")
-		return
+	if param := queryParams.Get("minConfidence"); param != "" {
+		filter.MinConfidence, err = strconv.ParseFloat(param, 64)
+		if err != nil || filter.MinConfidence < 0 || filter.MinConfidence > 1 {
+			err = errors.New("Invalid minConfidence, must be between 0 and 1")
+			return
+		}
 	}
 
-	maxLat, err := strconv.ParseFloat(queryParams.Get("maxLat"), 64)
+	return
+}
+
+func (s *Server) listSightings(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseSightingFilter(r.URL.Query())
 	if err != nil {
-		s.errorResponse(w, http.StatusBadRequest, "Invalid or missing maxLat")
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	sightings, err := s.sightingService.List(minLng, minLat, maxLng, maxLat)
+	sightings, err := s.sightingService.List(identityFromContext(r.Context()), filter)
 	if err != nil {
 		s.logger.Error().Err(err).Msg("failed to fetch coordinates from db")
 		s.errorResponse(w, http.StatusNotFound, "Sightings not found at specified coordinates")
@@ -54,12 +80,7 @@ func (s *Server) listSightings(w http.ResponseWriter, r *http.Request) {
 
 	coords := make([]coordinates, 0)
 	for _, s := range sightings {
-		coords = append(coords, coordinates{
-			ID:        s.ID,
-			Latitude:  s.Latitude,
-			Longitude: s.Longitude,
-			Timestamp: s.Timestamp,
-		})
+		coords = append(coords, newCoordinates(s))
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -71,17 +92,28 @@ type sightingDetailsResponse struct {
 	Description string    `json:"description"`
 	PhotoURL    string    `json:"photoURL"`
 	Reporter    string    `json:"reporter"`
+	Visibility  string    `json:"visibility"`
 	Timestamp   time.Time `json:"timestamp"`
+
+	OrganizationID    *int    `json:"organizationId,omitempty"`
+	CommentCount      int     `json:"commentCount"`
+	Confidence        float64 `json:"confidence"`
+	ConfirmationCount int     `json:"confirmationCount"`
 }
 
 func (s *Server) getSighting(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	sighting, err := s.sightingService.GetByID(id)
+	sighting, err := s.sightingService.GetByID(identityFromContext(r.Context()), id)
 	if err != nil {
 		s.logger.Error().Err(err).Msg("failed to fetch sighting from db")
-		s.errorResponse(w, http.StatusNotFound, "Sighting not found by ID")
+		switch {
+		case errors.Is(err, domain.ErrSightingNotFound):
+			s.errorResponse(w, http.StatusNotFound, "Sighting not found by ID")
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error fetching sighting")
+		}
 		return
 	}
 
@@ -90,7 +122,13 @@ func (s *Server) getSighting(w http.ResponseWriter, r *http.Request) {
 		Description: sighting.Description,
 		PhotoURL:    sighting.PhotoURL,
 		Reporter:    sighting.Reporter,
+		Visibility:  string(sighting.Visibility),
 		Timestamp:   sighting.Timestamp,
+
+		OrganizationID:    sighting.OrganizationID,
+		CommentCount:      sighting.CommentCount,
+		Confidence:        sighting.Confidence,
+		ConfirmationCount: sighting.ConfirmationCount,
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -101,15 +139,18 @@ type createSightingRequest struct {
 	Animal      string    `json:"animal"`
 	Description string    `json:"description"`
 	PhotoURL    string    `json:"photoURL"`
-	Reporter    string    `json:"reporter"`
 	Latitude    float64   `json:"latitude"`
 	Longitude   float64   `json:"longitude"`
 	Timestamp   time.Time `json:"timestamp"`
+
+	Visibility     domain.Visibility `json:"visibility"`
+	OrganizationID *int              `json:"organizationId"`
+
+	// Precision defaults to the reporter's setting when left out.
+	Precision domain.LocationPrecision `json:"precision"`
 }
 
 func (csr createSightingRequest) Validate() (err error) {
-	// Leaving out reporter for now...
-	// Need to implement users/accounts
 	return validation.ValidateStruct(&csr,
 		validation.Field(&csr.Animal, validation.Required),
 		validation.Field(&csr.Description, validation.Required),
@@ -117,6 +158,9 @@ func (csr createSightingRequest) Validate() (err error) {
 		validation.Field(&csr.Latitude, validation.Required),
 		validation.Field(&csr.Longitude, validation.Required),
 		validation.Field(&csr.Timestamp, validation.Required),
+		validation.Field(&csr.Visibility, validation.In(domain.Visibilities...)),
+		validation.Field(&csr.OrganizationID, validation.When(csr.Visibility == domain.VisibilityOrganization, validation.Required)),
+		validation.Field(&csr.Precision, validation.In(domain.LocationPrecisions...)),
 	)
 }
 
@@ -135,21 +179,46 @@ func (s *Server) createSighting(w http.ResponseWriter, r *http.Request) {
 	}
 
 	newSighting := domain.Sighting{
-		Animal:      csr.Animal,
-		Description: csr.Description,
-		PhotoURL:    csr.PhotoURL,
-		Reporter:    csr.Reporter,
-		Latitude:    csr.Latitude,
-		Longitude:   csr.Longitude,
-		Timestamp:   csr.Timestamp,
+		Animal:         csr.Animal,
+		Description:    csr.Description,
+		PhotoURL:       csr.PhotoURL,
+		Latitude:       csr.Latitude,
+		Longitude:      csr.Longitude,
+		Timestamp:      csr.Timestamp,
+		Visibility:     csr.Visibility,
+		OrganizationID: csr.OrganizationID,
+		Precision:      csr.Precision,
 	}
 
-	err := s.sightingService.Create(newSighting)
+	err := s.sightingService.Create(identityFromContext(r.Context()), newSighting)
 	if err != nil {
 		s.logger.Error().Err(err).Msg("failed to insert sighting")
-		s.errorResponse(w, http.StatusInternalServerError, "Error creating sighting")
+		switch {
+		case errors.Is(err, domain.ErrOrganizationNotFound):
+			s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error creating sighting")
+		}
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func (s *Server) deleteSighting(w http.ResponseWriter, r *http.Request) {
+	err := s.sightingService.Delete(identityFromContext(r.Context()), mux.Vars(r)["id"])
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrSightingNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, domain.ErrSightingForbidden):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error deleting sighting")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,223 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gorilla/websocket"
+	"github.com/papacatzzi-server/domain"
+)
+
+const (
+	// heartbeatInterval keeps idle streams from being cut by proxies, which commonly
+	// drop connections that stay silent for a minute.
+	heartbeatInterval = 25 * time.Second
+
+	// websocketPongWait is how long a socket may go without answering a ping.
+	websocketPongWait = 2 * heartbeatInterval
+
+	websocketWriteWait    = 10 * time.Second
+	websocketMessageLimit = 1024
+)
+
+// sightingEventResponse is one change on the map. Deleted sightings only carry their ID.
+type sightingEventResponse struct {
+	Type domain.SightingEventType `json:"type"`
+	ID   int                      `json:"id"`
+	*coordinates
+}
+
+func newSightingEventResponse(event domain.SightingEvent) (res sightingEventResponse) {
+	res = sightingEventResponse{Type: event.Type, ID: event.Sighting.ID}
+
+	if event.Type != domain.SightingDeleted {
+		coords := newCoordinates(event.Sighting)
+		res.coordinates = &coords
+	}
+
+	return
+}
+
+// streamSightings sends changes to the sightings inside the requested bounding box as
+// Server-Sent Events, for as long as the client stays connected.
+func (s *Server) streamSightings(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseSightingFilter(r.URL.Query())
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err = rc.Flush(); err != nil {
+		s.logger.Error().Err(err).Msg("failed to start sighting stream")
+		return
+	}
+
+	ctx := r.Context()
+	events := s.sightingService.Stream(ctx, identityFromContext(ctx), filter, nil)
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-heartbeat.C:
+			if _, err = fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(newSightingEventResponse(event))
+			if err != nil {
+				s.logger.Error().Err(err).Msg("failed to encode sighting event")
+				continue
+			}
+
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+		}
+
+		if err = rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+type sightingFilterMessage struct {
+	MinLng        float64 `json:"minLng"`
+	MinLat        float64 `json:"minLat"`
+	MaxLng        float64 `json:"maxLng"`
+	MaxLat        float64 `json:"maxLat"`
+	MinConfidence float64 `json:"minConfidence"`
+}
+
+func (msg sightingFilterMessage) Validate() (err error) {
+	return validation.ValidateStruct(&msg,
+		validation.Field(&msg.MinLng, validation.Min(-180.0), validation.Max(180.0)),
+		validation.Field(&msg.MinLat, validation.Min(-90.0), validation.Max(90.0)),
+		validation.Field(&msg.MaxLng, validation.Min(-180.0), validation.Max(180.0)),
+		validation.Field(&msg.MaxLat, validation.Min(-90.0), validation.Max(90.0)),
+		validation.Field(&msg.MinConfidence, validation.Min(0.0), validation.Max(1.0)),
+	)
+}
+
+// checkWebSocketOrigin stands in for CORS, which browsers don't apply to WebSockets.
+// Without it any site could open a socket carrying the user's access token cookie.
+func (s *Server) checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if u, err := url.Parse(origin); err == nil && u.Host == r.Host {
+		return true
+	}
+
+	allowed, wildcard := s.config.CORS.allowOrigin(origin)
+	if !wildcard {
+		return allowed
+	}
+
+	// a wildcard only ever covers anonymous requests, just like it does for CORS
+	_, err := r.Cookie(accessTokenCookie)
+	return err != nil
+}
+
+// streamSightingsSocket is streamSightings over a WebSocket, for clients that would
+// rather not reconnect every time the map moves. They send a new bounding box instead.
+func (s *Server) streamSightingsSocket(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseSightingFilter(r.URL.Query())
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	upgrader := websocket.Upgrader{CheckOrigin: s.checkWebSocketOrigin}
+
+	// the upgrader writes its own error response
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to upgrade sighting stream")
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	filters := make(chan domain.SightingFilter)
+	events := s.sightingService.Stream(ctx, identityFromContext(ctx), filter, filters)
+
+	go func() {
+		defer cancel()
+
+		conn.SetReadLimit(websocketMessageLimit)
+		conn.SetReadDeadline(time.Now().Add(websocketPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(websocketPongWait))
+		})
+
+		for {
+			var msg sightingFilterMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+
+			// a bad filter is the client's mistake, the stream carries on with the last good one
+			if err := msg.Validate(); err != nil {
+				continue
+			}
+
+			select {
+			case filters <- domain.SightingFilter(msg):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(websocketWriteWait))
+			return
+
+		case <-heartbeat.C:
+			if err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(websocketWriteWait)); err != nil {
+				return
+			}
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(websocketWriteWait))
+			if err = conn.WriteJSON(newSightingEventResponse(event)); err != nil {
+				return
+			}
+		}
+	}
+}
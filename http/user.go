@@ -0,0 +1,187 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/gorilla/mux"
+	"github.com/papacatzzi-server/domain"
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+type meResponse struct {
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	DisplayName string    `json:"displayName"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatarURL"`
+	HomeArea    string    `json:"homeArea"`
+	MFAEnabled  bool      `json:"mfaEnabled"`
+	CreatedAt   time.Time `json:"createdAt"`
+
+	LocationPrecision domain.LocationPrecision `json:"locationPrecision"`
+}
+
+func newMeResponse(user domain.User) meResponse {
+	return meResponse{
+		ID:          user.ID.String(),
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+		HomeArea:    user.HomeArea,
+		MFAEnabled:  user.TOTPEnabled,
+		CreatedAt:   user.CreatedAt,
+
+		LocationPrecision: user.LocationPrecision,
+	}
+}
+
+func (s *Server) getMe(w http.ResponseWriter, r *http.Request) {
+	user, err := s.userService.GetMe(identityFromContext(r.Context()))
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrUserAccountNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error fetching profile")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newMeResponse(user))
+}
+
+type updateMeRequest struct {
+	Username    *string `json:"username"`
+	DisplayName *string `json:"displayName"`
+	Bio         *string `json:"bio"`
+	AvatarURL   *string `json:"avatarURL"`
+	HomeArea    *string `json:"homeArea"`
+
+	LocationPrecision *domain.LocationPrecision `json:"locationPrecision"`
+}
+
+func (req updateMeRequest) Validate() (err error) {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Username, validation.NilOrNotEmpty, validation.Length(3, 30), validation.Match(usernamePattern)),
+		validation.Field(&req.DisplayName, validation.Length(0, 50)),
+		validation.Field(&req.Bio, validation.Length(0, 500)),
+		validation.Field(&req.AvatarURL, is.URL),
+		validation.Field(&req.HomeArea, validation.Length(0, 100)),
+		validation.Field(&req.LocationPrecision, validation.NilOrNotEmpty, validation.In(domain.LocationPrecisions...)),
+	)
+}
+
+func (s *Server) updateMe(w http.ResponseWriter, r *http.Request) {
+	var req updateMeRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	update := domain.ProfileUpdate{
+		Username:    req.Username,
+		DisplayName: req.DisplayName,
+		Bio:         req.Bio,
+		AvatarURL:   req.AvatarURL,
+		HomeArea:    req.HomeArea,
+
+		LocationPrecision: req.LocationPrecision,
+	}
+
+	user, err := s.userService.UpdateMe(identityFromContext(r.Context()), update)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrUsernameExists):
+			s.errorResponse(w, http.StatusConflict, err.Error())
+		case errors.Is(err, domain.ErrUserAccountNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error updating profile")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newMeResponse(user))
+}
+
+type profileResponse struct {
+	Username    string                    `json:"username"`
+	DisplayName string                    `json:"displayName"`
+	Bio         string                    `json:"bio"`
+	AvatarURL   string                    `json:"avatarURL"`
+	HomeArea    string                    `json:"homeArea"`
+	CreatedAt   time.Time                 `json:"createdAt"`
+	Sightings   []profileSightingResponse `json:"sightings"`
+}
+
+type profileSightingResponse struct {
+	ID          int       `json:"id"`
+	Animal      string    `json:"animal"`
+	Description string    `json:"description"`
+	PhotoURL    string    `json:"photoURL"`
+	Latitude    float64   `json:"latitude"`
+	Longitude   float64   `json:"longitude"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+func (s *Server) getProfile(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	user, sightings, err := s.userService.GetProfile(identityFromContext(r.Context()), username)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrUserAccountNotFound):
+			s.errorResponse(w, http.StatusNotFound, "User not found")
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error fetching profile")
+		}
+		return
+	}
+
+	res := profileResponse{
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+		HomeArea:    user.HomeArea,
+		CreatedAt:   user.CreatedAt,
+		Sightings:   make([]profileSightingResponse, 0),
+	}
+
+	for _, sighting := range sightings {
+		res.Sightings = append(res.Sightings, profileSightingResponse{
+			ID:          sighting.ID,
+			Animal:      sighting.Animal,
+			Description: sighting.Description,
+			PhotoURL:    sighting.PhotoURL,
+			Latitude:    sighting.Latitude,
+			Longitude:   sighting.Longitude,
+			Timestamp:   sighting.Timestamp,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,38 @@
+package http
+
+import "testing"
+
+func TestUpdateMeRequestValidate(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name  string
+		req   updateMeRequest
+		valid bool
+	}{
+		{name: "nothing to change", req: updateMeRequest{}, valid: true},
+		{name: "username", req: updateMeRequest{Username: str("tabby_cat_42")}, valid: true},
+		{name: "empty username", req: updateMeRequest{Username: str("")}},
+		{name: "short username", req: updateMeRequest{Username: str("ab")}},
+		{name: "long username", req: updateMeRequest{Username: str("abcdefghijklmnopqrstuvwxyz12345")}},
+		{name: "username with spaces", req: updateMeRequest{Username: str("tabby cat")}},
+		{name: "username with symbols", req: updateMeRequest{Username: str("tabby@cat")}},
+		{name: "clearing the bio", req: updateMeRequest{Bio: str("")}, valid: true},
+		{name: "long display name", req: updateMeRequest{DisplayName: str(string(make([]byte, 51)))}},
+		{name: "avatar url", req: updateMeRequest{AvatarURL: str("https://cdn.example.com/cat.png")}, valid: true},
+		{name: "avatar that isn't a url", req: updateMeRequest{AvatarURL: str("not a url")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("Validate() error = %v, want nil", err)
+			}
+
+			if !tt.valid && err == nil {
+				t.Error("Validate() accepted an invalid request")
+			}
+		})
+	}
+}
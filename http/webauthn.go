@@ -0,0 +1,155 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/gorilla/mux"
+	"github.com/papacatzzi-server/domain"
+)
+
+func (s *Server) beginWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	identity := identityFromContext(r.Context())
+
+	options, err := s.authService.BeginWebAuthnRegistration(identity)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "failed to begin passkey registration")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(options)
+}
+
+// finishWebAuthnRegistration takes the browser's credential as the body and an
+// optional ?name= so users can tell their passkeys apart.
+func (s *Server) finishWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	response, err := protocol.ParseCredentialCreationResponseBody(r.Body)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	identity := identityFromContext(r.Context())
+	name := r.URL.Query().Get("name")
+
+	err = s.authService.FinishWebAuthnRegistration(identity, name, response)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrPasskeyVerification):
+			s.errorResponse(w, http.StatusBadRequest, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "failed to register passkey")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) beginWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	options, err := s.authService.BeginWebAuthnLogin()
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "failed to begin passkey login")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(options)
+}
+
+func (s *Server) finishWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	response, err := protocol.ParseCredentialRequestResponseBody(r.Body)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to parse request")
+		s.errorResponse(w, http.StatusBadRequest, "Error parsing request")
+		return
+	}
+
+	accessToken, refreshToken, err := s.authService.FinishWebAuthnLogin(response, clientSession(r, r.URL.Query().Get("device")))
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrPasskeyVerification):
+			s.errorResponse(w, http.StatusUnauthorized, "Passkey could not be verified")
+		case errors.Is(err, domain.ErrAccountDeleted):
+			s.errorResponse(w, http.StatusForbidden, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Failed to process log in")
+		}
+		return
+	}
+
+	s.setAuthCookies(w, accessToken, refreshToken)
+
+	res := loginResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+type passkeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+func (s *Server) listWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	identity := identityFromContext(r.Context())
+
+	credentials, err := s.authService.ListWebAuthnCredentials(identity)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		s.errorResponse(w, http.StatusInternalServerError, "Error listing passkeys")
+		return
+	}
+
+	res := make([]passkeyResponse, 0)
+	for _, c := range credentials {
+		res = append(res, passkeyResponse{
+			ID:         base64.RawURLEncoding.EncodeToString(c.Credential.ID),
+			Name:       c.Name,
+			CreatedAt:  c.CreatedAt,
+			LastUsedAt: c.LastUsedAt,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) deleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	id, err := base64.RawURLEncoding.DecodeString(mux.Vars(r)["id"])
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid passkey ID")
+		return
+	}
+
+	identity := identityFromContext(r.Context())
+
+	err = s.authService.DeleteWebAuthnCredential(identity, id)
+	if err != nil {
+		s.logger.Error().Msg(err.Error())
+		switch {
+		case errors.Is(err, domain.ErrPasskeyNotFound):
+			s.errorResponse(w, http.StatusNotFound, err.Error())
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Error deleting passkey")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
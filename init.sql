@@ -1,4 +1,11 @@
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+CREATE TABLE organizations (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
 
 CREATE TABLE sightings (
     id SERIAL PRIMARY KEY,
@@ -8,19 +15,190 @@ CREATE TABLE sightings (
     description TEXT,
     latitude FLOAT NOT NULL,
     longitude FLOAT NOT NULL,
+    organization_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL,
+    visibility TEXT NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'followers', 'organization', 'private')),
+    -- NULL falls back to the reporter's default
+    location_precision TEXT CHECK (location_precision IN ('exact', '100m', '1km', 'hidden')),
+    confidence REAL NOT NULL DEFAULT 0,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE TABLE users (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    oauth_id TEXT,
     username TEXT NOT NULL,
     email TEXT NOT NULL,
     password TEXT,
+    role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'partner')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    is_active BOOLEAN DEFAULT FALSE,
+    deleted_at TIMESTAMP,
+    display_name TEXT NOT NULL DEFAULT '',
+    bio TEXT NOT NULL DEFAULT '',
+    avatar_url TEXT NOT NULL DEFAULT '',
+    home_area TEXT NOT NULL DEFAULT '',
+    location_precision TEXT NOT NULL DEFAULT 'exact' CHECK (location_precision IN ('exact', '100m', '1km', 'hidden')),
+    totp_secret TEXT NOT NULL DEFAULT '',
+    totp_enabled BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+-- emails and usernames are unique regardless of case, OAuth users may have no email
+CREATE UNIQUE INDEX users_email_lower_key ON users (lower(email)) WHERE email <> '';
+CREATE UNIQUE INDEX users_username_lower_key ON users (lower(username));
+
+CREATE TABLE user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    provider_user_id TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, provider_user_id),
+    UNIQUE (user_id, provider)
+);
+
+CREATE TABLE recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE webauthn_credentials (
+    id BYTEA PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL DEFAULT '',
+    credential JSONB NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    is_active BOOLEAN DEFAULT FALSE
+    last_used_at TIMESTAMP
+);
+
+CREATE INDEX idx_webauthn_credentials_user_id ON webauthn_credentials (user_id);
+
+CREATE TABLE audit_events (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    session_id TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE INDEX idx_audit_events_user_id ON audit_events (user_id, created_at DESC);
+
+CREATE INDEX idx_sightings_user_id ON sightings (user_id, created_at DESC);
+
+CREATE TABLE organization_members (
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'coordinator', 'volunteer')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX idx_organization_members_user_id ON organization_members (user_id);
+
+CREATE INDEX idx_sightings_organization_id ON sightings (organization_id);
+
+CREATE TABLE sighting_confirmations (
+    sighting_id INTEGER NOT NULL REFERENCES sightings(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    photo_url TEXT NOT NULL DEFAULT '',
+    latitude FLOAT,
+    longitude FLOAT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (sighting_id, user_id)
+);
+
+CREATE INDEX idx_sightings_confidence ON sightings (confidence);
+
+CREATE TABLE comments (
+    id SERIAL PRIMARY KEY,
+    sighting_id INTEGER NOT NULL REFERENCES sightings(id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    -- NULL once the author is purged, the comment stays to keep threads intact
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'visible' CHECK (status IN ('visible', 'held', 'hidden')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    edited_at TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE INDEX idx_comments_sighting_id ON comments (sighting_id, created_at);
+CREATE INDEX idx_comments_status ON comments (status) WHERE status = 'held';
+
+CREATE TABLE comment_mentions (
+    comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (comment_id, user_id)
+);
+
+CREATE TABLE follows (
+    follower_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX idx_follows_followee_id ON follows (followee_id);
+
+-- Areas are polygons, or points notifying within radius_meters of them. ST_DWithin
+-- with a radius of 0 is an intersection test, so both match the same way.
+CREATE TABLE alert_areas (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    area GEOGRAPHY NOT NULL,
+    radius_meters FLOAT NOT NULL DEFAULT 0 CHECK (radius_meters >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_alert_areas_user_id ON alert_areas (user_id);
+CREATE INDEX idx_alert_areas_area ON alert_areas USING GIST (area);
+
+CREATE TABLE notification_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email BOOLEAN NOT NULL DEFAULT TRUE,
+    in_app BOOLEAN NOT NULL DEFAULT TRUE,
+    push BOOLEAN NOT NULL DEFAULT FALSE,
+    max_per_hour INTEGER NOT NULL DEFAULT 5 CHECK (max_per_hour >= 0),
+    quiet_start TIME,
+    quiet_end TIME,
+    time_zone TEXT NOT NULL DEFAULT 'UTC'
+);
+
+CREATE TABLE push_devices (
+    token TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_push_devices_user_id ON push_devices (user_id);
+
+-- Pending notifications are the delivery queue. A user hears about a sighting once per
+-- channel, however many of their areas it falls in.
+CREATE TABLE notifications (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    sighting_id INTEGER NOT NULL REFERENCES sightings(id) ON DELETE CASCADE,
+    area_id INTEGER REFERENCES alert_areas(id) ON DELETE SET NULL,
+    channel TEXT NOT NULL CHECK (channel IN ('email', 'in_app', 'push')),
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    deliver_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, sighting_id, channel)
+);
+
+CREATE INDEX idx_notifications_pending ON notifications (deliver_at) WHERE status = 'pending';
+CREATE INDEX idx_notifications_user_id ON notifications (user_id, channel, created_at DESC);
+
 -- Create a spatial index for efficient querying
 CREATE INDEX idx_sightings_coordinates ON sightings USING GIST (
     ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)
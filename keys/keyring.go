@@ -0,0 +1,224 @@
+// Package keys manages the asymmetric keys used to sign and verify JWTs.
+//
+// Keys are PKCS#8 PEM files (Ed25519 or RSA) in a single directory. The file
+// name without extension is the key ID and must start with the UTC date the
+// key becomes active, e.g. "2026-11-01.pem" or "2026-11-01-b.pem". A key is
+// published as soon as it is on disk, signs tokens from its activation date
+// until a newer key activates, and keeps verifying tokens for the retention
+// period after that so nothing it signed is cut off early.
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoSigningKey = errors.New("no active signing key")
+	ErrKeyNotFound  = errors.New("signing key not found")
+)
+
+type Key struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	ActiveFrom time.Time
+}
+
+func (k Key) PublicKey() crypto.PublicKey {
+	return k.PrivateKey.Public()
+}
+
+type KeyRing struct {
+	mu        sync.RWMutex
+	dir       string
+	retention time.Duration
+	keys      []Key
+}
+
+// NewKeyRing loads every key in dir. Retention should be at least the
+// lifetime of the longest lived token signed with these keys.
+func NewKeyRing(dir string, retention time.Duration) (kr *KeyRing, err error) {
+	kr = &KeyRing{dir: dir, retention: retention}
+	err = kr.Load()
+	return
+}
+
+// NewEphemeralKeyRing generates a single in-memory key. Tokens signed with it
+// do not survive a restart and are not shared between instances, so it is
+// only meant for local development.
+func NewEphemeralKeyRing() (kr *KeyRing, err error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+
+	kr = &KeyRing{
+		keys: []Key{{
+			ID:         "ephemeral-" + time.Now().UTC().Format("20060102150405"),
+			Method:     jwt.SigningMethodEdDSA,
+			PrivateKey: private,
+			ActiveFrom: time.Now(),
+		}},
+	}
+
+	return
+}
+
+// Load re-reads the key directory, replacing the keys held in memory.
+func (kr *KeyRing) Load() (err error) {
+	paths, err := filepath.Glob(filepath.Join(kr.dir, "*.pem"))
+	if err != nil {
+		return
+	}
+
+	var keys []Key
+	for _, path := range paths {
+		key, err := readKey(path)
+		if err != nil {
+			return fmt.Errorf("failed to read key %v: %v", path, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return fmt.Errorf("no keys found in %v", kr.dir)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ActiveFrom.Before(keys[j].ActiveFrom)
+	})
+
+	kr.mu.Lock()
+	kr.keys = keys
+	kr.mu.Unlock()
+
+	return
+}
+
+// Watch reloads the key directory on every tick so newly provisioned keys are
+// picked up without a restart. Reload errors keep the previous keys.
+func (kr *KeyRing) Watch(interval time.Duration, onError func(error)) {
+	if kr.dir == "" {
+		return
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			if err := kr.Load(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+}
+
+// SigningKey returns the most recently activated key.
+func (kr *KeyRing) SigningKey() (key Key, err error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	now := time.Now()
+	for i := len(kr.keys) - 1; i >= 0; i-- {
+		if !kr.keys[i].ActiveFrom.After(now) {
+			return kr.keys[i], nil
+		}
+	}
+
+	err = ErrNoSigningKey
+	return
+}
+
+// VerificationKey returns the key with the given ID as long as it is still
+// within its retention period.
+func (kr *KeyRing) VerificationKey(id string) (key Key, err error) {
+	for _, k := range kr.publishedKeys() {
+		if k.ID == id {
+			return k, nil
+		}
+	}
+
+	err = ErrKeyNotFound
+	return
+}
+
+// publishedKeys are all keys that are pending, active or retired less than
+// the retention period ago.
+func (kr *KeyRing) publishedKeys() (keys []Key) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	now := time.Now()
+	for i, k := range kr.keys {
+		// a key is retired once the next key has become active
+		if i+1 < len(kr.keys) {
+			retiredAt := kr.keys[i+1].ActiveFrom
+			if retiredAt.Before(now) && now.Sub(retiredAt) > kr.retention {
+				continue
+			}
+		}
+
+		keys = append(keys, k)
+	}
+
+	return
+}
+
+func readKey(path string) (key Key, err error) {
+	id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if len(id) < len("2006-01-02") {
+		err = fmt.Errorf("key id %q must start with its activation date", id)
+		return
+	}
+
+	activeFrom, err := time.Parse("2006-01-02", id[:len("2006-01-02")])
+	if err != nil {
+		err = fmt.Errorf("key id %q must start with its activation date: %v", id, err)
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		err = fmt.Errorf("no PEM data found")
+		return
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return
+	}
+
+	key = Key{ID: id, ActiveFrom: activeFrom}
+
+	switch private := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.PrivateKey = private
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+		key.PrivateKey = private
+	default:
+		err = fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return
+}
@@ -0,0 +1,174 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeKey(t *testing.T, dir string, id string, private crypto.Signer) {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err = os.WriteFile(filepath.Join(dir, id+".pem"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return private
+}
+
+func day(offset int) string {
+	return time.Now().UTC().AddDate(0, 0, offset).Format("2006-01-02")
+}
+
+// newTestKeyRing lays out a rotation: a key retired past retention, one retired
+// within it, the active key and one that is provisioned but not signing yet.
+func newTestKeyRing(t *testing.T) (kr *KeyRing, ids map[string]string) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	ids = map[string]string{
+		"expired":  day(-100),
+		"retired":  day(-50),
+		"active":   day(-1),
+		"upcoming": day(10) + "-rsa",
+	}
+
+	writeKey(t, dir, ids["expired"], newEd25519Key(t))
+	writeKey(t, dir, ids["retired"], newEd25519Key(t))
+	writeKey(t, dir, ids["active"], newEd25519Key(t))
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, ids["upcoming"], rsaKey)
+
+	kr, err = NewKeyRing(dir, 7*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+func TestSigningKey(t *testing.T) {
+	kr, ids := newTestKeyRing(t)
+
+	key, err := kr.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key.ID != ids["active"] {
+		t.Errorf("SigningKey() = %q, want %q", key.ID, ids["active"])
+	}
+}
+
+func TestVerificationKey(t *testing.T) {
+	kr, ids := newTestKeyRing(t)
+
+	tests := []struct {
+		key  string
+		want error
+	}{
+		{key: "expired", want: ErrKeyNotFound},
+		{key: "retired"},
+		{key: "active"},
+		{key: "upcoming"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			key, err := kr.VerificationKey(ids[tt.key])
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("VerificationKey() error = %v, want %v", err, tt.want)
+			}
+
+			if err == nil && key.ID != ids[tt.key] {
+				t.Errorf("VerificationKey() = %q, want %q", key.ID, ids[tt.key])
+			}
+		})
+	}
+
+	if _, err := kr.VerificationKey("2020-01-01-unknown"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unknown kid: error = %v, want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	kr, ids := newTestKeyRing(t)
+
+	set := kr.JWKS()
+
+	published := map[string]JWK{}
+	for _, jwk := range set.Keys {
+		published[jwk.KeyID] = jwk
+	}
+
+	if len(published) != 3 {
+		t.Errorf("JWKS() published %d keys, want 3", len(published))
+	}
+
+	if _, ok := published[ids["expired"]]; ok {
+		t.Error("JWKS() published a key past its retention")
+	}
+
+	active, err := kr.VerificationKey(ids["active"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk := published[ids["active"]]
+	x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+
+	if jwk.KeyType != "OKP" || jwk.Curve != "Ed25519" || jwk.Algorithm != "EdDSA" || jwk.Use != "sig" {
+		t.Errorf("Ed25519 key published as %+v", jwk)
+	}
+
+	if !active.PublicKey().(ed25519.PublicKey).Equal(ed25519.PublicKey(x)) {
+		t.Error("published x does not match the public key")
+	}
+
+	jwk = published[ids["upcoming"]]
+	if jwk.KeyType != "RSA" || jwk.Algorithm != "RS256" || jwk.N == "" || jwk.E != "AQAB" {
+		t.Errorf("RSA key published as %+v", jwk)
+	}
+
+	if jwk.X != "" || jwk.Curve != "" {
+		t.Errorf("RSA key published with Ed25519 fields %+v", jwk)
+	}
+}
+
+func TestLoadRejectsUndatedKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "current", newEd25519Key(t))
+
+	if _, err := NewKeyRing(dir, time.Hour); err == nil {
+		t.Error("NewKeyRing() accepted a key without an activation date")
+	}
+}
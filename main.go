@@ -1,15 +1,29 @@
 package main
 
 import (
+	"fmt"
+	nethttp "net/http"
 	"os"
+	"strings"
+	"time"
+	_ "time/tzdata"
 
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gorilla/sessions"
 	"github.com/markbates/goth"
+	"github.com/markbates/goth/gothic"
+	"github.com/markbates/goth/providers/apple"
+	"github.com/markbates/goth/providers/facebook"
+	"github.com/markbates/goth/providers/github"
 	"github.com/markbates/goth/providers/google"
 	database "github.com/papacatzzi-server/db"
 	"github.com/papacatzzi-server/email"
 	"github.com/papacatzzi-server/http"
+	"github.com/papacatzzi-server/keys"
 	"github.com/papacatzzi-server/log"
+	"github.com/papacatzzi-server/password"
 	"github.com/papacatzzi-server/postgres"
+	"github.com/papacatzzi-server/ratelimit"
 	"github.com/papacatzzi-server/service"
 	"github.com/redis/go-redis/v9"
 )
@@ -31,16 +45,263 @@ func main() {
 		DB:       0,
 	})
 
-	goth.UseProviders(
-		google.New(os.Getenv("GOOGLE_CLIENT_ID"), os.Getenv("GOOGLE_CLIENT_SECRET"), os.Getenv("GOOGLE_CLIENT_CALLBACK_URL")),
-	)
+	var keyRing *keys.KeyRing
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		keyRing, err = keys.NewKeyRing(dir, service.RefreshTokenExpiration)
+	} else {
+		logger.Warn().Msg("JWT_KEYS_DIR is not set, signing tokens with an ephemeral key")
+		keyRing, err = keys.NewEphemeralKeyRing()
+	}
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to load signing keys")
+		return
+	}
+
+	keyRing.Watch(time.Hour, func(err error) {
+		logger.Error().Err(err).Msg("failed to reload signing keys")
+	})
+
+	// passkeys are bound to the frontend's domain, default to the local dev server
+	rpID, rpOrigins := os.Getenv("WEBAUTHN_RP_ID"), os.Getenv("WEBAUTHN_RP_ORIGINS")
+	if rpID == "" {
+		rpID, rpOrigins = "localhost", "http://localhost:5173"
+	}
+
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: "Papacatzzi",
+		RPOrigins:     splitList(rpOrigins),
+	})
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to configure webauthn")
+		return
+	}
+
+	providers, err := oauthProviders()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to configure oauth providers")
+		return
+	}
+
+	goth.UseProviders(providers...)
+
+	config, err := serverConfig()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid server config")
+		return
+	}
 
 	sightingRepo := postgres.NewSightingRepository(db)
 	userRepo := postgres.NewUserRepository(db)
 
-	sightingService := service.NewSightingService(sightingRepo)
-	authService := service.NewAuthService(userRepo, rdb, mailer)
+	orgRepo := postgres.NewOrganizationRepository(db)
+	commentRepo := postgres.NewCommentRepository(db)
+	notificationRepo := postgres.NewNotificationRepository(db)
 
-	server := http.NewServer(logger, authService, sightingService)
+	var push service.PushSender
+	if url := os.Getenv("PUSH_GATEWAY_URL"); url != "" {
+		push = service.NewWebhookPushSender(url, os.Getenv("PUSH_GATEWAY_SECRET"), config.FrontendURL)
+	} else {
+		logger.Warn().Msg("PUSH_GATEWAY_URL is not set, alerts are only sent by email and in the app")
+	}
+
+	notificationService := service.NewNotificationService(notificationRepo, mailer, push, config.FrontendURL)
+
+	sightingService := service.NewSightingService(logger, sightingRepo, orgRepo, rdb, notificationService)
+	exportsDir := os.Getenv("EXPORTS_DIR")
+	if exportsDir == "" {
+		exportsDir = "exports"
+	}
+
+	userService := service.NewUserService(logger, userRepo, sightingRepo, orgRepo, commentRepo, notificationRepo, rdb, mailer, exportsDir, config.FrontendURL)
+	passwordPolicy := password.Policy{MinScore: 3}
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		passwordPolicy.Breached, err = password.NewBreachedList(dir)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to open breached password list")
+			return
+		}
+	} else {
+		logger.Warn().Msg("BREACHED_PASSWORDS_DIR is not set, new passwords are not checked against known breaches")
+	}
+
+	hasher := password.NewArgon2idHasher(password.DefaultArgon2idParams)
+
+	authService := service.NewAuthService(logger, userRepo, rdb, mailer, keyRing, webAuthn, hasher, passwordPolicy, config.FrontendURL)
+	orgService := service.NewOrganizationService(orgRepo, userRepo, rdb, mailer, config.FrontendURL)
+	commentService := service.NewCommentService(commentRepo, sightingRepo, userRepo, service.HoldLinks(2))
+
+	go purgeExpiredData(logger, authService, userService)
+	go deliverNotifications(logger, notificationService)
+
+	limiter := ratelimit.NewLimiter(rdb)
+
+	// gothic keeps the provider handshake in its own cookie, apple posts its callback
+	// cross-site so that cookie needs the same flags as ours
+	store := sessions.NewCookieStore([]byte(os.Getenv("SESSION_SECRET")))
+	store.Options = &sessions.Options{
+		Path:     "/",
+		MaxAge:   int(service.OAuthStateExpiration.Seconds()),
+		HttpOnly: true,
+		Secure:   config.CookieSecure,
+		SameSite: config.CookieSameSite,
+	}
+	gothic.Store = store
+
+	server := http.NewServer(logger, config, limiter, authService, userService, sightingService, orgService, commentService, notificationService)
 	server.ListenAndServe()
 }
+
+// purgeExpiredData deletes accounts past their deletion grace period and data exports
+// past their download window, once an hour.
+func purgeExpiredData(logger log.Logger, authService service.AuthService, userService service.UserService) {
+	for range time.Tick(time.Hour) {
+		purged, err := authService.PurgeDeletedAccounts()
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to purge deleted accounts")
+		} else if purged > 0 {
+			logger.Info().Int("count", purged).Msg("purged deleted accounts")
+		}
+
+		if err := userService.PurgeExpiredExports(); err != nil {
+			logger.Error().Err(err).Msg("failed to purge expired data exports")
+		}
+	}
+}
+
+// deliverNotifications sends due sighting alerts by email and push, once a minute.
+// In-app notifications need no delivery.
+func deliverNotifications(logger log.Logger, notificationService service.NotificationService) {
+	for range time.Tick(time.Minute) {
+		delivered, err := notificationService.Deliver()
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to deliver notifications")
+		} else if delivered > 0 {
+			logger.Info().Int("count", delivered).Msg("delivered notifications")
+		}
+	}
+}
+
+// oauthProviders configures every provider whose client ID is set in the environment.
+func oauthProviders() (providers []goth.Provider, err error) {
+	if id := os.Getenv("GOOGLE_CLIENT_ID"); id != "" {
+		providers = append(providers, google.New(id, os.Getenv("GOOGLE_CLIENT_SECRET"), os.Getenv("GOOGLE_CLIENT_CALLBACK_URL")))
+	}
+
+	if id := os.Getenv("GITHUB_CLIENT_ID"); id != "" {
+		// private addresses are only readable with user:email
+		providers = append(providers, github.New(id, os.Getenv("GITHUB_CLIENT_SECRET"), os.Getenv("GITHUB_CLIENT_CALLBACK_URL"), "user:email"))
+	}
+
+	if id := os.Getenv("FACEBOOK_CLIENT_ID"); id != "" {
+		providers = append(providers, facebook.New(id, os.Getenv("FACEBOOK_CLIENT_SECRET"), os.Getenv("FACEBOOK_CLIENT_CALLBACK_URL"), "email"))
+	}
+
+	if id := os.Getenv("APPLE_CLIENT_ID"); id != "" {
+		// apple's client secret is a JWT signed with our key, it may live at most six months
+		now := time.Now()
+
+		var secret *string
+		secret, err = apple.MakeSecret(apple.SecretParams{
+			PKCS8PrivateKey: os.Getenv("APPLE_PRIVATE_KEY"),
+			TeamId:          os.Getenv("APPLE_TEAM_ID"),
+			KeyId:           os.Getenv("APPLE_KEY_ID"),
+			ClientId:        id,
+			Iat:             int(now.Unix()),
+			Exp:             int(now.Add(time.Hour * 24 * 180).Unix()),
+		})
+		if err != nil {
+			err = fmt.Errorf("failed to create apple client secret: %v", err)
+			return
+		}
+
+		providers = append(providers, apple.New(id, *secret, os.Getenv("APPLE_CLIENT_CALLBACK_URL"), nil, apple.ScopeEmail, apple.ScopeName))
+	}
+
+	return
+}
+
+// serverConfig reads the settings that differ between environments. Outside of
+// APP_ENV=production the defaults suit the local frontend dev server.
+func serverConfig() (config http.Config, err error) {
+	redirectURIs := os.Getenv("OAUTH_REDIRECT_URIS")
+	if redirectURIs == "" {
+		redirectURIs = "http://localhost:5173/login/callback,http://localhost:5173/settings/accounts"
+	}
+
+	config.OAuthRedirectURIs = splitList(redirectURIs)
+
+	// links are built by appending paths to it
+	config.FrontendURL = strings.TrimSuffix(os.Getenv("FRONTEND_URL"), "/")
+	if config.FrontendURL == "" {
+		config.FrontendURL = "http://localhost:5173"
+	}
+
+	config.CookieSecure = os.Getenv("APP_ENV") == "production"
+
+	config.CORS, err = corsConfig()
+	if err != nil {
+		return
+	}
+
+	switch strings.ToLower(os.Getenv("COOKIE_SAME_SITE")) {
+	case "", "lax":
+		config.CookieSameSite = nethttp.SameSiteLaxMode
+	case "strict":
+		config.CookieSameSite = nethttp.SameSiteStrictMode
+	case "none":
+		// browsers drop SameSite=None cookies that aren't Secure
+		if !config.CookieSecure {
+			err = fmt.Errorf("COOKIE_SAME_SITE=none requires APP_ENV=production")
+			return
+		}
+		config.CookieSameSite = nethttp.SameSiteNoneMode
+	default:
+		err = fmt.Errorf("unknown COOKIE_SAME_SITE %q", os.Getenv("COOKIE_SAME_SITE"))
+		return
+	}
+
+	return
+}
+
+func corsConfig() (config http.CORSConfig, err error) {
+	config = http.CORSConfig{
+		AllowedOrigins: []string{"http://localhost:5173"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-CSRF-Token", "Cache-Control", "X-Requested-With"},
+		MaxAge:         time.Minute * 10,
+	}
+
+	if origins := os.Getenv("CORS_ALLOWED_ORIGINS"); origins != "" {
+		config.AllowedOrigins = splitList(origins)
+	}
+
+	if methods := os.Getenv("CORS_ALLOWED_METHODS"); methods != "" {
+		config.AllowedMethods = splitList(methods)
+	}
+
+	if headers := os.Getenv("CORS_ALLOWED_HEADERS"); headers != "" {
+		config.AllowedHeaders = splitList(headers)
+	}
+
+	if maxAge := os.Getenv("CORS_MAX_AGE"); maxAge != "" {
+		config.MaxAge, err = time.ParseDuration(maxAge)
+		if err != nil {
+			err = fmt.Errorf("invalid CORS_MAX_AGE: %v", err)
+			return
+		}
+	}
+
+	return
+}
+
+// splitList parses comma separated env values, tolerating spaces after the commas.
+func splitList(value string) (list []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,25 @@
+-- Moves the single users.oauth_id column into user_identities so a user can
+-- link several providers. Every oauth_id issued so far came from Google.
+
+BEGIN;
+
+CREATE TABLE user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    provider_user_id TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, provider_user_id),
+    UNIQUE (user_id, provider)
+);
+
+INSERT INTO user_identities (user_id, provider, provider_user_id, email)
+SELECT id, 'google', oauth_id, email
+FROM users
+WHERE oauth_id IS NOT NULL AND oauth_id <> ''
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE users DROP COLUMN oauth_id;
+
+COMMIT;
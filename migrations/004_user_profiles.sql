@@ -0,0 +1,13 @@
+-- Profile fields users can edit from /me, shown on their public profile.
+
+BEGIN;
+
+ALTER TABLE users
+    ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN bio TEXT NOT NULL DEFAULT '',
+    ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '',
+    ADD COLUMN home_area TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_sightings_user_id ON sightings (user_id, created_at DESC);
+
+COMMIT;
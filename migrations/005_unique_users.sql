@@ -0,0 +1,50 @@
+-- Makes emails and usernames unique regardless of case. Existing duplicates can't be
+-- merged automatically, so the migration aborts and lists them instead. To see them
+-- without running the migration:
+--
+--   SELECT lower(email), array_agg(id ORDER BY created_at) FROM users
+--   WHERE email <> '' GROUP BY lower(email) HAVING count(*) > 1;
+--
+--   SELECT lower(username), array_agg(id ORDER BY created_at) FROM users
+--   GROUP BY lower(username) HAVING count(*) > 1;
+
+BEGIN;
+
+DO $$
+DECLARE
+    duplicate_emails TEXT;
+    duplicate_usernames TEXT;
+BEGIN
+    SELECT string_agg(format('%s: %s', email, ids), '; ')
+    INTO duplicate_emails
+    FROM (
+        SELECT lower(email) AS email, array_agg(id ORDER BY created_at) AS ids
+        FROM users
+        WHERE email <> ''
+        GROUP BY lower(email)
+        HAVING count(*) > 1
+    ) duplicates;
+
+    SELECT string_agg(format('%s: %s', username, ids), '; ')
+    INTO duplicate_usernames
+    FROM (
+        SELECT lower(username) AS username, array_agg(id ORDER BY created_at) AS ids
+        FROM users
+        GROUP BY lower(username)
+        HAVING count(*) > 1
+    ) duplicates;
+
+    IF duplicate_emails IS NOT NULL OR duplicate_usernames IS NOT NULL THEN
+        RAISE EXCEPTION 'resolve duplicate accounts before running this migration'
+            USING DETAIL = format('emails: [%s] usernames: [%s]',
+                coalesce(duplicate_emails, ''), coalesce(duplicate_usernames, ''));
+    END IF;
+END $$;
+
+-- emails are stored lower case from now on
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+
+CREATE UNIQUE INDEX users_email_lower_key ON users (lower(email)) WHERE email <> '';
+CREATE UNIQUE INDEX users_username_lower_key ON users (lower(username));
+
+COMMIT;
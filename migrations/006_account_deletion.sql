@@ -0,0 +1,3 @@
+-- Accounts are soft deleted first and only purged once the grace period is over.
+
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
@@ -0,0 +1,7 @@
+-- Sighting locations can be coarsened or hidden for everyone but the reporter,
+-- moderators and partners.
+
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'partner'));
+ALTER TABLE users ADD COLUMN location_precision TEXT NOT NULL DEFAULT 'exact' CHECK (location_precision IN ('exact', '100m', '1km', 'hidden'));
+
+ALTER TABLE sightings ADD COLUMN location_precision TEXT CHECK (location_precision IN ('exact', '100m', '1km', 'hidden'));
@@ -0,0 +1,21 @@
+-- Rescue organizations share sightings, at their exact location, between members.
+
+CREATE TABLE organizations (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE organization_members (
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'coordinator', 'volunteer')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX idx_organization_members_user_id ON organization_members (user_id);
+
+ALTER TABLE sightings ADD COLUMN organization_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_sightings_organization_id ON sightings (organization_id);
@@ -0,0 +1,23 @@
+-- Threaded comments on sightings, with the users they mention.
+
+CREATE TABLE comments (
+    id SERIAL PRIMARY KEY,
+    sighting_id INTEGER NOT NULL REFERENCES sightings(id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    -- NULL once the author is purged, the comment stays to keep threads intact
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'visible' CHECK (status IN ('visible', 'held', 'hidden')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    edited_at TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE INDEX idx_comments_sighting_id ON comments (sighting_id, created_at);
+CREATE INDEX idx_comments_status ON comments (status) WHERE status = 'held';
+
+CREATE TABLE comment_mentions (
+    comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (comment_id, user_id)
+);
@@ -0,0 +1,19 @@
+-- Other users can confirm a sighting, which feeds its confidence score. Existing
+-- sightings start from what their photo is worth and are rescored as they get
+-- confirmed.
+
+CREATE TABLE sighting_confirmations (
+    sighting_id INTEGER NOT NULL REFERENCES sightings(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    photo_url TEXT NOT NULL DEFAULT '',
+    latitude FLOAT,
+    longitude FLOAT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (sighting_id, user_id)
+);
+
+ALTER TABLE sightings ADD COLUMN confidence REAL NOT NULL DEFAULT 0;
+
+UPDATE sightings SET confidence = CASE WHEN COALESCE(photo_url, '') <> '' THEN 0.35 ELSE 0.2 END;
+
+CREATE INDEX idx_sightings_confidence ON sightings (confidence);
@@ -0,0 +1,56 @@
+-- Users save areas and hear about new sightings in them by email, in the app or by
+-- push, within the limits of their notification preferences.
+
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+-- Areas are polygons, or points notifying within radius_meters of them. ST_DWithin
+-- with a radius of 0 is an intersection test, so both match the same way.
+CREATE TABLE alert_areas (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    area GEOGRAPHY NOT NULL,
+    radius_meters FLOAT NOT NULL DEFAULT 0 CHECK (radius_meters >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_alert_areas_user_id ON alert_areas (user_id);
+CREATE INDEX idx_alert_areas_area ON alert_areas USING GIST (area);
+
+CREATE TABLE notification_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email BOOLEAN NOT NULL DEFAULT TRUE,
+    in_app BOOLEAN NOT NULL DEFAULT TRUE,
+    push BOOLEAN NOT NULL DEFAULT FALSE,
+    max_per_hour INTEGER NOT NULL DEFAULT 5 CHECK (max_per_hour >= 0),
+    quiet_start TIME,
+    quiet_end TIME,
+    time_zone TEXT NOT NULL DEFAULT 'UTC'
+);
+
+CREATE TABLE push_devices (
+    token TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_push_devices_user_id ON push_devices (user_id);
+
+-- Pending notifications are the delivery queue. A user hears about a sighting once per
+-- channel, however many of their areas it falls in.
+CREATE TABLE notifications (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    sighting_id INTEGER NOT NULL REFERENCES sightings(id) ON DELETE CASCADE,
+    area_id INTEGER REFERENCES alert_areas(id) ON DELETE SET NULL,
+    channel TEXT NOT NULL CHECK (channel IN ('email', 'in_app', 'push')),
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    deliver_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, sighting_id, channel)
+);
+
+CREATE INDEX idx_notifications_pending ON notifications (deliver_at) WHERE status = 'pending';
+CREATE INDEX idx_notifications_user_id ON notifications (user_id, channel, created_at DESC);
@@ -0,0 +1,65 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachedList checks passwords against a local copy of the Have I Been Pwned
+// password hashes, split the way its range API serves them: one file per 5 character
+// SHA-1 prefix, e.g. 21BD1 or 21BD1.txt, holding "SUFFIX:COUNT" lines. The full set
+// is far too large for memory, so only the one file a password falls into is read.
+type BreachedList struct {
+	dir string
+}
+
+func NewBreachedList(dir string) (list *BreachedList, err error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return
+	}
+
+	if !info.IsDir() {
+		err = errors.New(dir + " is not a directory")
+		return
+	}
+
+	return &BreachedList{dir: dir}, nil
+}
+
+// Contains reports whether password appears in any known breach.
+func (l *BreachedList) Contains(password string) (breached bool, err error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(l.dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		f, err = os.Open(filepath.Join(l.dir, prefix+".txt"))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		// a partial copy of the list just doesn't know about this prefix
+		return false, nil
+	}
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+
+	err = scanner.Err()
+	return
+}
@@ -0,0 +1,149 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hasher hashes new passwords and verifies stored hashes.
+type Hasher interface {
+	Hash(password string) (encoded string, err error)
+
+	// Verify reports whether password matches encoded, and whether encoded is
+	// outdated and should be replaced by a fresh Hash while the password is at hand.
+	Verify(password string, encoded string) (match bool, rehash bool, err error)
+}
+
+// Argon2idParams are the cost settings encoded into every hash.
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follow the OWASP password storage recommendation.
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher stores hashes in the PHC string format, e.g.
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>. It still verifies the bcrypt hashes
+// written before it, asking for them to be rehashed.
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+var errInvalidHash = errors.New("invalid password hash")
+
+func (h *Argon2idHasher) Hash(password string) (encoded string, err error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err = rand.Read(salt); err != nil {
+		return
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	encoded = fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return
+}
+
+func (h *Argon2idHasher) Verify(password string, encoded string) (match bool, rehash bool, err error) {
+	switch {
+	case encoded == "":
+		// accounts created through a provider have no password
+		return false, false, nil
+
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		// bcrypt never hashed anything longer than 72 bytes, so those can't match. Older
+		// versions of the package compare just the first 72, newer ones return an error.
+		if len(password) > 72 {
+			return false, false, nil
+		}
+
+		err = bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) || errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return false, false, nil
+		}
+
+		return err == nil, true, err
+
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, false, err
+		}
+
+		computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return false, false, nil
+		}
+
+		outdated := params.Memory != h.params.Memory ||
+			params.Iterations != h.params.Iterations ||
+			params.Parallelism != h.params.Parallelism ||
+			params.KeyLength != h.params.KeyLength
+
+		return true, outdated, nil
+
+	default:
+		return false, false, errInvalidHash
+	}
+}
+
+func decodeArgon2id(encoded string) (params Argon2idParams, salt []byte, key []byte, err error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		err = errInvalidHash
+		return
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		err = errInvalidHash
+		return
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		err = errInvalidHash
+		return
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		err = errInvalidHash
+		return
+	}
+
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		err = errInvalidHash
+		return
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return
+}
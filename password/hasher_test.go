@@ -0,0 +1,79 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testParams keep the tests fast, they don't need real costs.
+var testParams = Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHasherVerify(t *testing.T) {
+	h := NewArgon2idHasher(testParams)
+
+	current, err := h.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outdated, err := NewArgon2idHasher(Argon2idParams{Memory: 32, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}).Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse battery staple"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	long := strings.Repeat("a", 72)
+	legacyLong, err := bcrypt.GenerateFromPassword([]byte(long), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		password   string
+		encoded    string
+		wantMatch  bool
+		wantRehash bool
+		wantErr    bool
+	}{
+		{"argon2id match", "correct horse battery staple", current, true, false, false},
+		{"argon2id mismatch", "wrong", current, false, false, false},
+		{"argon2id outdated params", "correct horse battery staple", outdated, true, true, false},
+		{"bcrypt match is rehashed", "correct horse battery staple", string(legacy), true, true, false},
+		{"bcrypt mismatch", "wrong", string(legacy), false, false, false},
+		{"bcrypt password over 72 bytes", long + "b", string(legacyLong), false, false, false},
+		{"no password", "anything", "", false, false, false},
+		{"unknown format", "anything", "$md5$abc", false, false, true},
+		{"corrupt argon2id", "anything", "$argon2id$v=19$broken", false, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, rehash, err := h.Verify(tt.password, tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if match != tt.wantMatch || rehash != tt.wantRehash {
+				t.Errorf("Verify() = (%v, %v), want (%v, %v)", match, rehash, tt.wantMatch, tt.wantRehash)
+			}
+		})
+	}
+}
+
+func TestArgon2idHasherSaltsEveryHash(t *testing.T) {
+	h := NewArgon2idHasher(testParams)
+
+	a, _ := h.Hash("same password")
+	b, _ := h.Hash("same password")
+
+	if a == b {
+		t.Error("two hashes of the same password are identical")
+	}
+}
@@ -0,0 +1,55 @@
+package password
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/nbutton23/zxcvbn-go"
+	"github.com/papacatzzi-server/domain"
+)
+
+const (
+	MinLength = 10
+	MaxLength = 128
+
+	// zxcvbn slows down sharply on long inputs, anything past this is strong enough anyway
+	maxEstimatedLength = 64
+)
+
+// Policy decides which new passwords are acceptable. Length is checked where the
+// request is validated, Check covers what needs more than the password's length.
+type Policy struct {
+	// MinScore is the lowest zxcvbn score accepted, from 0 (guessable) to 4.
+	MinScore int
+
+	// Breached is optional, without it breached passwords aren't checked.
+	Breached *BreachedList
+}
+
+// Check rejects weak or breached passwords. userInputs, like the username and email,
+// count against a password that is built from them.
+func (p Policy) Check(password string, userInputs ...string) (err error) {
+	estimated := password
+	if utf8.RuneCountInString(estimated) > maxEstimatedLength {
+		estimated = string([]rune(estimated)[:maxEstimatedLength])
+	}
+
+	if zxcvbn.PasswordStrength(estimated, userInputs).Score < p.MinScore {
+		return domain.ErrPasswordTooWeak
+	}
+
+	if p.Breached == nil {
+		return
+	}
+
+	breached, err := p.Breached.Contains(password)
+	if err != nil {
+		return fmt.Errorf("failed to check breached passwords: %v", err)
+	}
+
+	if breached {
+		return domain.ErrPasswordBreached
+	}
+
+	return
+}
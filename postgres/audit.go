@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+)
+
+func (r UserRepository) InsertAuditEvent(event domain.AuditEvent) (err error) {
+
+	_, err = r.db.Exec(`
+		INSERT INTO audit_events (user_id, type, detail, session_id, ip_address, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, event.UserID, event.Type, event.Detail, event.SessionID, event.IPAddress, event.UserAgent)
+
+	return
+}
+
+// GetAuditEvents returns everything recorded about a user's account, newest first.
+func (r UserRepository) GetAuditEvents(userID uuid.UUID) (events []domain.AuditEvent, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT id, user_id, type, detail, session_id, ip_address, user_agent, created_at
+		FROM audit_events
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e domain.AuditEvent
+
+		err = rows.Scan(&e.ID, &e.UserID, &e.Type, &e.Detail, &e.SessionID, &e.IPAddress, &e.UserAgent, &e.CreatedAt)
+		if err != nil {
+			return
+		}
+
+		events = append(events, e)
+	}
+
+	err = rows.Err()
+	return
+}
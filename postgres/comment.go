@@ -0,0 +1,248 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/papacatzzi-server/domain"
+)
+
+type CommentRepository struct {
+	db *sql.DB
+}
+
+func NewCommentRepository(db *sql.DB) CommentRepository {
+	return CommentRepository{db: db}
+}
+
+const commentColumns = `
+	c.id, c.sighting_id, c.parent_id, c.user_id, COALESCE(u.username, ''), c.body, c.status,
+	ARRAY(
+		SELECT mu.username FROM comment_mentions cm
+		JOIN users mu ON mu.id = cm.user_id
+		WHERE cm.comment_id = c.id
+		ORDER BY mu.username
+	),
+	c.created_at, c.edited_at, c.deleted_at
+`
+
+func scanComment(row interface{ Scan(...interface{}) error }) (c domain.Comment, err error) {
+	err = row.Scan(
+		&c.ID, &c.SightingID, &c.ParentID, &c.AuthorID, &c.AuthorUsername, &c.Body, &c.Status,
+		pq.Array(&c.Mentions), &c.CreatedAt, &c.EditedAt, &c.DeletedAt,
+	)
+
+	return
+}
+
+// InsertComment saves the comment along with the users it mentions.
+func (r CommentRepository) InsertComment(comment domain.Comment, mentions []uuid.UUID) (id int, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO comments (sighting_id, parent_id, user_id, body, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, comment.SightingID, comment.ParentID, comment.AuthorID, comment.Body, comment.Status).Scan(&id)
+	if err != nil {
+		return
+	}
+
+	if err = insertMentions(tx, id, mentions); err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+func (r CommentRepository) GetComment(id int) (comment domain.Comment, err error) {
+
+	return scanComment(r.db.QueryRow(`
+		SELECT `+commentColumns+`
+		FROM comments c
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.id = $1
+	`, id))
+}
+
+// GetComments returns every comment on a sighting, oldest first, whatever its status.
+func (r CommentRepository) GetComments(sightingID int) (comments []domain.Comment, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT `+commentColumns+`
+		FROM comments c
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.sighting_id = $1
+		ORDER BY c.created_at, c.id
+	`, sightingID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c domain.Comment
+
+		c, err = scanComment(rows)
+		if err != nil {
+			return
+		}
+
+		comments = append(comments, c)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// GetCommentsByStatus returns the comments waiting on moderators, oldest first.
+func (r CommentRepository) GetCommentsByStatus(status domain.CommentStatus) (comments []domain.Comment, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT `+commentColumns+`
+		FROM comments c
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.status = $1 AND c.deleted_at IS NULL
+		ORDER BY c.created_at, c.id
+	`, status)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c domain.Comment
+
+		c, err = scanComment(rows)
+		if err != nil {
+			return
+		}
+
+		comments = append(comments, c)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// GetCommentsByAuthor returns the comments a user wrote and hasn't deleted, oldest first.
+func (r CommentRepository) GetCommentsByAuthor(userID uuid.UUID) (comments []domain.Comment, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT `+commentColumns+`
+		FROM comments c
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.user_id = $1 AND c.deleted_at IS NULL
+		ORDER BY c.created_at, c.id
+	`, userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c domain.Comment
+
+		c, err = scanComment(rows)
+		if err != nil {
+			return
+		}
+
+		comments = append(comments, c)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// UpdateComment replaces an edited comment's body and mentions.
+func (r CommentRepository) UpdateComment(comment domain.Comment, mentions []uuid.UUID) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE comments
+		SET body = $1, status = $2, edited_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`, comment.Body, comment.Status, comment.ID)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM comment_mentions
+		WHERE comment_id = $1
+	`, comment.ID)
+	if err != nil {
+		return
+	}
+
+	if err = insertMentions(tx, comment.ID, mentions); err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+func (r CommentRepository) UpdateCommentStatus(id int, status domain.CommentStatus) (err error) {
+
+	_, err = r.db.Exec(`
+		UPDATE comments
+		SET status = $1
+		WHERE id = $2
+	`, status, id)
+
+	return
+}
+
+// DeleteComment blanks the comment but keeps the row, so replies keep their place in the thread.
+func (r CommentRepository) DeleteComment(id int) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE comments
+		SET body = '', deleted_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM comment_mentions
+		WHERE comment_id = $1
+	`, id)
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+func insertMentions(tx *sql.Tx, commentID int, mentions []uuid.UUID) (err error) {
+	for _, userID := range mentions {
+		_, err = tx.Exec(`
+			INSERT INTO comment_mentions (comment_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, commentID, userID)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
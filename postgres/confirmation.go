@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+)
+
+// UpsertConfirmation records a confirmation, replacing the user's earlier one for the same sighting.
+func (r SightingRepository) UpsertConfirmation(confirmation domain.Confirmation) (err error) {
+
+	_, err = r.db.Exec(`
+		INSERT INTO sighting_confirmations (sighting_id, user_id, photo_url, latitude, longitude)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (sighting_id, user_id)
+		DO UPDATE SET photo_url = $3, latitude = $4, longitude = $5, created_at = CURRENT_TIMESTAMP
+	`, confirmation.SightingID, confirmation.UserID, confirmation.PhotoURL, confirmation.Latitude, confirmation.Longitude)
+
+	return
+}
+
+func (r SightingRepository) DeleteConfirmation(sightingID int, userID uuid.UUID) (deleted bool, err error) {
+
+	res, err := r.db.Exec(`
+		DELETE FROM sighting_confirmations
+		WHERE sighting_id = $1 AND user_id = $2
+	`, sightingID, userID)
+	if err != nil {
+		return
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	deleted = n > 0
+	return
+}
+
+func (r SightingRepository) GetConfirmations(sightingID int) (confirmations []domain.Confirmation, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT sighting_id, user_id, photo_url, latitude, longitude, created_at
+		FROM sighting_confirmations
+		WHERE sighting_id = $1
+	`, sightingID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c domain.Confirmation
+
+		err = rows.Scan(&c.SightingID, &c.UserID, &c.PhotoURL, &c.Latitude, &c.Longitude, &c.CreatedAt)
+		if err != nil {
+			return
+		}
+
+		confirmations = append(confirmations, c)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// GetConfirmationsByUser returns the confirmations a user gave, oldest first.
+func (r SightingRepository) GetConfirmationsByUser(userID uuid.UUID) (confirmations []domain.Confirmation, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT sighting_id, user_id, photo_url, latitude, longitude, created_at
+		FROM sighting_confirmations
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c domain.Confirmation
+
+		err = rows.Scan(&c.SightingID, &c.UserID, &c.PhotoURL, &c.Latitude, &c.Longitude, &c.CreatedAt)
+		if err != nil {
+			return
+		}
+
+		confirmations = append(confirmations, c)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// GetSightingForScoring returns what a sighting's confidence is computed from, whoever
+// can see it, with the precision in effect. The location is exact, it must not leave
+// the service.
+func (r SightingRepository) GetSightingForScoring(id int) (sighting domain.Sighting, err error) {
+
+	err = r.db.QueryRow(`
+		SELECT s.id, s.user_id, COALESCE(s.photo_url, ''), s.latitude, s.longitude, s.organization_id, s.visibility,
+			COALESCE(s.location_precision, u.location_precision, 'exact')
+		FROM sightings s
+		LEFT JOIN users u ON u.id::text = s.user_id
+		WHERE s.id = $1
+	`, id).Scan(&sighting.ID, &sighting.Reporter, &sighting.PhotoURL, &sighting.Latitude, &sighting.Longitude, &sighting.OrganizationID, &sighting.Visibility, &sighting.Precision)
+
+	return
+}
+
+// GetReporterStats counts a reporter's sightings, leaving out exclude, and how many of
+// them someone else confirmed.
+func (r SightingRepository) GetReporterStats(reporter string, exclude int) (total int, confirmed int, err error) {
+
+	err = r.db.QueryRow(`
+		SELECT count(*), count(*) FILTER (WHERE EXISTS (
+			SELECT 1 FROM sighting_confirmations c WHERE c.sighting_id = s.id
+		))
+		FROM sightings s
+		WHERE s.user_id = $1 AND s.id <> $2
+	`, reporter, exclude).Scan(&total, &confirmed)
+
+	return
+}
+
+func (r SightingRepository) GetSightingIDsByReporter(reporter string) (ids []int, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT id
+		FROM sightings
+		WHERE user_id = $1
+	`, reporter)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+
+		if err = rows.Scan(&id); err != nil {
+			return
+		}
+
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (r SightingRepository) UpdateConfidence(id int, confidence float64) (err error) {
+
+	_, err = r.db.Exec(`
+		UPDATE sightings
+		SET confidence = $1
+		WHERE id = $2
+	`, confidence, id)
+
+	return
+}
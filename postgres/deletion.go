@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SoftDeleteUser starts the deletion grace period, the account can't log in meanwhile.
+func (r UserRepository) SoftDeleteUser(id uuid.UUID, deletedAt time.Time) (err error) {
+
+	_, err = r.db.Exec(`
+		UPDATE users
+		SET deleted_at = $1, is_active = FALSE
+		WHERE id = $2
+	`, deletedAt, id)
+
+	return
+}
+
+// RestoreUser undoes SoftDeleteUser and reports whether the account was still there to restore.
+func (r UserRepository) RestoreUser(id uuid.UUID) (restored bool, err error) {
+
+	res, err := r.db.Exec(`
+		UPDATE users
+		SET deleted_at = NULL, is_active = TRUE
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`, id)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	restored = affected > 0
+	return
+}
+
+func (r UserRepository) GetUsersDeletedBefore(before time.Time) (ids []uuid.UUID, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT id
+		FROM users
+		WHERE deleted_at < $1
+	`, before)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		if err = rows.Scan(&id); err != nil {
+			return
+		}
+
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// PurgeUser deletes a soft deleted user for good. Their sightings stay on the map
+// without a reporter, everything else goes with the users row.
+func (r UserRepository) PurgeUser(id uuid.UUID) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE sightings
+		SET user_id = ''
+		WHERE user_id = $1
+	`, id.String())
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM users
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`, id)
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
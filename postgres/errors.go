@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/papacatzzi-server/domain"
+)
+
+const uniqueViolation = "23505"
+
+// uniqueConstraintErrors maps unique indexes to the domain error for a taken value.
+var uniqueConstraintErrors = map[string]error{
+	"users_email_lower_key":    domain.ErrEmailTaken,
+	"users_username_lower_key": domain.ErrUsernameExists,
+}
+
+// translateError turns unique violations on known indexes into domain errors, so a
+// race past the service's existence checks still reads as "already taken".
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != uniqueViolation {
+		return err
+	}
+
+	if mapped, ok := uniqueConstraintErrors[pqErr.Constraint]; ok {
+		return mapped
+	}
+
+	return err
+}
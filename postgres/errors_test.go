@@ -0,0 +1,40 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/papacatzzi-server/domain"
+)
+
+func TestTranslateError(t *testing.T) {
+	emailTaken := &pq.Error{Code: uniqueViolation, Constraint: "users_email_lower_key"}
+	usernameTaken := &pq.Error{Code: uniqueViolation, Constraint: "users_username_lower_key"}
+	otherUnique := &pq.Error{Code: uniqueViolation, Constraint: "user_identities_provider_key"}
+	notNull := &pq.Error{Code: "23502", Constraint: "users_email_lower_key"}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "no error", err: nil, want: nil},
+		{name: "email taken", err: emailTaken, want: domain.ErrEmailTaken},
+		{name: "username taken", err: usernameTaken, want: domain.ErrUsernameExists},
+		{name: "wrapped", err: fmt.Errorf("insert failed: %w", usernameTaken), want: domain.ErrUsernameExists},
+		{name: "unknown unique index", err: otherUnique, want: otherUnique},
+		{name: "other violation", err: notNull, want: notNull},
+		{name: "not a postgres error", err: sql.ErrNoRows, want: sql.ErrNoRows},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := translateError(tt.err); !errors.Is(got, tt.want) || (tt.want == nil) != (got == nil) {
+				t.Errorf("translateError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
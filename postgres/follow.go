@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+)
+
+func (r UserRepository) InsertFollow(followerID uuid.UUID, followeeID uuid.UUID) (err error) {
+
+	_, err = r.db.Exec(`
+		INSERT INTO follows (follower_id, followee_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, followerID, followeeID)
+
+	return
+}
+
+func (r UserRepository) DeleteFollow(followerID uuid.UUID, followeeID uuid.UUID) (err error) {
+
+	_, err = r.db.Exec(`
+		DELETE FROM follows
+		WHERE follower_id = $1 AND followee_id = $2
+	`, followerID, followeeID)
+
+	return
+}
+
+// GetFollowing returns who the user follows.
+func (r UserRepository) GetFollowing(userID uuid.UUID) (follows []domain.Follow, err error) {
+	return r.getFollows(`
+		SELECT u.username, f.created_at
+		FROM follows f
+		JOIN users u ON u.id = f.followee_id
+		WHERE f.follower_id = $1
+		ORDER BY f.created_at
+	`, userID)
+}
+
+// GetFollowers returns who follows the user.
+func (r UserRepository) GetFollowers(userID uuid.UUID) (follows []domain.Follow, err error) {
+	return r.getFollows(`
+		SELECT u.username, f.created_at
+		FROM follows f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.followee_id = $1
+		ORDER BY f.created_at
+	`, userID)
+}
+
+func (r UserRepository) getFollows(query string, userID uuid.UUID) (follows []domain.Follow, err error) {
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f domain.Follow
+
+		if err = rows.Scan(&f.Username, &f.CreatedAt); err != nil {
+			return
+		}
+
+		follows = append(follows, f)
+	}
+
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+)
+
+func (r UserRepository) GetIdentity(provider string, providerUserID string) (identity domain.OAuthIdentity, err error) {
+
+	err = r.db.QueryRow(`
+		SELECT id, user_id, provider, provider_user_id, email, created_at
+		FROM user_identities
+		WHERE provider = $1 AND provider_user_id = $2
+	`, provider, providerUserID).Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.ProviderUserID, &identity.Email, &identity.CreatedAt)
+
+	return
+}
+
+func (r UserRepository) GetIdentities(userID uuid.UUID) (identities []domain.OAuthIdentity, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT id, user_id, provider, provider_user_id, email, created_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i domain.OAuthIdentity
+
+		err = rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.ProviderUserID, &i.Email, &i.CreatedAt)
+		if err != nil {
+			return
+		}
+
+		identities = append(identities, i)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (r UserRepository) InsertIdentity(identity domain.OAuthIdentity) (err error) {
+
+	_, err = r.db.Exec(`
+		INSERT INTO user_identities
+		(user_id, provider, provider_user_id, email, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, identity.UserID, identity.Provider, identity.ProviderUserID, identity.Email, identity.CreatedAt)
+
+	return
+}
+
+// InsertUserWithIdentity creates an account for a first OAuth login in one transaction,
+// so a failed insert never leaves a user nobody can log in as.
+func (r UserRepository) InsertUserWithIdentity(user domain.User, identity domain.OAuthIdentity) (id uuid.UUID, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO users
+		(username, email, password, created_at, is_active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, user.Username, user.Email, user.Password, user.CreatedAt, user.IsActive).Scan(&id)
+	if err != nil {
+		err = translateError(err)
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_identities
+		(user_id, provider, provider_user_id, email, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, id, identity.Provider, identity.ProviderUserID, identity.Email, identity.CreatedAt)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// DeleteIdentity unlinks a provider and reports whether one was linked.
+func (r UserRepository) DeleteIdentity(userID uuid.UUID, provider string) (deleted bool, err error) {
+
+	res, err := r.db.Exec(`
+		DELETE FROM user_identities
+		WHERE user_id = $1 AND provider = $2
+	`, userID, provider)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	deleted = affected > 0
+	return
+}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"hash/fnv"
+	"math"
+
+	"github.com/papacatzzi-server/domain"
+)
+
+// metersPerDegree is the length of a degree of latitude, close enough everywhere.
+const metersPerDegree = 111320
+
+// gridSizes are the cell sizes, in meters, coarsened locations are snapped to.
+var gridSizes = map[domain.LocationPrecision]float64{
+	domain.Precision100m: 100,
+	domain.Precision1km:  1000,
+}
+
+// seesExactLocation reports whether viewer may see where a sighting really is.
+// Members of the organization a sighting is shared with always do.
+func seesExactLocation(viewer domain.Identity, reporter string, member bool) bool {
+	if viewer.Role == domain.RoleModerator || viewer.Role == domain.RolePartner || member {
+		return true
+	}
+
+	return viewer.UserID.String() == reporter
+}
+
+// locate moves s to where viewer may see it, reporting false when its location is
+// hidden from them.
+func locate(viewer domain.Identity, s *domain.Sighting, member bool) (shown bool) {
+	if seesExactLocation(viewer, s.Reporter, member) {
+		return true
+	}
+
+	if s.Precision == domain.PrecisionHidden {
+		return false
+	}
+
+	s.Latitude, s.Longitude = obfuscate(s.ID, s.Precision, s.Latitude, s.Longitude)
+	return true
+}
+
+// obfuscate snaps a location to the center of its grid cell and then moves it by a
+// fixed offset derived from the sighting's ID, so the same sighting always lands on
+// the same spot and repeated requests can't be averaged out. The result never leaves
+// the cell, so it is at most one cell away from the real location.
+func obfuscate(id int, precision domain.LocationPrecision, lat float64, lng float64) (float64, float64) {
+	size, ok := gridSizes[precision]
+	if !ok {
+		return lat, lng
+	}
+
+	latStep := size / metersPerDegree
+	cellLat := (math.Floor(lat/latStep) + 0.5) * latStep
+
+	// degrees of longitude shrink towards the poles, keep cells roughly square
+	lngStep := latStep / math.Max(math.Cos(cellLat*math.Pi/180), 0.01)
+	cellLng := (math.Floor(lng/lngStep) + 0.5) * lngStep
+
+	h := fnv.New64a()
+	h.Write([]byte{byte(id), byte(id >> 8), byte(id >> 16), byte(id >> 24)})
+	sum := h.Sum64()
+
+	// offsets stay within 40% of a cell either way
+	latOffset := (float64(sum&0xffff)/0xffff - 0.5) * 0.8
+	lngOffset := (float64(sum>>16&0xffff)/0xffff - 0.5) * 0.8
+
+	return cellLat + latOffset*latStep, cellLng + lngOffset*lngStep
+}
+
+// BoundsMargin is how far outside a bounding box a sighting can lie and still be
+// shown inside it once coarsened.
+func BoundsMargin(minLat float64, maxLat float64) (latMargin float64, lngMargin float64) {
+	latMargin = gridSizes[domain.Precision1km] / metersPerDegree
+
+	maxAbsLat := math.Min(math.Max(math.Abs(minLat), math.Abs(maxLat))+latMargin, 89)
+	lngMargin = latMargin / math.Max(math.Cos(maxAbsLat*math.Pi/180), 0.01)
+
+	return
+}
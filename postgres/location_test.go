@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+)
+
+func TestObfuscate(t *testing.T) {
+	tests := []struct {
+		name      string
+		precision domain.LocationPrecision
+		lat       float64
+		lng       float64
+	}{
+		{"100m in Paris", domain.Precision100m, 48.8566, 2.3522},
+		{"1km in Paris", domain.Precision1km, 48.8566, 2.3522},
+		{"1km on the equator", domain.Precision1km, 0.0004, -0.0004},
+		{"100m in Sydney", domain.Precision100m, -33.8688, 151.2093},
+		{"1km in Svalbard", domain.Precision1km, 78.2232, 15.6267},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lat, lng := obfuscate(1, tt.precision, tt.lat, tt.lng)
+
+			if lat == tt.lat && lng == tt.lng {
+				t.Fatal("location was not moved")
+			}
+
+			// never further than one cell away
+			latStep := gridSizes[tt.precision] / metersPerDegree
+			lngStep := latStep / math.Cos(lat*math.Pi/180)
+			if math.Abs(lat-tt.lat) > latStep || math.Abs(lng-tt.lng) > lngStep*1.01 {
+				t.Errorf("obfuscate() = %v, %v, more than a cell from %v, %v", lat, lng, tt.lat, tt.lng)
+			}
+
+			// and always within what bounding box queries allow for
+			latMargin, lngMargin := BoundsMargin(tt.lat, tt.lat)
+			if math.Abs(lat-tt.lat) > latMargin || math.Abs(lng-tt.lng) > lngMargin {
+				t.Errorf("obfuscate() = %v, %v, outside BoundsMargin of %v, %v", lat, lng, tt.lat, tt.lng)
+			}
+
+			// the same sighting always lands on the same spot, so it can't be averaged out
+			if againLat, againLng := obfuscate(1, tt.precision, tt.lat, tt.lng); againLat != lat || againLng != lng {
+				t.Errorf("obfuscate() is not stable, got %v, %v then %v, %v", lat, lng, againLat, againLng)
+			}
+
+			// moving within the cell doesn't move the shown location
+			nudge := latStep / 100
+			if nudgedLat, nudgedLng := obfuscate(1, tt.precision, cellCenter(tt.lat, latStep)+nudge, tt.lng); nudgedLat != lat || nudgedLng != lng {
+				t.Errorf("obfuscate() moved with the location inside its cell")
+			}
+
+			if otherLat, otherLng := obfuscate(2, tt.precision, tt.lat, tt.lng); otherLat == lat && otherLng == lng {
+				t.Errorf("obfuscate() puts different sightings on the same spot")
+			}
+		})
+	}
+}
+
+func TestObfuscateLeavesOtherPrecisions(t *testing.T) {
+	for _, precision := range []domain.LocationPrecision{domain.PrecisionExact, domain.PrecisionHidden, ""} {
+		if lat, lng := obfuscate(1, precision, 48.8566, 2.3522); lat != 48.8566 || lng != 2.3522 {
+			t.Errorf("obfuscate(%q) = %v, %v, want the location unchanged", precision, lat, lng)
+		}
+	}
+}
+
+func TestLocate(t *testing.T) {
+	reporter := uuid.New()
+
+	tests := []struct {
+		name      string
+		viewer    domain.Identity
+		member    bool
+		precision domain.LocationPrecision
+		shown     bool
+		exact     bool
+	}{
+		{"reporter", domain.Identity{UserID: reporter}, false, domain.PrecisionHidden, true, true},
+		{"moderator", domain.Identity{UserID: uuid.New(), Role: domain.RoleModerator}, false, domain.PrecisionHidden, true, true},
+		{"partner", domain.Identity{UserID: uuid.New(), Role: domain.RolePartner}, false, domain.Precision1km, true, true},
+		{"organization member", domain.Identity{UserID: uuid.New()}, true, domain.PrecisionHidden, true, true},
+		{"anonymous, exact", domain.Identity{}, false, domain.PrecisionExact, true, true},
+		{"anonymous, coarsened", domain.Identity{}, false, domain.Precision100m, true, false},
+		{"other user, coarsened", domain.Identity{UserID: uuid.New()}, false, domain.Precision1km, true, false},
+		{"other user, hidden", domain.Identity{UserID: uuid.New()}, false, domain.PrecisionHidden, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := domain.Sighting{
+				ID:        7,
+				Reporter:  reporter.String(),
+				Latitude:  48.8566,
+				Longitude: 2.3522,
+				Precision: tt.precision,
+			}
+
+			if shown := locate(tt.viewer, &s, tt.member); shown != tt.shown {
+				t.Fatalf("locate() = %v, want %v", shown, tt.shown)
+			}
+
+			if !tt.shown {
+				return
+			}
+
+			if exact := s.Latitude == 48.8566 && s.Longitude == 2.3522; exact != tt.exact {
+				t.Errorf("exact location shown = %v, want %v", exact, tt.exact)
+			}
+		})
+	}
+}
+
+func cellCenter(lat float64, step float64) float64 {
+	return (math.Floor(lat/step) + 0.5) * step
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"github.com/google/uuid"
+)
+
+func (r UserRepository) UpdateTOTP(userID uuid.UUID, secret string, enabled bool) (err error) {
+
+	_, err = r.db.Exec(`
+		UPDATE users
+		SET totp_secret = $1, totp_enabled = $2
+		WHERE id = $3
+	`, secret, enabled, userID)
+
+	return
+}
+
+// ReplaceRecoveryCodes swaps out every recovery code of the user in one transaction.
+func (r UserRepository) ReplaceRecoveryCodes(userID uuid.UUID, hashes []string) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM recovery_codes
+		WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return
+	}
+
+	for _, hash := range hashes {
+		_, err = tx.Exec(`
+			INSERT INTO recovery_codes
+			(user_id, code_hash)
+			VALUES ($1, $2)
+		`, userID, hash)
+		if err != nil {
+			return
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused code as used and reports whether one matched.
+func (r UserRepository) UseRecoveryCode(userID uuid.UUID, hash string) (used bool, err error) {
+
+	res, err := r.db.Exec(`
+		UPDATE recovery_codes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, hash)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	used = affected > 0
+	return
+}
+
+func (r UserRepository) DeleteRecoveryCodes(userID uuid.UUID) (err error) {
+
+	_, err = r.db.Exec(`
+		DELETE FROM recovery_codes
+		WHERE user_id = $1
+	`, userID)
+
+	return
+}
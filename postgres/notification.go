@@ -0,0 +1,432 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+)
+
+type NotificationRepository struct {
+	db *sql.DB
+}
+
+func NewNotificationRepository(db *sql.DB) NotificationRepository {
+	return NotificationRepository{db: db}
+}
+
+// InsertAlertArea saves an area, and the default notification preferences when it is
+// the user's first. Polygons PostGIS considers invalid come back as sql.ErrNoRows.
+func (r NotificationRepository) InsertAlertArea(area domain.AlertArea) (id int, err error) {
+	geometry := "ST_MakePoint($3::float8, $4::float8)"
+	args := []interface{}{area.UserID, area.Name, area.Longitude, area.Latitude, area.RadiusMeters}
+
+	if len(area.Polygon) > 0 {
+		var polygon []byte
+		polygon, err = json.Marshal(map[string]interface{}{
+			"type":        "Polygon",
+			"coordinates": [][][2]float64{area.Polygon},
+		})
+		if err != nil {
+			return
+		}
+
+		geometry = "ST_GeomFromGeoJSON($3::text)"
+		args = []interface{}{area.UserID, area.Name, string(polygon), 0}
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(fmt.Sprintf(`
+		INSERT INTO alert_areas (user_id, name, area, radius_meters)
+		SELECT $1::uuid, $2::text, ST_SetSRID(g, 4326)::geography, $%d::float8
+		FROM (SELECT %s AS g) AS input
+		WHERE ST_IsValid(g)
+		RETURNING id
+	`, len(args), geometry), args...).Scan(&id)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO notification_preferences (user_id)
+		VALUES ($1)
+		ON CONFLICT DO NOTHING
+	`, area.UserID)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+type geoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+func (r NotificationRepository) GetAlertAreas(userID uuid.UUID) (areas []domain.AlertArea, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT id, user_id, name, ST_AsGeoJSON(area), radius_meters, created_at
+		FROM alert_areas
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var area domain.AlertArea
+		var geometry []byte
+
+		err = rows.Scan(&area.ID, &area.UserID, &area.Name, &geometry, &area.RadiusMeters, &area.CreatedAt)
+		if err != nil {
+			return
+		}
+
+		var g geoJSONGeometry
+		if err = json.Unmarshal(geometry, &g); err != nil {
+			return
+		}
+
+		if g.Type == "Polygon" {
+			var rings [][][2]float64
+			if err = json.Unmarshal(g.Coordinates, &rings); err != nil {
+				return
+			}
+
+			if len(rings) > 0 {
+				area.Polygon = rings[0]
+			}
+		} else {
+			var point [2]float64
+			if err = json.Unmarshal(g.Coordinates, &point); err != nil {
+				return
+			}
+
+			area.Longitude, area.Latitude = point[0], point[1]
+		}
+
+		areas = append(areas, area)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (r NotificationRepository) CountAlertAreas(userID uuid.UUID) (count int, err error) {
+
+	err = r.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM alert_areas
+		WHERE user_id = $1
+	`, userID).Scan(&count)
+
+	return
+}
+
+func (r NotificationRepository) DeleteAlertArea(id int, userID uuid.UUID) (deleted bool, err error) {
+
+	res, err := r.db.Exec(`
+		DELETE FROM alert_areas
+		WHERE id = $1 AND user_id = $2
+	`, id, userID)
+	if err != nil {
+		return
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	deleted = n > 0
+	return
+}
+
+// GetNotificationPreferences returns sql.ErrNoRows for users who never saved any.
+func (r NotificationRepository) GetNotificationPreferences(userID uuid.UUID) (prefs domain.NotificationPreferences, err error) {
+
+	err = r.db.QueryRow(`
+		SELECT email, in_app, push, max_per_hour,
+			COALESCE(to_char(quiet_start, 'HH24:MI'), ''), COALESCE(to_char(quiet_end, 'HH24:MI'), ''), time_zone
+		FROM notification_preferences
+		WHERE user_id = $1
+	`, userID).Scan(&prefs.Email, &prefs.InApp, &prefs.Push, &prefs.MaxPerHour, &prefs.QuietStart, &prefs.QuietEnd, &prefs.TimeZone)
+
+	return
+}
+
+func (r NotificationRepository) UpsertNotificationPreferences(userID uuid.UUID, prefs domain.NotificationPreferences) (err error) {
+
+	_, err = r.db.Exec(`
+		INSERT INTO notification_preferences (user_id, email, in_app, push, max_per_hour, quiet_start, quiet_end, time_zone)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::time, NULLIF($7, '')::time, $8)
+		ON CONFLICT (user_id)
+		DO UPDATE SET email = $2, in_app = $3, push = $4, max_per_hour = $5,
+			quiet_start = NULLIF($6, '')::time, quiet_end = NULLIF($7, '')::time, time_zone = $8
+	`, userID, prefs.Email, prefs.InApp, prefs.Push, prefs.MaxPerHour, prefs.QuietStart, prefs.QuietEnd, prefs.TimeZone)
+
+	return
+}
+
+// InsertPushDevice registers a device for push notifications. Devices change hands
+// when another user logs in on them, so the token moves to the latest user.
+func (r NotificationRepository) InsertPushDevice(userID uuid.UUID, token string) (err error) {
+
+	_, err = r.db.Exec(`
+		INSERT INTO push_devices (token, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (token)
+		DO UPDATE SET user_id = $2, created_at = CURRENT_TIMESTAMP
+	`, token, userID)
+
+	return
+}
+
+func (r NotificationRepository) DeletePushDevice(userID uuid.UUID, token string) (err error) {
+
+	_, err = r.db.Exec(`
+		DELETE FROM push_devices
+		WHERE token = $1 AND user_id = $2
+	`, token, userID)
+
+	return
+}
+
+func (r NotificationRepository) GetPushDevices(userID uuid.UUID) (tokens []string, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT token
+		FROM push_devices
+		WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token string
+
+		if err = rows.Scan(&token); err != nil {
+			return
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// GetAreaMatches returns every user, other than the reporter, with an area a sighting
+// falls in. Users who can't see the sighting aren't matched, and those who may not see
+// its exact location are matched against where they would see it on the map, so an
+// area can't be used to find out where a coarsened sighting really is.
+func (r NotificationRepository) GetAreaMatches(sightingID int) (matches []domain.AreaMatch, err error) {
+	var s domain.Sighting
+
+	err = r.db.QueryRow(`
+		SELECT s.id, s.latitude, s.longitude, COALESCE(s.location_precision, u.location_precision, 'exact')
+		FROM sightings s
+		LEFT JOIN users u ON u.id::text = s.user_id
+		WHERE s.id = $1
+	`, sightingID).Scan(&s.ID, &s.Latitude, &s.Longitude, &s.Precision)
+	if err != nil {
+		return
+	}
+
+	// hidden sightings only match users who see their exact location
+	var shownLat, shownLng *float64
+	if s.Precision != domain.PrecisionHidden {
+		lat, lng := obfuscate(s.ID, s.Precision, s.Latitude, s.Longitude)
+		shownLat, shownLng = &lat, &lng
+	}
+
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT DISTINCT ON (a.user_id) a.user_id, a.id,
+			p.email, p.in_app, p.push, p.max_per_hour,
+			COALESCE(to_char(p.quiet_start, 'HH24:MI'), ''), COALESCE(to_char(p.quiet_end, 'HH24:MI'), ''), p.time_zone,
+			(
+				SELECT COUNT(DISTINCT n.sighting_id) FROM notifications n
+				WHERE n.user_id = a.user_id AND n.channel <> 'in_app' AND n.created_at > CURRENT_TIMESTAMP - INTERVAL '1 hour'
+			)
+		FROM sightings s
+		JOIN alert_areas a ON a.user_id::text <> s.user_id
+		JOIN users u ON u.id = a.user_id
+		JOIN notification_preferences p ON p.user_id = a.user_id
+		WHERE s.id = $1 AND u.deleted_at IS NULL
+			AND ST_DWithin(
+				a.area,
+				CASE WHEN u.role IN ('%s', '%s') OR %s
+					THEN ST_SetSRID(ST_MakePoint(s.longitude, s.latitude), 4326)::geography
+					ELSE ST_SetSRID(ST_MakePoint($2::float8, $3::float8), 4326)::geography
+				END,
+				a.radius_meters
+			)
+			AND %s
+		ORDER BY a.user_id, a.id
+	`, domain.RoleModerator, domain.RolePartner, memberOf("u.id::text"), visibleToUser("u.id::text", "u.role")),
+		sightingID, shownLng, shownLat,
+	)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m domain.AreaMatch
+		p := &m.Preferences
+
+		err = rows.Scan(&m.UserID, &m.AreaID, &p.Email, &p.InApp, &p.Push, &p.MaxPerHour, &p.QuietStart, &p.QuietEnd, &p.TimeZone, &m.RecentAlerts)
+		if err != nil {
+			return
+		}
+
+		matches = append(matches, m)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// InsertNotifications queues notifications, skipping any the user already got for the
+// same sighting over the same channel.
+func (r NotificationRepository) InsertNotifications(notifications []domain.Notification) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	for _, n := range notifications {
+		_, err = tx.Exec(`
+			INSERT INTO notifications (user_id, sighting_id, area_id, channel, status, deliver_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT DO NOTHING
+		`, n.UserID, n.SightingID, n.AreaID, n.Channel, n.Status, n.DeliverAt.UTC())
+		if err != nil {
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// ClaimNotifications takes up to limit pending notifications due at now for delivery.
+// They aren't due again until lease has passed, so other instances leave them alone
+// and ones whose delivery was cut short are retried.
+func (r NotificationRepository) ClaimNotifications(now time.Time, lease time.Duration, limit int) (notifications []domain.Notification, err error) {
+
+	rows, err := r.db.Query(`
+		WITH due AS (
+			SELECT id FROM notifications
+			WHERE status = 'pending' AND deliver_at <= $1
+			ORDER BY deliver_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE notifications n
+		SET deliver_at = $2, attempts = n.attempts + 1
+		FROM due, users u, sightings s
+		WHERE n.id = due.id AND u.id = n.user_id AND s.id = n.sighting_id
+		RETURNING n.id, n.user_id, n.sighting_id, n.area_id,
+			COALESCE((SELECT a.name FROM alert_areas a WHERE a.id = n.area_id), ''),
+			s.animal_type, n.channel, n.attempts, u.email
+	`, now.UTC(), now.Add(lease).UTC(), limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n domain.Notification
+
+		err = rows.Scan(&n.ID, &n.UserID, &n.SightingID, &n.AreaID, &n.AreaName, &n.Animal, &n.Channel, &n.Attempts, &n.Recipient)
+		if err != nil {
+			return
+		}
+
+		notifications = append(notifications, n)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (r NotificationRepository) UpdateNotificationStatus(id int, status domain.NotificationStatus) (err error) {
+
+	_, err = r.db.Exec(`
+		UPDATE notifications
+		SET status = $2
+		WHERE id = $1
+	`, id, status)
+
+	return
+}
+
+// GetNotifications returns a user's in-app notifications, newest first.
+func (r NotificationRepository) GetNotifications(userID uuid.UUID, limit int) (notifications []domain.Notification, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT n.id, n.user_id, n.sighting_id, n.area_id, COALESCE(a.name, ''), s.animal_type,
+			n.channel, n.status, n.read_at, n.created_at
+		FROM notifications n
+		JOIN sightings s ON s.id = n.sighting_id
+		LEFT JOIN alert_areas a ON a.id = n.area_id
+		WHERE n.user_id = $1 AND n.channel = $2
+		ORDER BY n.created_at DESC
+		LIMIT $3
+	`, userID, domain.ChannelInApp, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n domain.Notification
+
+		err = rows.Scan(&n.ID, &n.UserID, &n.SightingID, &n.AreaID, &n.AreaName, &n.Animal, &n.Channel, &n.Status, &n.ReadAt, &n.CreatedAt)
+		if err != nil {
+			return
+		}
+
+		notifications = append(notifications, n)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (r NotificationRepository) MarkNotificationRead(id int, userID uuid.UUID) (found bool, err error) {
+
+	res, err := r.db.Exec(`
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 AND user_id = $2 AND channel = $3
+	`, id, userID, domain.ChannelInApp)
+	if err != nil {
+		return
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	found = n > 0
+	return
+}
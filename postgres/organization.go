@@ -0,0 +1,252 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/papacatzzi-server/domain"
+)
+
+type OrganizationRepository struct {
+	db *sql.DB
+}
+
+func NewOrganizationRepository(db *sql.DB) OrganizationRepository {
+	return OrganizationRepository{db: db}
+}
+
+// InsertOrganization creates the organization with owner as its first member.
+func (r OrganizationRepository) InsertOrganization(org domain.Organization, owner uuid.UUID) (id int, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO organizations (name)
+		VALUES ($1)
+		RETURNING id
+	`, org.Name).Scan(&id)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO organization_members (organization_id, user_id, role)
+		VALUES ($1, $2, $3)
+	`, id, owner, domain.OrgRoleOwner)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+func (r OrganizationRepository) GetOrganization(id int) (org domain.Organization, err error) {
+
+	err = r.db.QueryRow(`
+		SELECT id, name, created_at
+		FROM organizations
+		WHERE id = $1
+	`, id).Scan(&org.ID, &org.Name, &org.CreatedAt)
+
+	return
+}
+
+// GetOrganizationsByMember returns the organizations userID belongs to, with their role in each.
+func (r OrganizationRepository) GetOrganizationsByMember(userID uuid.UUID) (orgs []domain.Organization, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT o.id, o.name, o.created_at, m.role
+		FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = $1
+		ORDER BY o.name
+	`, userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var org domain.Organization
+
+		err = rows.Scan(&org.ID, &org.Name, &org.CreatedAt, &org.Role)
+		if err != nil {
+			return
+		}
+
+		orgs = append(orgs, org)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (r OrganizationRepository) DeleteOrganization(id int) (err error) {
+
+	_, err = r.db.Exec(`
+		DELETE FROM organizations
+		WHERE id = $1
+	`, id)
+
+	return
+}
+
+func (r OrganizationRepository) GetMember(orgID int, userID uuid.UUID) (member domain.OrganizationMember, err error) {
+
+	err = r.db.QueryRow(`
+		SELECT m.organization_id, m.user_id, u.username, m.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1 AND m.user_id = $2
+	`, orgID, userID).Scan(&member.OrganizationID, &member.UserID, &member.Username, &member.Role, &member.CreatedAt)
+
+	return
+}
+
+func (r OrganizationRepository) GetMembers(orgID int) (members []domain.OrganizationMember, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT m.organization_id, m.user_id, u.username, m.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1
+		ORDER BY m.created_at
+	`, orgID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member domain.OrganizationMember
+
+		err = rows.Scan(&member.OrganizationID, &member.UserID, &member.Username, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return
+		}
+
+		members = append(members, member)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (r OrganizationRepository) InsertMember(member domain.OrganizationMember) (err error) {
+
+	_, err = r.db.Exec(`
+		INSERT INTO organization_members (organization_id, user_id, role)
+		VALUES ($1, $2, $3)
+	`, member.OrganizationID, member.UserID, member.Role)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		err = domain.ErrAlreadyMember
+	}
+
+	return
+}
+
+// UpdateMemberRole changes a member's role, refusing to demote the last owner.
+func (r OrganizationRepository) UpdateMemberRole(orgID int, userID uuid.UUID, role string) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if err = lockOwners(tx, orgID, userID); err != nil {
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE organization_members
+		SET role = $1
+		WHERE organization_id = $2 AND user_id = $3
+	`, role, orgID, userID)
+	if err != nil {
+		return
+	}
+
+	if role != domain.OrgRoleOwner {
+		if err = ensureOwner(tx, orgID); err != nil {
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// DeleteMember removes a member, refusing to remove the last owner.
+func (r OrganizationRepository) DeleteMember(orgID int, userID uuid.UUID) (deleted bool, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if err = lockOwners(tx, orgID, userID); err != nil {
+		return
+	}
+
+	res, err := tx.Exec(`
+		DELETE FROM organization_members
+		WHERE organization_id = $1 AND user_id = $2
+	`, orgID, userID)
+	if err != nil {
+		return
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if err = ensureOwner(tx, orgID); err != nil {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+
+	deleted = n > 0
+	return
+}
+
+// lockOwners serializes changes that could leave an organization without an owner.
+func lockOwners(tx *sql.Tx, orgID int, userID uuid.UUID) (err error) {
+
+	_, err = tx.Exec(`
+		SELECT 1 FROM organization_members
+		WHERE organization_id = $1 AND (role = $2 OR user_id = $3)
+		FOR UPDATE
+	`, orgID, domain.OrgRoleOwner, userID)
+
+	return
+}
+
+func ensureOwner(tx *sql.Tx, orgID int) (err error) {
+	var owners int
+
+	err = tx.QueryRow(`
+		SELECT count(*) FROM organization_members
+		WHERE organization_id = $1 AND role = $2
+	`, orgID, domain.OrgRoleOwner).Scan(&owners)
+	if err != nil {
+		return
+	}
+
+	if owners == 0 {
+		err = domain.ErrLastOwner
+	}
+
+	return
+}
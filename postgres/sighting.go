@@ -3,6 +3,7 @@ package postgres
 import (
 	"database/sql"
 
+	"github.com/google/uuid"
 	"github.com/papacatzzi-server/domain"
 )
 
@@ -14,54 +15,213 @@ func NewSightingRepository(db *sql.DB) SightingRepository {
 	return SightingRepository{db: db}
 }
 
+// GetSightingsByCoordinates returns the sightings inside the box as viewer may see them,
+// leaving out those less likely to be real than minConfidence. The box is matched
+// against the coordinates viewer gets back, otherwise shrinking it around a coarsened
+// sighting would give its real location away.
 func (r SightingRepository) GetSightingsByCoordinates(
+	viewer domain.Identity,
 	minLng float64,
 	minLat float64,
 	maxLng float64,
 	maxLat float64,
+	minConfidence float64,
 ) (sightings []domain.Sighting, err error) {
+	latMargin, lngMargin := BoundsMargin(minLat, maxLat)
+	visible, visibleArgs := visibleTo(viewer, 6)
 
 	rows, err := r.db.Query(`
-		SELECT id, latitude, longitude, created_at
-		FROM sightings
-		WHERE ST_MakePoint(longitude, latitude) && ST_MakeEnvelope($1, $2, $3, $4, 4326)
-	`, minLng, minLat, maxLng, maxLat)
+		SELECT s.id, s.user_id, s.organization_id, s.visibility, s.latitude, s.longitude, s.created_at, s.confidence,
+			COALESCE(s.location_precision, u.location_precision, 'exact'), `+inOrganization(6)+`
+		FROM sightings s
+		LEFT JOIN users u ON u.id::text = s.user_id
+		WHERE ST_MakePoint(s.longitude, s.latitude) && ST_MakeEnvelope($1, $2, $3, $4, 4326)
+		AND s.confidence >= $5
+		AND `+visible,
+		append([]interface{}{minLng - lngMargin, minLat - latMargin, maxLng + lngMargin, maxLat + latMargin, minConfidence}, visibleArgs...)...,
+	)
 
 	if err != nil {
 		return
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var s domain.Sighting
-		rows.Scan(&s.ID, &s.Latitude, &s.Longitude, &s.Timestamp)
+		var member bool
+
+		err = rows.Scan(&s.ID, &s.Reporter, &s.OrganizationID, &s.Visibility, &s.Latitude, &s.Longitude, &s.Timestamp, &s.Confidence, &s.Precision, &member)
 		if err != nil {
 			return
 		}
 
+		if !locate(viewer, &s, member) {
+			continue
+		}
+
+		if s.Latitude < minLat || s.Latitude > maxLat || s.Longitude < minLng || s.Longitude > maxLng {
+			continue
+		}
+
 		sightings = append(sightings, s)
 	}
 
+	err = rows.Err()
 	return
 }
 
-func (r SightingRepository) GetSightingByID(id string) (sighting domain.Sighting, err error) {
+// GetSightingByID returns sql.ErrNoRows for sightings viewer may not see, so their
+// existence isn't given away either.
+func (r SightingRepository) GetSightingByID(viewer domain.Identity, id string) (sighting domain.Sighting, err error) {
+	visible, visibleArgs := visibleTo(viewer, 2)
 
 	err = r.db.QueryRow(`
-		SELECT id, user_id, animal_type, photo_url, description, created_at
-		FROM sightings
-		WHERE id = $1
-	`, id).Scan(&sighting.ID, &sighting.Reporter, &sighting.Animal, &sighting.PhotoURL, &sighting.Description, &sighting.Timestamp)
+		SELECT s.id, s.user_id, s.organization_id, s.visibility, s.animal_type, s.photo_url, s.description, s.created_at,
+			(SELECT count(*) FROM comments c WHERE c.sighting_id = s.id AND c.status = 'visible' AND c.deleted_at IS NULL),
+			s.confidence,
+			(SELECT count(*) FROM sighting_confirmations sc WHERE sc.sighting_id = s.id)
+		FROM sightings s
+		WHERE s.id = $1 AND `+visible,
+		append([]interface{}{id}, visibleArgs...)...,
+	).Scan(
+		&sighting.ID, &sighting.Reporter, &sighting.OrganizationID, &sighting.Visibility, &sighting.Animal, &sighting.PhotoURL, &sighting.Description, &sighting.Timestamp,
+		&sighting.CommentCount, &sighting.Confidence, &sighting.ConfirmationCount,
+	)
 
 	return
 }
 
-func (r SightingRepository) InsertSighting(sighting domain.Sighting) (err error) {
+func (r SightingRepository) InsertSighting(sighting domain.Sighting) (id int, err error) {
 
-	_, err = r.db.Exec(`
+	err = r.db.QueryRow(`
 		INSERT INTO sightings 
-		(user_id, animal_type, photo_url, description, latitude, longitude, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, sighting.Reporter, sighting.Animal, sighting.PhotoURL, sighting.Description, sighting.Latitude, sighting.Longitude, sighting.Timestamp)
+		(user_id, animal_type, photo_url, description, latitude, longitude, organization_id, visibility, location_precision, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10)
+		RETURNING id
+	`, sighting.Reporter, sighting.Animal, sighting.PhotoURL, sighting.Description, sighting.Latitude, sighting.Longitude, sighting.OrganizationID, sighting.Visibility, sighting.Precision, sighting.Timestamp).Scan(&id)
+
+	return
+}
+
+// GetSightingsByReporter returns the most recent sightings reported by a user as viewer
+// may see them, all of them when limit is 0.
+func (r SightingRepository) GetSightingsByReporter(viewer domain.Identity, reporter string, limit int) (sightings []domain.Sighting, err error) {
+	var max interface{}
+	if limit > 0 {
+		max = limit
+	}
+
+	visible, visibleArgs := visibleTo(viewer, 3)
+
+	rows, err := r.db.Query(`
+		SELECT s.id, s.user_id, s.organization_id, s.visibility, s.animal_type, s.photo_url, s.description, s.latitude, s.longitude, s.created_at,
+			COALESCE(s.location_precision, u.location_precision, 'exact'), `+inOrganization(3)+`
+		FROM sightings s
+		LEFT JOIN users u ON u.id::text = s.user_id
+		WHERE s.user_id = $1 AND `+visible+`
+		ORDER BY s.created_at DESC
+		LIMIT $2`,
+		append([]interface{}{reporter, max}, visibleArgs...)...,
+	)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s domain.Sighting
+		var member bool
+
+		err = rows.Scan(&s.ID, &s.Reporter, &s.OrganizationID, &s.Visibility, &s.Animal, &s.PhotoURL, &s.Description, &s.Latitude, &s.Longitude, &s.Timestamp, &s.Precision, &member)
+		if err != nil {
+			return
+		}
+
+		if !locate(viewer, &s, member) {
+			continue
+		}
+
+		sightings = append(sightings, s)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// GetSightingForStream returns what streams need to know about a sighting, whoever can
+// see it, with the precision in effect. The location is exact, VisibleLocation decides
+// what each subscriber gets.
+func (r SightingRepository) GetSightingForStream(id int) (sighting domain.Sighting, err error) {
+
+	err = r.db.QueryRow(`
+		SELECT s.id, s.user_id, s.organization_id, s.visibility, s.latitude, s.longitude, s.created_at, s.confidence,
+			COALESCE(s.location_precision, u.location_precision, 'exact')
+		FROM sightings s
+		LEFT JOIN users u ON u.id::text = s.user_id
+		WHERE s.id = $1
+	`, id).Scan(&sighting.ID, &sighting.Reporter, &sighting.OrganizationID, &sighting.Visibility, &sighting.Latitude, &sighting.Longitude, &sighting.Timestamp, &sighting.Confidence, &sighting.Precision)
+
+	return
+}
+
+// GetSightingAudience returns the followers and organization members a sighting is
+// limited to. It only needs the sighting's reporter, visibility and organization, so it
+// works for sightings that were just deleted too.
+func (r SightingRepository) GetSightingAudience(sighting domain.Sighting) (audience domain.SightingAudience, err error) {
+	if sighting.Visibility == domain.VisibilityFollowers {
+		audience.Followers, err = r.getUserIDs(`
+			SELECT follower_id
+			FROM follows
+			WHERE followee_id::text = $1
+		`, sighting.Reporter)
+		if err != nil {
+			return
+		}
+	}
+
+	if sighting.OrganizationID != nil {
+		audience.Members, err = r.getUserIDs(`
+			SELECT user_id
+			FROM organization_members
+			WHERE organization_id = $1
+		`, *sighting.OrganizationID)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (r SightingRepository) getUserIDs(query string, arg interface{}) (ids map[uuid.UUID]bool, err error) {
+
+	rows, err := r.db.Query(query, arg)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	ids = make(map[uuid.UUID]bool)
+	for rows.Next() {
+		var id uuid.UUID
+
+		if err = rows.Scan(&id); err != nil {
+			return
+		}
+
+		ids[id] = true
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (r SightingRepository) DeleteSighting(id int) (err error) {
+
+	_, err = r.db.Exec(`
+		DELETE FROM sightings
+		WHERE id = $1
+	`, id)
 
 	return
 }
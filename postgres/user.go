@@ -3,6 +3,7 @@ package postgres
 import (
 	"database/sql"
 
+	"github.com/google/uuid"
 	"github.com/papacatzzi-server/domain"
 )
 
@@ -19,7 +20,7 @@ func (r UserRepository) GetUserByName(username string) (user domain.User, err er
 	err = r.db.QueryRow(`
 		SELECT username
 		FROM users
-		WHERE username = $1
+		WHERE lower(username) = lower($1)
 	`, username).Scan(&user.Username)
 
 	return
@@ -28,48 +29,51 @@ func (r UserRepository) GetUserByName(username string) (user domain.User, err er
 func (r UserRepository) GetUserByEmail(email string) (user domain.User, err error) {
 
 	err = r.db.QueryRow(`
-		SELECT id, username, email, password, is_active, oauth_id
+		SELECT id, username, email, password, role, is_active, deleted_at, totp_secret, totp_enabled
 		FROM users
-		WHERE email = $1
-	`, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.IsActive, &user.OAuthID)
+		WHERE lower(email) = lower($1)
+	`, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role, &user.IsActive, &user.DeletedAt, &user.TOTPSecret, &user.TOTPEnabled)
 
 	return
 }
 
-func (r UserRepository) GetUserByOAuthID(id string) (user domain.User, err error) {
+// GetProfileByName returns only what is shown on a user's public profile.
+func (r UserRepository) GetProfileByName(username string) (user domain.User, err error) {
 
 	err = r.db.QueryRow(`
-		SELECT id, email
+		SELECT id, username, created_at, display_name, bio, avatar_url, home_area
 		FROM users
-		WHERE oauth_id = $1
-	`, id).Scan(&user.ID, &user.Email)
+		WHERE lower(username) = lower($1) AND is_active
+	`, username).Scan(&user.ID, &user.Username, &user.CreatedAt, &user.DisplayName, &user.Bio, &user.AvatarURL, &user.HomeArea)
 
 	return
 }
 
-func (r UserRepository) InsertUser(user domain.User) (err error) {
+func (r UserRepository) GetUserByID(id uuid.UUID) (user domain.User, err error) {
 
-	_, err = r.db.Exec(`
-		INSERT INTO users 
-		(username, email, password, created_at, is_active, oauth_id)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, user.Username, user.Email, user.Password, user.CreatedAt, user.IsActive, user.OAuthID)
+	err = r.db.QueryRow(`
+		SELECT id, username, email, password, role, created_at, is_active, deleted_at, display_name, bio, avatar_url, home_area, location_precision, totp_secret, totp_enabled
+		FROM users
+		WHERE id = $1
+	`, id).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role, &user.CreatedAt, &user.IsActive, &user.DeletedAt, &user.DisplayName, &user.Bio, &user.AvatarURL, &user.HomeArea, &user.LocationPrecision, &user.TOTPSecret, &user.TOTPEnabled)
 
 	return
 }
 
-func (r UserRepository) UpdateOAuthID(oAuthID string, email string) (err error) {
+func (r UserRepository) InsertUser(user domain.User) (id uuid.UUID, err error) {
 
-	_, err = r.db.Exec(`
-		UPDATE users 
-		SET oauth_id = $1
-		WHERE email = $2
-	`, oAuthID, email)
+	err = r.db.QueryRow(`
+		INSERT INTO users 
+		(username, email, password, created_at, is_active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, user.Username, user.Email, user.Password, user.CreatedAt, user.IsActive).Scan(&id)
 
+	err = translateError(err)
 	return
 }
 
-func (r UserRepository) UpdatePassword(password []byte, email string) (err error) {
+func (r UserRepository) UpdatePassword(password string, email string) (err error) {
 
 	_, err = r.db.Exec(`
 		UPDATE users 
@@ -79,3 +83,27 @@ func (r UserRepository) UpdatePassword(password []byte, email string) (err error
 
 	return
 }
+
+func (r UserRepository) UpdateProfile(user domain.User) (err error) {
+
+	_, err = r.db.Exec(`
+		UPDATE users
+		SET username = $1, display_name = $2, bio = $3, avatar_url = $4, home_area = $5, location_precision = $6
+		WHERE id = $7
+	`, user.Username, user.DisplayName, user.Bio, user.AvatarURL, user.HomeArea, user.LocationPrecision, user.ID)
+
+	err = translateError(err)
+	return
+}
+
+func (r UserRepository) UpdateEmail(id uuid.UUID, email string) (err error) {
+
+	_, err = r.db.Exec(`
+		UPDATE users
+		SET email = $1
+		WHERE id = $2
+	`, email, id)
+
+	err = translateError(err)
+	return
+}
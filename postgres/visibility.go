@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"fmt"
+
+	"github.com/papacatzzi-server/domain"
+)
+
+// visibleTo returns a condition on sightings aliased as s that holds for the sightings
+// viewer may see, and the arguments it needs, numbered from arg. Anonymous viewers have
+// a zero UserID that matches nobody, so they only get public sightings.
+//
+// Moderators see everything but private sightings. Members of the organization a
+// sighting is shared with see it unless it is private, whatever else it is limited to.
+func visibleTo(viewer domain.Identity, arg int) (condition string, args []interface{}) {
+	condition = visibleToUser(fmt.Sprintf("$%d", arg), fmt.Sprintf("$%d", arg+1))
+	args = []interface{}{viewer.UserID.String(), viewer.Role}
+	return
+}
+
+// visibleToUser is visibleTo for a viewer given as SQL expressions, their ID as text
+// and their role, so one query can check it for many viewers.
+func visibleToUser(userID string, role string) string {
+	return fmt.Sprintf(`(
+		s.visibility = 'public'
+		OR s.user_id = %[1]s
+		OR (%[2]s = '%[3]s' AND s.visibility <> 'private')
+		OR (s.visibility = 'followers' AND EXISTS (
+			SELECT 1 FROM follows f
+			WHERE f.follower_id::text = %[1]s AND f.followee_id::text = s.user_id
+		))
+		OR (s.visibility <> 'private' AND %[4]s)
+	)`, userID, role, domain.RoleModerator, memberOf(userID))
+}
+
+// VisibleLocation is visibleTo and locate for a sighting already in memory, read with
+// GetSightingForStream. It returns the sighting as viewer would read it, and false when
+// they can't see it or where it is.
+func VisibleLocation(viewer domain.Identity, sighting domain.Sighting, audience domain.SightingAudience) (domain.Sighting, bool) {
+	member := audience.Members[viewer.UserID]
+
+	visible := sighting.Visibility == domain.VisibilityPublic ||
+		sighting.Reporter == viewer.UserID.String() ||
+		(sighting.Visibility != domain.VisibilityPrivate && (viewer.Role == domain.RoleModerator || member)) ||
+		(sighting.Visibility == domain.VisibilityFollowers && audience.Followers[viewer.UserID])
+
+	if !visible {
+		return domain.Sighting{}, false
+	}
+
+	if !locate(viewer, &sighting, member) {
+		return domain.Sighting{}, false
+	}
+
+	return sighting, true
+}
+
+// inOrganization returns a condition that holds when the viewer whose ID is argument
+// arg belongs to the organization sighting s is shared with.
+func inOrganization(arg int) string {
+	return memberOf(fmt.Sprintf("$%d", arg))
+}
+
+func memberOf(userID string) string {
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM organization_members m
+		WHERE m.organization_id = s.organization_id AND m.user_id::text = %s
+	)`, userID)
+}
@@ -0,0 +1,168 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+)
+
+func TestVisibleTo(t *testing.T) {
+	user := uuid.New()
+
+	tests := []struct {
+		name     string
+		viewer   domain.Identity
+		arg      int
+		want     []string
+		dontWant []string
+		args     []interface{}
+	}{
+		{
+			name:     "anonymous",
+			viewer:   domain.Identity{},
+			arg:      1,
+			want:     []string{"s.user_id = $1", "$2 = 'moderator'", "f.follower_id::text = $1", "m.user_id::text = $1"},
+			dontWant: []string{"$3"},
+			args:     []interface{}{uuid.Nil.String(), ""},
+		},
+		{
+			name:     "user after other arguments",
+			viewer:   domain.Identity{UserID: user, Role: domain.RoleUser},
+			arg:      3,
+			want:     []string{"s.user_id = $3", "$4 = 'moderator'", "f.follower_id::text = $3", "m.user_id::text = $3"},
+			dontWant: []string{"$1", "$2", "$5"},
+			args:     []interface{}{user.String(), domain.RoleUser},
+		},
+		{
+			name:   "moderator",
+			viewer: domain.Identity{UserID: user, Role: domain.RoleModerator},
+			arg:    2,
+			want:   []string{"s.user_id = $2", "$3 = 'moderator'"},
+			args:   []interface{}{user.String(), domain.RoleModerator},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, args := visibleTo(tt.viewer, tt.arg)
+
+			for _, s := range tt.want {
+				if !strings.Contains(condition, s) {
+					t.Errorf("condition does not contain %q:\n%s", s, condition)
+				}
+			}
+
+			for _, s := range tt.dontWant {
+				if strings.Contains(condition, s) {
+					t.Errorf("condition contains %q:\n%s", s, condition)
+				}
+			}
+
+			if len(args) != len(tt.args) {
+				t.Fatalf("got %d args, want %d", len(args), len(tt.args))
+			}
+
+			for i := range args {
+				if args[i] != tt.args[i] {
+					t.Errorf("args[%d] = %v, want %v", i, args[i], tt.args[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVisibleToUser(t *testing.T) {
+	condition := visibleToUser("a.user_id::text", "u.role")
+
+	// private sightings are only ever seen by their reporter
+	for _, s := range []string{
+		"s.visibility = 'public'",
+		"s.user_id = a.user_id::text",
+		"(u.role = 'moderator' AND s.visibility <> 'private')",
+		"s.visibility = 'followers' AND EXISTS",
+		"f.follower_id::text = a.user_id::text AND f.followee_id::text = s.user_id",
+		"s.visibility <> 'private' AND EXISTS",
+		"m.organization_id = s.organization_id AND m.user_id::text = a.user_id::text",
+	} {
+		if !strings.Contains(condition, s) {
+			t.Errorf("condition does not contain %q:\n%s", s, condition)
+		}
+	}
+
+	if strings.Contains(condition, "$") {
+		t.Errorf("condition has placeholders:\n%s", condition)
+	}
+}
+
+func TestInOrganization(t *testing.T) {
+	if got := inOrganization(5); !strings.Contains(got, "m.user_id::text = $5") {
+		t.Errorf("inOrganization(5) = %s, want it to compare members to $5", got)
+	}
+}
+
+func TestVisibleLocation(t *testing.T) {
+	reporter, follower, member, stranger := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	org := 4
+
+	audience := domain.SightingAudience{
+		Followers: map[uuid.UUID]bool{follower: true},
+		Members:   map[uuid.UUID]bool{member: true},
+	}
+
+	tests := []struct {
+		name       string
+		viewer     domain.Identity
+		visibility domain.Visibility
+		precision  domain.LocationPrecision
+		visible    bool
+		exact      bool
+	}{
+		{"public to anonymous", domain.Identity{}, domain.VisibilityPublic, domain.PrecisionExact, true, true},
+		{"coarsened to anonymous", domain.Identity{}, domain.VisibilityPublic, domain.Precision1km, true, false},
+		{"hidden to anonymous", domain.Identity{}, domain.VisibilityPublic, domain.PrecisionHidden, false, false},
+		{"hidden to the reporter", domain.Identity{UserID: reporter}, domain.VisibilityPublic, domain.PrecisionHidden, true, true},
+		{"followers only to a follower", domain.Identity{UserID: follower}, domain.VisibilityFollowers, domain.PrecisionExact, true, true},
+		{"followers only to a stranger", domain.Identity{UserID: stranger}, domain.VisibilityFollowers, domain.PrecisionExact, false, false},
+		{"followers only to anonymous", domain.Identity{}, domain.VisibilityFollowers, domain.PrecisionExact, false, false},
+		{"coarsened followers only to a follower", domain.Identity{UserID: follower}, domain.VisibilityFollowers, domain.Precision100m, true, false},
+		{"organization to a member", domain.Identity{UserID: member}, domain.VisibilityOrganization, domain.PrecisionHidden, true, true},
+		{"organization to a follower", domain.Identity{UserID: follower}, domain.VisibilityOrganization, domain.PrecisionExact, false, false},
+		{"organization to a moderator", domain.Identity{UserID: stranger, Role: domain.RoleModerator}, domain.VisibilityOrganization, domain.PrecisionExact, true, true},
+		{"private to a member", domain.Identity{UserID: member}, domain.VisibilityPrivate, domain.PrecisionExact, false, false},
+		{"private to a moderator", domain.Identity{UserID: stranger, Role: domain.RoleModerator}, domain.VisibilityPrivate, domain.PrecisionExact, false, false},
+		{"private to the reporter", domain.Identity{UserID: reporter}, domain.VisibilityPrivate, domain.PrecisionExact, true, true},
+		{"public and coarsened to a member", domain.Identity{UserID: member}, domain.VisibilityPublic, domain.Precision1km, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := domain.Sighting{
+				ID:             9,
+				Reporter:       reporter.String(),
+				Visibility:     tt.visibility,
+				OrganizationID: &org,
+				Precision:      tt.precision,
+				Latitude:       48.8566,
+				Longitude:      2.3522,
+			}
+
+			got, visible := VisibleLocation(tt.viewer, s, audience)
+			if visible != tt.visible {
+				t.Fatalf("VisibleLocation() visible = %v, want %v", visible, tt.visible)
+			}
+
+			if !visible {
+				if got != (domain.Sighting{}) {
+					t.Errorf("VisibleLocation() returned %+v for a sighting viewer can't see", got)
+				}
+				return
+			}
+
+			if exact := got.Latitude == s.Latitude && got.Longitude == s.Longitude; exact != tt.exact {
+				t.Errorf("exact location shown = %v, want %v", exact, tt.exact)
+			}
+		})
+	}
+}
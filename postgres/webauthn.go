@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+)
+
+func (r UserRepository) GetWebAuthnCredentials(userID uuid.UUID) (credentials []domain.WebAuthnCredential, err error) {
+
+	rows, err := r.db.Query(`
+		SELECT user_id, name, credential, created_at, last_used_at
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c domain.WebAuthnCredential
+		var data []byte
+
+		err = rows.Scan(&c.UserID, &c.Name, &data, &c.CreatedAt, &c.LastUsedAt)
+		if err != nil {
+			return
+		}
+
+		if err = json.Unmarshal(data, &c.Credential); err != nil {
+			return
+		}
+
+		credentials = append(credentials, c)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (r UserRepository) InsertWebAuthnCredential(credential domain.WebAuthnCredential) (err error) {
+	data, err := json.Marshal(credential.Credential)
+	if err != nil {
+		return
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO webauthn_credentials
+		(id, user_id, name, credential, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, credential.Credential.ID, credential.UserID, credential.Name, data, credential.CreatedAt)
+
+	return
+}
+
+// UpdateWebAuthnCredential stores the sign counter and flags after a successful login.
+func (r UserRepository) UpdateWebAuthnCredential(credential domain.WebAuthnCredential, usedAt time.Time) (err error) {
+	data, err := json.Marshal(credential.Credential)
+	if err != nil {
+		return
+	}
+
+	_, err = r.db.Exec(`
+		UPDATE webauthn_credentials
+		SET credential = $1, last_used_at = $2
+		WHERE id = $3
+	`, data, usedAt, credential.Credential.ID)
+
+	return
+}
+
+func (r UserRepository) DeleteWebAuthnCredential(userID uuid.UUID, id []byte) (deleted bool, err error) {
+
+	res, err := r.db.Exec(`
+		DELETE FROM webauthn_credentials
+		WHERE user_id = $1 AND id = $2
+	`, userID, id)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	deleted = affected > 0
+	return
+}
@@ -0,0 +1,106 @@
+// Package ratelimit implements a Redis backed sliding window rate limiter that
+// is shared by every server instance.
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const keyPrefix = "RATE_LIMIT"
+
+// Rate allows Limit hits within any Window long period. A zero Limit disables it.
+type Rate struct {
+	Limit  int
+	Window time.Duration
+}
+
+type Limiter struct {
+	redis *redis.Client
+}
+
+func NewLimiter(redis *redis.Client) Limiter {
+	return Limiter{redis: redis}
+}
+
+// Bucket is one rate tracked under its own key.
+type Bucket struct {
+	Key  string
+	Rate Rate
+}
+
+// slidingWindowScript keeps one sorted set member per hit scored by its time in
+// milliseconds. Hits that fell out of a window are trimmed before counting. A hit
+// is only recorded when every bucket has room for it, so a rejected request costs
+// nothing and clients that back off recover on time.
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local wait = -1
+
+for i, key in ipairs(KEYS) do
+	local window = tonumber(ARGV[i * 2 + 1])
+	local limit = tonumber(ARGV[i * 2 + 2])
+
+	redis.call("ZREMRANGEBYSCORE", key, 0, now - window)
+
+	if redis.call("ZCARD", key) >= limit then
+		local oldest = redis.call("ZRANGE", key, 0, 0, "WITHSCORES")
+		wait = math.max(wait, tonumber(oldest[2]) + window - now)
+	end
+end
+
+if wait >= 0 then
+	return wait
+end
+
+for i, key in ipairs(KEYS) do
+	redis.call("ZADD", key, now, ARGV[2])
+	redis.call("PEXPIRE", key, ARGV[i * 2 + 1])
+end
+
+return -1
+`)
+
+// Allow records a hit for key and reports whether it is within rate. When it is
+// not, retryAfter is how long until the oldest hit leaves the window.
+func (l Limiter) Allow(ctx context.Context, key string, rate Rate) (allowed bool, retryAfter time.Duration, err error) {
+	return l.AllowAll(ctx, Bucket{Key: key, Rate: rate})
+}
+
+// AllowAll records a hit in every bucket if all of them are within their rate,
+// and in none of them otherwise. retryAfter is how long until every bucket has
+// room again.
+func (l Limiter) AllowAll(ctx context.Context, buckets ...Bucket) (allowed bool, retryAfter time.Duration, err error) {
+	now := time.Now().UnixMilli()
+
+	keys := []string{}
+	args := []interface{}{now, strconv.FormatInt(now, 10) + "-" + uuid.NewString()}
+
+	for _, b := range buckets {
+		if b.Rate.Limit <= 0 {
+			continue
+		}
+
+		keys = append(keys, keyPrefix+"_"+b.Key)
+		args = append(args, b.Rate.Window.Milliseconds(), b.Rate.Limit)
+	}
+
+	if len(keys) == 0 {
+		return true, 0, nil
+	}
+
+	wait, err := slidingWindowScript.Run(ctx, l.redis, keys, args...).Int64()
+	if err != nil {
+		return
+	}
+
+	if wait < 0 {
+		return true, 0, nil
+	}
+
+	return false, time.Duration(wait+1) * time.Millisecond, nil
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestLimiter(t *testing.T) (Limiter, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	return NewLimiter(redis.NewClient(&redis.Options{Addr: mr.Addr()})), mr
+}
+
+func TestAllow(t *testing.T) {
+	limiter, _ := newTestLimiter(t)
+	rate := Rate{Limit: 3, Window: time.Minute}
+
+	for i := 0; i < rate.Limit; i++ {
+		if allowed, _, err := limiter.Allow(context.Background(), "key", rate); err != nil || !allowed {
+			t.Fatalf("hit %d: allowed = %v, err = %v", i+1, allowed, err)
+		}
+	}
+
+	allowed, retryAfter, err := limiter.Allow(context.Background(), "key", rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if allowed {
+		t.Error("hit over the limit was allowed")
+	}
+
+	if retryAfter <= 0 || retryAfter > rate.Window+time.Millisecond {
+		t.Errorf("retryAfter = %v, want within the window", retryAfter)
+	}
+}
+
+func TestAllowAllRecordsNothingWhenRejected(t *testing.T) {
+	limiter, mr := newTestLimiter(t)
+
+	wide := Bucket{Key: "wide", Rate: Rate{Limit: 10, Window: time.Minute}}
+	narrow := Bucket{Key: "narrow", Rate: Rate{Limit: 1, Window: time.Minute}}
+
+	for i, want := range []bool{true, false, false} {
+		allowed, _, err := limiter.AllowAll(context.Background(), wide, narrow)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if allowed != want {
+			t.Errorf("hit %d: allowed = %v, want %v", i+1, allowed, want)
+		}
+	}
+
+	hits, err := mr.ZMembers(keyPrefix + "_wide")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hits) != 1 {
+		t.Errorf("wide bucket recorded %d hits, want only the allowed one", len(hits))
+	}
+}
+
+func TestAllowAllSkipsDisabledRates(t *testing.T) {
+	limiter, mr := newTestLimiter(t)
+
+	allowed, _, err := limiter.AllowAll(context.Background(), Bucket{Key: "off"})
+	if err != nil || !allowed {
+		t.Fatalf("allowed = %v, err = %v", allowed, err)
+	}
+
+	if mr.Exists(keyPrefix + "_off") {
+		t.Error("a disabled rate was tracked")
+	}
+}
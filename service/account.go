@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/papacatzzi-server/domain"
+	smtp "github.com/papacatzzi-server/email"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	EmailChangeKey         = "EMAIL_CHANGE"
+	EmailChangeAttemptsKey = "EMAIL_CHANGE_ATTEMPTS"
+)
+
+// ChangePassword replaces the password of a logged in user. Users that only ever
+// logged in with a provider or passkey have no current password to give.
+func (svc *AuthService) ChangePassword(identity domain.Identity, currentPassword string, newPassword string) (err error) {
+	user, err := svc.getUser(identity)
+	if err != nil {
+		return
+	}
+
+	if user.Password != "" {
+		if err = svc.verifyPassword(user, currentPassword); err != nil {
+			return
+		}
+
+		if currentPassword == newPassword {
+			err = domain.ErrSamePassword
+			return
+		}
+	}
+
+	hashed, err := svc.hashNewPassword(newPassword, user.Email, user.Username)
+	if err != nil {
+		return
+	}
+
+	err = svc.repository.UpdatePassword(hashed, user.Email)
+	if err != nil {
+		err = fmt.Errorf("failed to update password: %v", err)
+		return
+	}
+
+	// keep the device that changed the password logged in, but nobody else
+	err = svc.RevokeOtherSessions(user.ID, identity.SessionID)
+	if err != nil {
+		return
+	}
+
+	svc.audit(user.ID, domain.AuditPasswordChanged, "", domain.Session{ID: identity.SessionID})
+
+	go func() {
+		data := map[string]string{
+			"username": user.Username,
+			"link":     svc.frontendURL + "/forgot-password",
+		}
+
+		content := smtp.EmailContent{
+			Subject:   "Your password was changed",
+			Recipient: user.Email,
+			Body:      data,
+		}
+
+		svc.mailer.Send("email/templates/password-changed.html", content)
+	}()
+
+	return
+}
+
+// BeginEmailChange sends a code to the new address. Nothing changes until
+// ConfirmEmailChange sees that code, so a typo can't lock the user out.
+func (svc *AuthService) BeginEmailChange(identity domain.Identity, password string, email string) (err error) {
+	email = normalizeEmail(email)
+
+	user, err := svc.getUser(identity)
+	if err != nil {
+		return
+	}
+
+	if user.Password != "" {
+		if err = svc.verifyPassword(user, password); err != nil {
+			return
+		}
+	}
+
+	// like sign up, don't reveal that the address belongs to someone, the code just never arrives
+	_, err = svc.repository.GetUserByEmail(email)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		err = fmt.Errorf("failed to fetch email from db: %v", err)
+		return
+	}
+
+	code, err := generateCode(6)
+	if err != nil {
+		err = fmt.Errorf("failed to generate verification code: %v", err)
+		return
+	}
+
+	key := appendToKey(EmailChangeKey, user.ID.String())
+	attemptsKey := appendToKey(EmailChangeAttemptsKey, user.ID.String())
+
+	_, err = svc.redis.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.HSet(context.Background(), key, map[string]interface{}{
+			"email": email,
+			"code":  hashVerificationCode(email, code),
+		})
+		pipe.Expire(context.Background(), key, VerificationCodeExpiration)
+		pipe.Del(context.Background(), attemptsKey)
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to cache verification code: %v", err)
+		return
+	}
+
+	go func() {
+		data := map[string]string{
+			"username": user.Username,
+			"code":     code,
+		}
+
+		content := smtp.EmailContent{
+			Subject:   "Confirm your new email address",
+			Recipient: email,
+			Body:      data,
+		}
+
+		svc.mailer.Send("email/templates/email-change.html", content)
+	}()
+
+	return
+}
+
+// ConfirmEmailChange swaps the email once the code sent to the new address is given,
+// and tells the old address about it in case the account was taken over.
+func (svc *AuthService) ConfirmEmailChange(identity domain.Identity, code string) (err error) {
+	user, err := svc.getUser(identity)
+	if err != nil {
+		return
+	}
+
+	key := appendToKey(EmailChangeKey, user.ID.String())
+	attemptsKey := appendToKey(EmailChangeAttemptsKey, user.ID.String())
+
+	pending, err := svc.redis.HGetAll(context.Background(), key).Result()
+	if err != nil {
+		err = fmt.Errorf("failed to get verification code: %v", err)
+		return
+	}
+
+	if len(pending) == 0 {
+		err = domain.ErrIncorrectCode
+		return
+	}
+
+	email := pending["email"]
+
+	if subtle.ConstantTimeCompare([]byte(pending["code"]), []byte(hashVerificationCode(email, code))) != 1 {
+		err = svc.recordFailedVerification(key, attemptsKey)
+		return
+	}
+
+	// the address may have been registered since the code was sent
+	_, err = svc.repository.GetUserByEmail(email)
+	if err == nil {
+		err = domain.ErrEmailTaken
+		return
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		err = fmt.Errorf("failed to fetch email from db: %v", err)
+		return
+	}
+
+	err = svc.repository.UpdateEmail(user.ID, email)
+	if err != nil {
+		err = fmt.Errorf("failed to update email: %w", err)
+		return
+	}
+
+	svc.redis.Del(context.Background(), key, attemptsKey)
+
+	svc.audit(user.ID, domain.AuditEmailChanged, "", domain.Session{ID: identity.SessionID})
+
+	go func() {
+		data := map[string]string{
+			"username": user.Username,
+			"email":    email,
+		}
+
+		content := smtp.EmailContent{
+			Subject:   "Your email address was changed",
+			Recipient: user.Email,
+			Body:      data,
+		}
+
+		svc.mailer.Send("email/templates/email-changed.html", content)
+	}()
+
+	return
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+)
+
+// newTestAccount returns a service for a user whose password is current.
+func newTestAccount(t *testing.T, current string) (AuthService, *testDB, domain.User) {
+	t.Helper()
+
+	user := testUser()
+	svc, db, _ := newTestAuthService(t, user)
+
+	hashed, err := svc.hasher.Hash(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.user.Password = hashed
+
+	return svc, db, db.user
+}
+
+func TestChangePassword(t *testing.T) {
+	const current = "old tabby password"
+
+	tests := []struct {
+		name      string
+		current   string
+		next      string
+		noCurrent bool
+		want      error
+	}{
+		{name: "changed", current: current, next: "new calico password"},
+		{name: "wrong current password", current: "guessed password", next: "new calico password", want: domain.ErrInvalidCredentials},
+		{name: "same password", current: current, next: current, want: domain.ErrSamePassword},
+		{name: "no password yet", noCurrent: true, next: "new calico password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, db, user := newTestAccount(t, current)
+			if tt.noCurrent {
+				db.user.Password = ""
+			}
+
+			session := mustCreateSession(t, &svc, user)
+			other := mustCreateSession(t, &svc, user)
+
+			err := svc.ChangePassword(domain.Identity{UserID: user.ID, SessionID: session.ID}, tt.current, tt.next)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ChangePassword() error = %v, want %v", err, tt.want)
+			}
+
+			// only a successful change logs out the other devices
+			_, err = svc.getSession(other.ID)
+			if revoked := errors.Is(err, domain.ErrSessionNotFound); revoked != (tt.want == nil) {
+				t.Errorf("other session revoked = %v, want %v", revoked, tt.want == nil)
+			}
+
+			if _, err = svc.getSession(session.ID); err != nil {
+				t.Errorf("the session that changed the password was revoked: %v", err)
+			}
+		})
+	}
+}
+
+func TestBeginEmailChange(t *testing.T) {
+	const current = "old tabby password"
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		want     error
+		pending  bool
+	}{
+		{name: "new address", password: current, email: "new@example.com", pending: true},
+		{name: "wrong password", password: "guessed password", email: "new@example.com", want: domain.ErrInvalidCredentials},
+		{name: "registered address", password: current, email: "tabby@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, db, user := newTestAccount(t, current)
+			db.others = []domain.User{{ID: uuid.New(), Username: "tabby", Email: "tabby@example.com"}}
+
+			err := svc.BeginEmailChange(domain.Identity{UserID: user.ID}, tt.password, tt.email)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("BeginEmailChange() error = %v, want %v", err, tt.want)
+			}
+
+			// a registered address gets the same answer, but no code
+			pending, _ := svc.redis.HGet(context.Background(), appendToKey(EmailChangeKey, user.ID.String()), "email").Result()
+			if (pending != "") != tt.pending {
+				t.Errorf("pending change = %q, want one: %v", pending, tt.pending)
+			}
+		})
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		attempts []string
+		code     string
+		want     error
+	}{
+		{name: "correct code", email: "new@example.com", code: "123456"},
+		{name: "wrong code", email: "new@example.com", code: "654321", want: domain.ErrIncorrectCode},
+		{name: "nothing pending", code: "123456", want: domain.ErrIncorrectCode},
+		{
+			name:     "too many wrong codes",
+			email:    "new@example.com",
+			attempts: []string{"000000", "000001", "000002", "000003"},
+			code:     "000004",
+			want:     domain.ErrTooManyAttempts,
+		},
+		{name: "address registered since", email: "tabby@example.com", code: "123456", want: domain.ErrEmailTaken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := testUser()
+			svc, db, mr := newTestAuthService(t, user)
+			db.others = []domain.User{{ID: uuid.New(), Username: "tabby", Email: "tabby@example.com"}}
+
+			if tt.email != "" {
+				mr.HSet(appendToKey(EmailChangeKey, user.ID.String()), "email", tt.email, "code", hashVerificationCode(tt.email, "123456"))
+			}
+
+			identity := domain.Identity{UserID: user.ID}
+			for _, code := range tt.attempts {
+				svc.ConfirmEmailChange(identity, code)
+			}
+
+			if err := svc.ConfirmEmailChange(identity, tt.code); !errors.Is(err, tt.want) {
+				t.Errorf("ConfirmEmailChange() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+	"github.com/papacatzzi-server/log"
+	"github.com/papacatzzi-server/postgres"
+)
+
+// recordAuditEvent saves a security relevant change to an account. The change already
+// happened, so failing to record it is only logged.
+func recordAuditEvent(logger log.Logger, repo postgres.UserRepository, userID uuid.UUID, eventType domain.AuditEventType, detail string, client domain.Session) {
+	err := repo.InsertAuditEvent(domain.AuditEvent{
+		UserID:    userID,
+		Type:      eventType,
+		Detail:    detail,
+		SessionID: client.ID,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+	})
+	if err != nil {
+		logger.Error().Err(err).Str("type", string(eventType)).Msg("failed to record audit event")
+	}
+}
+
+func (svc *AuthService) audit(userID uuid.UUID, eventType domain.AuditEventType, detail string, client domain.Session) {
+	recordAuditEvent(svc.logger, svc.repository, userID, eventType, detail, client)
+}
+
+func (svc *UserService) audit(userID uuid.UUID, eventType domain.AuditEventType, detail string, client domain.Session) {
+	recordAuditEvent(svc.logger, svc.repository, userID, eventType, detail, client)
+}
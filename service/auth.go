@@ -2,50 +2,110 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"math/rand"
-	"os"
+	"math/big"
+	"strings"
 	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/papacatzzi-server/domain"
 	smtp "github.com/papacatzzi-server/email"
+	"github.com/papacatzzi-server/keys"
+	"github.com/papacatzzi-server/log"
+	"github.com/papacatzzi-server/password"
 	"github.com/papacatzzi-server/postgres"
 	"github.com/redis/go-redis/v9"
-	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
-
 const (
-	SignUpVerificationKey = "SIGN_UP_VERIFICATION"
-	VerificationCompleted = "VERIFICATION_COMPLETED"
+	SignUpVerificationKey         = "SIGN_UP_VERIFICATION"
+	SignUpVerificationAttemptsKey = "SIGN_UP_VERIFICATION_ATTEMPTS"
+	VerificationCompleted         = "VERIFICATION_COMPLETED"
 
 	BlacklistKey     = "BLACKLIST"
 	TokenBlacklisted = "TOKEN_BLACKLISTED"
 
+	RefreshTokenKey        = "REFRESH_TOKEN"
+	RotatedRefreshTokenKey = "ROTATED_REFRESH_TOKEN"
+	PasswordResetTokenKey  = "PASSWORD_RESET_TOKEN"
+	SessionKey             = "SESSION"
+	UserSessionsKey        = "USER_SESSIONS"
+
+	AccessTokenType        = "access"
+	RefreshTokenType       = "refresh"
+	PasswordResetTokenType = "password_reset"
+
 	AccessTokenExpiration        = time.Minute * 15
 	RefreshTokenExpiration       = time.Hour * 24 * 7
 	PasswordResetTokenExpiration = time.Minute * 5
+	VerificationCodeExpiration   = time.Minute * 5
+
+	// a code is invalidated after this many wrong guesses
+	maxVerificationAttempts = 5
 )
 
 type AuthService struct {
+	logger     log.Logger
 	repository postgres.UserRepository
 	redis      *redis.Client
 	mailer     smtp.Mailer
+	keys       *keys.KeyRing
+	webauthn   *webauthn.WebAuthn
+	hasher     password.Hasher
+	policy     password.Policy
+
+	// frontendURL is the web app that links in emails open.
+	frontendURL string
+
+	// dummyPasswordHash is verified against when a login names an unknown email.
+	dummyPasswordHash string
 }
 
-func NewAuthService(repo postgres.UserRepository, redis *redis.Client, mailer smtp.Mailer) AuthService {
-	return AuthService{repository: repo, redis: redis, mailer: mailer}
+func NewAuthService(
+	logger log.Logger,
+	repo postgres.UserRepository,
+	redis *redis.Client,
+	mailer smtp.Mailer,
+	keyRing *keys.KeyRing,
+	webAuthn *webauthn.WebAuthn,
+	hasher password.Hasher,
+	policy password.Policy,
+	frontendURL string,
+) AuthService {
+	dummy, _ := hasher.Hash("papacatzzi-dummy-password")
+
+	return AuthService{
+		logger:            logger,
+		repository:        repo,
+		redis:             redis,
+		mailer:            mailer,
+		keys:              keyRing,
+		webauthn:          webAuthn,
+		hasher:            hasher,
+		policy:            policy,
+		frontendURL:       frontendURL,
+		dummyPasswordHash: dummy,
+	}
 }
 
-func (svc *AuthService) Login(email string, password string) (accessToken string, refreshToken string, err error) {
+// Login returns an mfa token instead of access and refresh tokens when the user
+// has two-factor authentication enabled, see CompleteMFALogin.
+func (svc *AuthService) Login(email string, password string, client domain.Session) (accessToken string, refreshToken string, mfaToken string, err error) {
+	email = normalizeEmail(email)
+
 	user, err := svc.repository.GetUserByEmail(email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
+			// spend the same time as a real check so response times don't reveal unknown emails
+			svc.hasher.Verify(password, svc.dummyPasswordHash)
 			err = domain.ErrInvalidCredentials
 			return
 		}
@@ -53,50 +113,53 @@ func (svc *AuthService) Login(email string, password string) (accessToken string
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err != nil {
-		err = domain.ErrInvalidCredentials
-		return
-	}
-
-	accessToken, err = createToken(user, AccessTokenExpiration)
-	if err != nil {
-		err = fmt.Errorf("failed to create access token: %v", err)
+	if err = svc.verifyPassword(user, password); err != nil {
+		if errors.Is(err, domain.ErrInvalidCredentials) {
+			svc.audit(user.ID, domain.AuditLoginFailed, "", client)
+		}
 		return
 	}
 
-	refreshToken, err = createToken(user, RefreshTokenExpiration)
-	if err != nil {
-		err = fmt.Errorf("failed to create refresh token: %v", err)
+	if user.DeletedAt != nil {
+		err = domain.ErrAccountDeleted
 		return
 	}
 
-	// store refresh token in redis, revoke/delete when user logs out
-	err = svc.redis.Set(context.Background(), "refresh:"+refreshToken, user.ID, RefreshTokenExpiration).Err()
-	if err != nil {
-		err = fmt.Errorf("failed to cache refresh token: %v", err)
+	if user.TOTPEnabled {
+		mfaToken, err = svc.createMFAChallenge(user)
 		return
 	}
 
+	accessToken, refreshToken, err = svc.issueTokens(user, client)
 	return
 }
 
 func (svc *AuthService) Logout(refreshToken string) (err error) {
-
-	err = svc.redis.Del(context.Background(), "refresh:"+refreshToken).Err()
+	claims, err := svc.VerifyToken(refreshToken, RefreshTokenType)
 	if err != nil {
+		return
+	}
+
+	// revoking the session logs out every token rotated from the same login
+	err = svc.RevokeSession(claims.UserID, claims.SessionID)
+	if err != nil && !errors.Is(err, domain.ErrSessionNotFound) {
 		err = fmt.Errorf("failed to revoke existing refresh token: %v", err)
 		return
 	}
 
-	return
+	return nil
 }
 
+// BeginSignUp emails a verification code. If the email already has an account
+// the owner is told so by email instead, and the caller gets the same response
+// either way so sign up can't be used to find out who is registered.
 func (svc *AuthService) BeginSignUp(email string) (err error) {
-	// check if there is an active account with this email
+	email = normalizeEmail(email)
+
+	// check if there is an account with this email
 	user, err := svc.repository.GetUserByEmail(email)
-	if user.IsActive {
-		err = domain.ErrUserAccountActive
+	if err == nil {
+		svc.sendAccountExistsEmail(user)
 		return
 	}
 
@@ -105,18 +168,30 @@ func (svc *AuthService) BeginSignUp(email string) (err error) {
 		return
 	}
 
-	// cache verification code into redis
-	code := generateCode(6)
+	// cache a hash of the verification code into redis
+	code, err := generateCode(6)
+	if err != nil {
+		err = fmt.Errorf("failed to generate verification code: %v", err)
+		return
+	}
+
 	key := appendToKey(SignUpVerificationKey, email)
+	attemptsKey := appendToKey(SignUpVerificationAttemptsKey, email)
 
-	err = svc.redis.Set(context.Background(), key, code, time.Minute*5).Err()
+	_, err = svc.redis.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.Set(context.Background(), key, hashVerificationCode(email, code), VerificationCodeExpiration)
+		pipe.Del(context.Background(), attemptsKey)
+		return nil
+	})
 	if err != nil {
 		err = fmt.Errorf("failed to cache verification code: %v", err)
 		return
 	}
 
 	go func() {
-		data := map[string]string{}
+		data := map[string]string{
+			"code": code,
+		}
 
 		content := smtp.EmailContent{
 			Subject:   "Sign up your new account",
@@ -134,22 +209,29 @@ func (svc *AuthService) BeginSignUp(email string) (err error) {
 }
 
 func (svc *AuthService) VerifySignUp(email string, code string) (err error) {
+	email = normalizeEmail(email)
+
 	// check cache if verification code is correct
 	key := appendToKey(SignUpVerificationKey, email)
 
 	cached, err := svc.redis.Get(context.Background(), key).Result()
+	if errors.Is(err, redis.Nil) {
+		err = domain.ErrIncorrectCode
+		return
+	}
+
 	if err != nil {
 		err = fmt.Errorf("failed to get verification code: %v", err)
 		return
 	}
 
-	if cached != code {
-		err = domain.ErrIncorrectCode
+	if subtle.ConstantTimeCompare([]byte(cached), []byte(hashVerificationCode(email, code))) != 1 {
+		err = svc.recordFailedVerification(key, appendToKey(SignUpVerificationAttemptsKey, email))
 		return
 	}
 
 	// if successful, set status to verified
-	err = svc.redis.Set(context.Background(), key, VerificationCompleted, time.Minute*5).Err()
+	err = svc.redis.Set(context.Background(), key, VerificationCompleted, VerificationCodeExpiration).Err()
 	if err != nil {
 		err = fmt.Errorf("failed to cache email verification status: %v", err)
 		return
@@ -158,7 +240,30 @@ func (svc *AuthService) VerifySignUp(email string, code string) (err error) {
 	return
 }
 
+// recordFailedVerification counts a wrong guess and throws the code away once
+// there have been too many, so a 6 digit code can't be brute forced.
+func (svc *AuthService) recordFailedVerification(key string, attemptsKey string) (err error) {
+	attempts, err := svc.redis.Incr(context.Background(), attemptsKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to count verification attempts: %v", err)
+	}
+
+	svc.redis.Expire(context.Background(), attemptsKey, VerificationCodeExpiration)
+
+	if attempts < maxVerificationAttempts {
+		return domain.ErrIncorrectCode
+	}
+
+	if err = svc.redis.Del(context.Background(), key, attemptsKey).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate verification code: %v", err)
+	}
+
+	return domain.ErrTooManyAttempts
+}
+
 func (svc *AuthService) FinishSignUp(email string, username string, password string) (err error) {
+	email = normalizeEmail(email)
+
 	// check cache if email was verified
 	key := appendToKey(SignUpVerificationKey, email)
 
@@ -179,8 +284,7 @@ func (svc *AuthService) FinishSignUp(email string, username string, password str
 		return
 	}
 
-	// hash password
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	hashed, err := svc.hashNewPassword(password, email, username)
 	if err != nil {
 		return
 	}
@@ -189,14 +293,15 @@ func (svc *AuthService) FinishSignUp(email string, username string, password str
 	newUser := domain.User{
 		Email:     email,
 		Username:  username,
-		Password:  string(hashed),
+		Password:  hashed,
 		CreatedAt: time.Now(),
 		IsActive:  true,
 	}
 
-	err = svc.repository.InsertUser(newUser)
+	// the unique indexes catch a username or email taken since the checks above
+	_, err = svc.repository.InsertUser(newUser)
 	if err != nil {
-		err = fmt.Errorf("failed to insert user: %v", err)
+		err = fmt.Errorf("failed to insert user: %w", err)
 		return
 	}
 
@@ -209,29 +314,43 @@ func (svc *AuthService) FinishSignUp(email string, username string, password str
 	return
 }
 
+// ForgotPassword emails a reset link. Unknown emails are ignored so the response
+// doesn't reveal which accounts exist.
 func (svc *AuthService) ForgotPassword(email string) (err error) {
+	email = normalizeEmail(email)
+
 	// check if there is an active account with this email
 	user, err := svc.repository.GetUserByEmail(email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			err = domain.ErrUserAccountNotFound
-			return
+			return nil
 		}
 
 		err = fmt.Errorf("failed to fetch user from db: %v", err)
 		return
 	}
 
-	token, err := createToken(user, PasswordResetTokenExpiration)
+	claims := newClaims(user, PasswordResetTokenType, PasswordResetTokenExpiration)
+
+	token, err := svc.signToken(claims)
 	if err != nil {
 		err = fmt.Errorf("failed to create password reset token: %v", err)
 		return
 	}
 
+	// reset tokens are single use, ResetPassword consumes this key
+	key := appendToKey(PasswordResetTokenKey, claims.ID)
+
+	err = svc.redis.Set(context.Background(), key, user.Email, PasswordResetTokenExpiration).Err()
+	if err != nil {
+		err = fmt.Errorf("failed to cache password reset token: %v", err)
+		return
+	}
+
 	go func() {
 		data := map[string]string{
 			"username": user.Username,
-			"link":     fmt.Sprintf("http://localhost:5173/reset-password?token=%v", token),
+			"link":     fmt.Sprintf("%v/reset-password?token=%v", svc.frontendURL, token),
 		}
 
 		content := smtp.EmailContent{
@@ -251,7 +370,7 @@ func (svc *AuthService) ForgotPassword(email string) (err error) {
 
 func (svc *AuthService) ResetPassword(token string, password string) (err error) {
 	// get email from token
-	claims, err := svc.VerifyToken(token)
+	claims, err := svc.VerifyToken(token, PasswordResetTokenType)
 	if err != nil {
 		return
 	}
@@ -268,15 +387,31 @@ func (svc *AuthService) ResetPassword(token string, password string) (err error)
 	}
 
 	// validate that the new password does not match old one
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err == nil {
+	same, _, err := svc.hasher.Verify(password, user.Password)
+	if err != nil {
+		err = fmt.Errorf("failed to verify password: %v", err)
+		return
+	}
+
+	if same {
 		err = domain.ErrSamePassword
 		return
 	}
 
-	// hash new password
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	hashed, err := svc.hashNewPassword(password, user.Email, user.Username)
+	if err != nil {
+		return
+	}
+
+	// consume the token so the same link cannot be used twice
+	deleted, err := svc.redis.Del(context.Background(), appendToKey(PasswordResetTokenKey, claims.ID)).Result()
 	if err != nil {
+		err = fmt.Errorf("failed to consume password reset token: %v", err)
+		return
+	}
+
+	if deleted == 0 {
+		err = domain.ErrInvalidToken
 		return
 	}
 
@@ -286,25 +421,42 @@ func (svc *AuthService) ResetPassword(token string, password string) (err error)
 		return
 	}
 
+	// whoever had access before the reset should not keep it
+	err = svc.RevokeAllSessions(user.ID)
+	if err != nil {
+		err = fmt.Errorf("failed to revoke sessions: %v", err)
+		return
+	}
+
+	svc.audit(user.ID, domain.AuditPasswordReset, "", domain.Session{})
 	return
 }
 
-func (svc *AuthService) VerifyToken(tokenString string) (c *claims, err error) {
+// VerifyToken parses the token and checks that it was minted for the given purpose.
+func (svc *AuthService) VerifyToken(tokenString string, tokenType string) (c *claims, err error) {
 	token, err := jwt.ParseWithClaims(tokenString, &claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := svc.keys.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		// never let the token pick a different algorithm than the key was issued for
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return jwtSecret, nil
-	})
+		return key.PublicKey(), nil
+	}, jwt.WithAudience(tokenAudience(tokenType)), jwt.WithExpirationRequired())
 
 	if err != nil {
-		err = fmt.Errorf("error parsing token, %v", err)
+		err = fmt.Errorf("%w: %v", domain.ErrInvalidToken, err)
 		return
 	}
 
 	claims, ok := token.Claims.(*claims)
-	if !ok || !token.Valid {
-		err = fmt.Errorf("invalid token")
+	if !ok || !token.Valid || claims.Type != tokenType {
+		err = domain.ErrInvalidToken
 		return
 	}
 
@@ -312,85 +464,137 @@ func (svc *AuthService) VerifyToken(tokenString string) (c *claims, err error) {
 	return
 }
 
-func (svc *AuthService) RefreshToken(refreshToken string) (accessToken string, err error) {
-	claims, err := svc.VerifyToken(refreshToken)
+// RefreshToken exchanges a refresh token for a new pair. The old token is only used up
+// once the new pair exists, so a client whose exchange failed can retry with it.
+func (svc *AuthService) RefreshToken(refreshToken string, client domain.Session) (accessToken string, newRefreshToken string, err error) {
+	claims, err := svc.VerifyToken(refreshToken, RefreshTokenType)
 	if err != nil {
 		return
 	}
 
-	user, err := svc.repository.GetUserByEmail(claims.Email)
+	if claims.ID == "" || claims.SessionID == "" {
+		err = domain.ErrInvalidToken
+		return
+	}
+
+	sessionID, err := svc.redis.Get(context.Background(), appendToKey(RefreshTokenKey, claims.ID)).Result()
+	if errors.Is(err, redis.Nil) {
+		err = svc.detectTokenReuse(claims, client)
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to get refresh token: %v", err)
+		return
+	}
+
+	if sessionID != claims.SessionID {
+		err = domain.ErrInvalidToken
+		return
+	}
+
+	// the session is gone once the user logs out, revokes it or reuse was detected
+	session, err := svc.getSession(sessionID)
+	if errors.Is(err, domain.ErrSessionNotFound) {
+		err = domain.ErrInvalidToken
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	// by id, the email in the claims is stale once the user changes it
+	user, err := svc.repository.GetUserByID(claims.UserID)
 	if err != nil {
 		err = fmt.Errorf("failed to fetch username from db: %v", err)
 		return
 	}
 
-	accessToken, err = createToken(user, AccessTokenExpiration)
+	accessToken, err = svc.createAccessToken(user, sessionID)
 	if err != nil {
-		err = fmt.Errorf("failed to create access token: %v", err)
 		return
 	}
 
+	next := newClaims(user, RefreshTokenType, RefreshTokenExpiration)
+	next.SessionID = sessionID
+
+	newRefreshToken, err = svc.signToken(next)
+	if err != nil {
+		err = fmt.Errorf("failed to create refresh token: %v", err)
+		return
+	}
+
+	err = svc.exchangeRefreshToken(session, client, claims, next.ID)
+	if errors.Is(err, errRefreshTokenGone) {
+		// a concurrent exchange won, or the token was already rotated
+		err = svc.detectTokenReuse(claims, client)
+	}
+
+	if err != nil {
+		accessToken, newRefreshToken = "", ""
+	}
+
 	return
 }
 
-func (svc *AuthService) CompleteOAuth(oAuthID string, email string) (accessToken string, refreshToken string, err error) {
-
-	user, err := svc.repository.GetUserByEmail(email)
-	if errors.Is(err, sql.ErrNoRows) {
+// JWKS publishes the public keys that verify tokens issued by this service.
+func (svc *AuthService) JWKS() keys.JWKS {
+	return svc.keys.JWKS()
+}
 
-		// fallback to finding by oauth id
-		user, err = svc.repository.GetUserByOAuthID(oAuthID)
-		if errors.Is(err, sql.ErrNoRows) {
+// issueTokens starts a new session for a fresh login.
+func (svc *AuthService) issueTokens(user domain.User, client domain.Session) (accessToken string, refreshToken string, err error) {
+	// every way to log in ends here, accounts pending deletion must be restored first
+	if user.DeletedAt != nil {
+		err = domain.ErrAccountDeleted
+		return
+	}
 
-			// create if not found
-			user = domain.User{
-				OAuthID:   oAuthID,
-				Email:     email,
-				CreatedAt: time.Now(),
-				IsActive:  true,
-			}
-
-			// auto generate username for oauth users, can update later
-			user.Username = "AnonymousUser" + generateCode(12)
-
-			err = svc.repository.InsertUser(user)
-			if err != nil {
-				err = fmt.Errorf("failed to insert user: %v", err)
-				return
-			}
-
-		} else if err != nil {
-			err = fmt.Errorf("failed to fetch user by oauth from db: %v", err)
-			return
-		}
+	session, err := svc.createSession(user, client)
+	if err != nil {
+		return
+	}
 
-	} else if err != nil {
-		err = fmt.Errorf("failed to fetch user by email from db: %v", err)
+	accessToken, err = svc.createAccessToken(user, session.ID)
+	if err != nil {
 		return
 	}
 
-	// link missing oauth id in case user originally signed up for account via normal flow
-	if user.OAuthID == "" {
-		if err = svc.repository.UpdateOAuthID(oAuthID, user.Email); err != nil {
-			err = fmt.Errorf("failed to update oauth id from db: %v", err)
-			return
-		}
+	refreshToken, err = svc.rotateRefreshToken(user, session.ID)
+	if err != nil {
+		return
 	}
 
-	accessToken, err = createToken(user, AccessTokenExpiration)
+	svc.audit(user.ID, domain.AuditLogin, "", session)
+	return
+}
+
+func (svc *AuthService) createAccessToken(user domain.User, sessionID string) (accessToken string, err error) {
+	claims := newClaims(user, AccessTokenType, AccessTokenExpiration)
+	claims.SessionID = sessionID
+
+	accessToken, err = svc.signToken(claims)
 	if err != nil {
 		err = fmt.Errorf("failed to create access token: %v", err)
 		return
 	}
 
-	refreshToken, err = createToken(user, RefreshTokenExpiration)
+	return
+}
+
+// rotateRefreshToken mints the next refresh token of a session.
+func (svc *AuthService) rotateRefreshToken(user domain.User, sessionID string) (refreshToken string, err error) {
+	claims := newClaims(user, RefreshTokenType, RefreshTokenExpiration)
+	claims.SessionID = sessionID
+
+	refreshToken, err = svc.signToken(claims)
 	if err != nil {
 		err = fmt.Errorf("failed to create refresh token: %v", err)
 		return
 	}
 
-	// store refresh token in redis, revoke/delete when user logs out
-	err = svc.redis.Set(context.Background(), "refresh:"+refreshToken, user.ID, RefreshTokenExpiration).Err()
+	err = svc.redis.Set(context.Background(), appendToKey(RefreshTokenKey, claims.ID), sessionID, RefreshTokenExpiration).Err()
 	if err != nil {
 		err = fmt.Errorf("failed to cache refresh token: %v", err)
 		return
@@ -399,34 +603,161 @@ func (svc *AuthService) CompleteOAuth(oAuthID string, email string) (accessToken
 	return
 }
 
-func generateCode(length int) (code string) {
+// detectTokenReuse revokes the whole session when an already rotated refresh token is presented again.
+func (svc *AuthService) detectTokenReuse(claims *claims, client domain.Session) (err error) {
+	rotatedKey := appendToKey(RotatedRefreshTokenKey, claims.ID)
+
+	sessionID, err := svc.redis.Get(context.Background(), rotatedKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return domain.ErrInvalidToken
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to get rotated refresh token: %v", err)
+	}
+
+	err = svc.RevokeSession(claims.UserID, sessionID)
+	if err != nil && !errors.Is(err, domain.ErrSessionNotFound) {
+		return fmt.Errorf("failed to revoke session: %v", err)
+	}
+
+	client.ID = sessionID
+	svc.audit(claims.UserID, domain.AuditRefreshTokenReused, "", client)
+
+	return domain.ErrRefreshTokenReused
+}
+
+// generateCode returns a string of random digits from a cryptographically secure source.
+func generateCode(length int) (code string, err error) {
 	digits := "0123456789"
+	max := big.NewInt(int64(len(digits)))
+
 	for i := 0; i < length; i++ {
-		code += string(digits[rand.Intn(len(digits))])
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+
+		code += string(digits[n.Int64()])
 	}
 
-	return code
+	return code, nil
+}
+
+// verifyPassword checks a login password. While the plain password is at hand, a
+// hash made with outdated settings or the old bcrypt scheme is replaced.
+func (svc *AuthService) verifyPassword(user domain.User, password string) (err error) {
+	match, rehash, err := svc.hasher.Verify(password, user.Password)
+	if err != nil {
+		err = fmt.Errorf("failed to verify password: %v", err)
+		return
+	}
+
+	if !match {
+		err = domain.ErrInvalidCredentials
+		return
+	}
+
+	if !rehash {
+		return
+	}
+
+	// the login already succeeded, a failed upgrade is simply retried on the next one
+	if hashed, err := svc.hasher.Hash(password); err == nil {
+		svc.repository.UpdatePassword(hashed, user.Email)
+	}
+
+	return
+}
+
+// hashNewPassword applies the password policy before hashing a password a user picked.
+func (svc *AuthService) hashNewPassword(password string, userInputs ...string) (hashed string, err error) {
+	if err = svc.policy.Check(password, userInputs...); err != nil {
+		return
+	}
+
+	hashed, err = svc.hasher.Hash(password)
+	if err != nil {
+		err = fmt.Errorf("failed to hash password: %v", err)
+		return
+	}
+
+	return
+}
+
+// normalizeEmail is applied to every email entering the service, lookups and the
+// unique index are case-insensitive but redis keys are not.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// hashVerificationCode keeps codes out of redis in plain text. The email acts as
+// a salt so equal codes for different addresses don't share a hash.
+func hashVerificationCode(email string, code string) string {
+	sum := sha256.Sum256([]byte(email + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+func (svc *AuthService) sendAccountExistsEmail(user domain.User) {
+	go func() {
+		data := map[string]string{
+			"username": user.Username,
+			"link":     svc.frontendURL + "/forgot-password",
+		}
+
+		content := smtp.EmailContent{
+			Subject:   "You already have an account",
+			Recipient: user.Email,
+			Body:      data,
+		}
+
+		svc.mailer.Send("email/templates/account-exists.html", content)
+	}()
 }
 
 type claims struct {
 	jwt.RegisteredClaims
-	Email  string    `json:"email"`
-	UserID uuid.UUID `json:"id"`
+	Type      string    `json:"typ"`
+	Email     string    `json:"email"`
+	UserID    uuid.UUID `json:"id"`
+	Role      string    `json:"role,omitempty"`
+	SessionID string    `json:"sid,omitempty"`
 }
 
-func createToken(user domain.User, expiration time.Duration) (string, error) {
-	claims := claims{
+func newClaims(user domain.User, tokenType string, expiration time.Duration) claims {
+	return claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   fmt.Sprintf("%d", user.ID),
+			ID:        uuid.NewString(),
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{tokenAudience(tokenType)},
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
 		},
+		Type:   tokenType,
 		Email:  user.Email,
 		UserID: user.ID,
+		Role:   user.Role,
+	}
+}
+
+func (svc *AuthService) createToken(user domain.User, tokenType string, expiration time.Duration) (string, error) {
+	return svc.signToken(newClaims(user, tokenType, expiration))
+}
+
+func (svc *AuthService) signToken(claims claims) (string, error) {
+	key, err := svc.keys.SigningKey()
+	if err != nil {
+		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// tokenAudience keeps tokens of one purpose from being accepted where another is expected.
+func tokenAudience(tokenType string) string {
+	return "papacatzzi:" + tokenType
 }
 
 func appendToKey(key string, id string) string {
@@ -0,0 +1,510 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+	"github.com/papacatzzi-server/keys"
+	"github.com/papacatzzi-server/log"
+	"github.com/papacatzzi-server/password"
+	"github.com/papacatzzi-server/postgres"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+var errTestOutage = errors.New("connection refused")
+
+// newTestAuthService returns an AuthService backed by an in-memory redis and a database
+// that only knows user.
+func newTestAuthService(t *testing.T, user domain.User) (AuthService, *testDB, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+
+	keyRing, err := keys.NewEphemeralKeyRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, fake := newTestDB(t, user)
+
+	nop := zerolog.Nop()
+
+	svc := AuthService{
+		logger:     log.Logger{Logger: &nop},
+		repository: postgres.NewUserRepository(db),
+		redis:      redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		keys:       keyRing,
+		hasher:     password.NewArgon2idHasher(testArgon2idParams),
+	}
+
+	return svc, fake, mr
+}
+
+// testArgon2idParams keep hashing fast, they are far too cheap for real passwords.
+var testArgon2idParams = password.Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func testUser() domain.User {
+	return domain.User{ID: uuid.New(), Username: "whiskers", Email: "cat@example.com", Role: domain.RoleUser, CreatedAt: time.Now()}
+}
+
+func TestVerifyToken(t *testing.T) {
+	user := testUser()
+
+	tests := []struct {
+		name   string
+		claims func() claims
+		as     string
+		valid  bool
+	}{
+		{
+			name:   "access token",
+			claims: func() claims { return newClaims(user, AccessTokenType, AccessTokenExpiration) },
+			as:     AccessTokenType,
+			valid:  true,
+		},
+		{
+			name:   "refresh token used as access token",
+			claims: func() claims { return newClaims(user, RefreshTokenType, RefreshTokenExpiration) },
+			as:     AccessTokenType,
+		},
+		{
+			name:   "access token used as refresh token",
+			claims: func() claims { return newClaims(user, AccessTokenType, AccessTokenExpiration) },
+			as:     RefreshTokenType,
+		},
+		{
+			name:   "password reset token used as access token",
+			claims: func() claims { return newClaims(user, PasswordResetTokenType, PasswordResetTokenExpiration) },
+			as:     AccessTokenType,
+		},
+		{
+			name: "typ without the matching audience",
+			claims: func() claims {
+				c := newClaims(user, RefreshTokenType, RefreshTokenExpiration)
+				c.Type = AccessTokenType
+				return c
+			},
+			as: AccessTokenType,
+		},
+		{
+			name: "audience without the matching typ",
+			claims: func() claims {
+				c := newClaims(user, RefreshTokenType, RefreshTokenExpiration)
+				c.Audience = jwt.ClaimStrings{tokenAudience(AccessTokenType)}
+				return c
+			},
+			as: AccessTokenType,
+		},
+		{
+			name: "no audience",
+			claims: func() claims {
+				c := newClaims(user, AccessTokenType, AccessTokenExpiration)
+				c.Audience = nil
+				return c
+			},
+			as: AccessTokenType,
+		},
+		{
+			name: "no expiry",
+			claims: func() claims {
+				c := newClaims(user, AccessTokenType, AccessTokenExpiration)
+				c.ExpiresAt = nil
+				return c
+			},
+			as: AccessTokenType,
+		},
+		{
+			name:   "expired",
+			claims: func() claims { return newClaims(user, AccessTokenType, -time.Minute) },
+			as:     AccessTokenType,
+		},
+	}
+
+	svc, _, _ := newTestAuthService(t, user)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := svc.signToken(tt.claims())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = svc.VerifyToken(token, tt.as)
+			if tt.valid && err != nil {
+				t.Errorf("VerifyToken() error = %v, want nil", err)
+			}
+
+			if !tt.valid && !errors.Is(err, domain.ErrInvalidToken) {
+				t.Errorf("VerifyToken() error = %v, want %v", err, domain.ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestVerifyTokenForeignKey(t *testing.T) {
+	user := testUser()
+	svc, _, _ := newTestAuthService(t, user)
+
+	other, err := keys.NewEphemeralKeyRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	foreign := AuthService{keys: other}
+
+	token, err := foreign.signToken(newClaims(user, AccessTokenType, AccessTokenExpiration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = svc.VerifyToken(token, AccessTokenType); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("VerifyToken() error = %v, want %v", err, domain.ErrInvalidToken)
+	}
+}
+
+func TestResetPasswordSingleUse(t *testing.T) {
+	user := testUser()
+	svc, db, mr := newTestAuthService(t, user)
+
+	hashed, err := svc.hasher.Hash("old tabby password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.user.Password = hashed
+
+	sent := newClaims(user, PasswordResetTokenType, PasswordResetTokenExpiration)
+	mr.Set(appendToKey(PasswordResetTokenKey, sent.ID), user.Email)
+
+	unsent := newClaims(user, PasswordResetTokenType, PasswordResetTokenExpiration)
+
+	tokens := map[string]string{}
+	for name, c := range map[string]claims{"sent": sent, "unsent": unsent} {
+		if tokens[name], err = svc.signToken(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = svc.ResetPassword(tokens["unsent"], "new calico password"); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("token that was never sent: error = %v, want %v", err, domain.ErrInvalidToken)
+	}
+
+	if err = svc.ResetPassword(tokens["sent"], "new calico password"); err != nil {
+		t.Fatalf("ResetPassword() error = %v", err)
+	}
+
+	if err = svc.ResetPassword(tokens["sent"], "newer siamese password"); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("token used twice: error = %v, want %v", err, domain.ErrInvalidToken)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	user := testUser()
+
+	tests := []struct {
+		name string
+
+		// setup returns the refresh token to present and the session it belongs to
+		setup          func(t *testing.T, svc *AuthService) (token string, sessionID string)
+		want           error
+		sessionRevoked bool
+	}{
+		{
+			name: "fresh token",
+			setup: func(t *testing.T, svc *AuthService) (string, string) {
+				session := mustCreateSession(t, svc, user)
+				return mustRotate(t, svc, user, session.ID), session.ID
+			},
+		},
+		{
+			name: "access token",
+			setup: func(t *testing.T, svc *AuthService) (string, string) {
+				session := mustCreateSession(t, svc, user)
+
+				token, err := svc.createAccessToken(user, session.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return token, session.ID
+			},
+			want: domain.ErrInvalidToken,
+		},
+		{
+			name: "never issued",
+			setup: func(t *testing.T, svc *AuthService) (string, string) {
+				session := mustCreateSession(t, svc, user)
+
+				claims := newClaims(user, RefreshTokenType, RefreshTokenExpiration)
+				claims.SessionID = session.ID
+
+				token, err := svc.signToken(claims)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return token, session.ID
+			},
+			want: domain.ErrInvalidToken,
+		},
+		{
+			name: "revoked session",
+			setup: func(t *testing.T, svc *AuthService) (string, string) {
+				session := mustCreateSession(t, svc, user)
+				token := mustRotate(t, svc, user, session.ID)
+
+				if err := svc.RevokeSession(user.ID, session.ID); err != nil {
+					t.Fatal(err)
+				}
+
+				return token, session.ID
+			},
+			want:           domain.ErrInvalidToken,
+			sessionRevoked: true,
+		},
+		{
+			name: "replayed after rotation",
+			setup: func(t *testing.T, svc *AuthService) (string, string) {
+				session := mustCreateSession(t, svc, user)
+				token := mustRotate(t, svc, user, session.ID)
+
+				if _, _, err := svc.RefreshToken(token, domain.Session{}); err != nil {
+					t.Fatal(err)
+				}
+
+				return token, session.ID
+			},
+			want:           domain.ErrRefreshTokenReused,
+			sessionRevoked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _, _ := newTestAuthService(t, user)
+			token, sessionID := tt.setup(t, &svc)
+
+			access, refresh, err := svc.RefreshToken(token, domain.Session{})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("RefreshToken() error = %v, want %v", err, tt.want)
+			}
+
+			if (err == nil) != (access != "" && refresh != "") {
+				t.Errorf("RefreshToken() returned tokens %q, %q with error %v", access, refresh, err)
+			}
+
+			_, err = svc.getSession(sessionID)
+			if revoked := errors.Is(err, domain.ErrSessionNotFound); revoked != tt.sessionRevoked {
+				t.Errorf("session revoked = %v, want %v", revoked, tt.sessionRevoked)
+			}
+		})
+	}
+}
+
+// A refresh that fails, here on the database, must leave the token usable so the
+// client's retry isn't taken for reuse.
+func TestRefreshTokenRetryAfterFailure(t *testing.T) {
+	user := testUser()
+	svc, db, _ := newTestAuthService(t, user)
+
+	session := mustCreateSession(t, &svc, user)
+	token := mustRotate(t, &svc, user, session.ID)
+
+	db.fail(errTestOutage)
+
+	if _, _, err := svc.RefreshToken(token, domain.Session{}); err == nil {
+		t.Fatal("RefreshToken() succeeded with the database down")
+	}
+
+	db.fail(nil)
+
+	_, next, err := svc.RefreshToken(token, domain.Session{})
+	if err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+
+	if _, _, err = svc.RefreshToken(next, domain.Session{}); err != nil {
+		t.Errorf("the retried exchange's token was rejected: %v", err)
+	}
+}
+
+// Redis failing once the user is loaded, where the token used to be consumed and the
+// session touched, must leave both the token and the session as they were.
+func TestRefreshTokenRetryAfterSessionTouchFailure(t *testing.T) {
+	user := testUser()
+	svc, db, mr := newTestAuthService(t, user)
+
+	session := mustCreateSession(t, &svc, user)
+	token := mustRotate(t, &svc, user, session.ID)
+
+	db.onQuery = func() { mr.SetError("LOADING redis is loading the dataset in memory") }
+
+	if _, _, err := svc.RefreshToken(token, domain.Session{IPAddress: "203.0.113.7"}); err == nil {
+		t.Fatal("RefreshToken() succeeded with redis down")
+	}
+
+	db.onQuery = nil
+	mr.SetError("")
+
+	got, err := svc.getSession(session.ID)
+	if err != nil {
+		t.Fatalf("session lost after the failed exchange: %v", err)
+	}
+
+	if got.IPAddress == "203.0.113.7" {
+		t.Error("the failed exchange touched the session")
+	}
+
+	if _, _, err = svc.RefreshToken(token, domain.Session{IPAddress: "203.0.113.7"}); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+
+	if got, _ = svc.getSession(session.ID); got.IPAddress != "203.0.113.7" {
+		t.Errorf("session IP = %q after the retry, want %q", got.IPAddress, "203.0.113.7")
+	}
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	user := testUser()
+	svc, _, _ := newTestAuthService(t, user)
+
+	session := mustCreateSession(t, &svc, user)
+	first := mustRotate(t, &svc, user, session.ID)
+	second := mustRotate(t, &svc, user, session.ID)
+
+	if first == second {
+		t.Fatal("rotateRefreshToken() returned the same token twice")
+	}
+
+	for _, token := range []string{first, second} {
+		claims, err := svc.VerifyToken(token, RefreshTokenType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if claims.SessionID != session.ID {
+			t.Errorf("token belongs to session %q, want %q", claims.SessionID, session.ID)
+		}
+	}
+}
+
+func mustCreateSession(t *testing.T, svc *AuthService, user domain.User) domain.Session {
+	t.Helper()
+
+	session, err := svc.createSession(user, domain.Session{DeviceName: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return session
+}
+
+func mustRotate(t *testing.T, svc *AuthService, user domain.User, sessionID string) string {
+	t.Helper()
+
+	token, err := svc.rotateRefreshToken(user, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestGenerateCode(t *testing.T) {
+	seen := map[string]bool{}
+
+	for i := 0; i < 20; i++ {
+		code, err := generateCode(6)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(code) != 6 || strings.Trim(code, "0123456789") != "" {
+			t.Fatalf("generateCode(6) = %q, want 6 digits", code)
+		}
+
+		seen[code] = true
+	}
+
+	if len(seen) < 2 {
+		t.Error("generateCode() keeps returning the same code")
+	}
+}
+
+func TestVerifySignUp(t *testing.T) {
+	const email = "cat@example.com"
+
+	tests := []struct {
+		name string
+
+		// attempts are the codes tried before the last one
+		attempts []string
+		code     string
+		want     error
+	}{
+		{name: "correct code", code: "123456"},
+		{name: "wrong code", code: "654321", want: domain.ErrIncorrectCode},
+		{name: "stored hash as code", code: hashVerificationCode(email, "123456"), want: domain.ErrIncorrectCode},
+		{name: "correct code after a miss", attempts: []string{"000000"}, code: "123456"},
+		{
+			name:     "too many misses",
+			attempts: []string{"000000", "000001", "000002", "000003"},
+			code:     "000004",
+			want:     domain.ErrTooManyAttempts,
+		},
+		{
+			name:     "correct code once locked out",
+			attempts: []string{"000000", "000001", "000002", "000003", "000004"},
+			code:     "123456",
+			want:     domain.ErrIncorrectCode,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _, mr := newTestAuthService(t, testUser())
+			mr.Set(appendToKey(SignUpVerificationKey, email), hashVerificationCode(email, "123456"))
+
+			for _, code := range tt.attempts {
+				svc.VerifySignUp(email, code)
+			}
+
+			if err := svc.VerifySignUp(email, tt.code); !errors.Is(err, tt.want) {
+				t.Errorf("VerifySignUp() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// Unknown emails must get the same answer as registered ones.
+func TestUnknownEmail(t *testing.T) {
+	svc, db, mr := newTestAuthService(t, testUser())
+	db.fail(sql.ErrNoRows)
+
+	if err := svc.ForgotPassword("nobody@example.com"); err != nil {
+		t.Errorf("ForgotPassword() error = %v, want nil", err)
+	}
+
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("ForgotPassword() stored %v for an unknown email", keys)
+	}
+
+	if _, _, _, err := svc.Login("nobody@example.com", "hunter22", domain.Session{}); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Errorf("Login() error = %v, want %v", err, domain.ErrInvalidCredentials)
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	for _, email := range []string{"cat@example.com", "Cat@Example.com", "  CAT@EXAMPLE.COM\n"} {
+		if got := normalizeEmail(email); got != "cat@example.com" {
+			t.Errorf("normalizeEmail(%q) = %q, want %q", email, got, "cat@example.com")
+		}
+	}
+}
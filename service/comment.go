@@ -0,0 +1,328 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+	"github.com/papacatzzi-server/postgres"
+)
+
+// maxMentions caps how many users one comment can mention.
+const maxMentions = 10
+
+var (
+	mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_])@([A-Za-z0-9_]{3,30})`)
+	linkPattern    = regexp.MustCompile(`(?i)https?://|www\.`)
+)
+
+// CommentHook looks at a comment before it is saved, new or edited, and can hold it
+// for a moderator. Hooks can't make a comment visible that another hook held.
+type CommentHook func(comment domain.Comment) domain.CommentStatus
+
+// HoldLinks holds comments with more than max links, the usual shape of spam.
+func HoldLinks(max int) CommentHook {
+	return func(comment domain.Comment) domain.CommentStatus {
+		if len(linkPattern.FindAllStringIndex(comment.Body, -1)) > max {
+			return domain.CommentHeld
+		}
+
+		return domain.CommentVisible
+	}
+}
+
+type CommentService struct {
+	repository         postgres.CommentRepository
+	sightingRepository postgres.SightingRepository
+	userRepository     postgres.UserRepository
+	hooks              []CommentHook
+}
+
+func NewCommentService(
+	repo postgres.CommentRepository,
+	sightingRepo postgres.SightingRepository,
+	userRepo postgres.UserRepository,
+	hooks ...CommentHook,
+) CommentService {
+	return CommentService{
+		repository:         repo,
+		sightingRepository: sightingRepo,
+		userRepository:     userRepo,
+		hooks:              hooks,
+	}
+}
+
+// List returns a sighting's comments, oldest first. Deleted comments and ones viewer
+// may not read are blanked, and dropped altogether unless replies hang off them.
+func (svc *CommentService) List(viewer domain.Identity, sightingID string) (comments []domain.Comment, err error) {
+	sighting, err := svc.getSighting(viewer, sightingID)
+	if err != nil {
+		return
+	}
+
+	all, err := svc.repository.GetComments(sighting.ID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch comments from db: %v", err)
+		return
+	}
+
+	replies := make(map[int]int)
+	for i := range all {
+		if all[i].DeletedAt != nil || !readable(viewer, all[i]) {
+			all[i] = redact(all[i])
+		}
+
+		if all[i].DeletedAt == nil && all[i].ParentID != nil {
+			replies[*all[i].ParentID]++
+		}
+	}
+
+	// walk newest first so a blanked comment only kept for a reply that itself
+	// got dropped is dropped too
+	keep := make([]bool, len(all))
+	for i := len(all) - 1; i >= 0; i-- {
+		c := all[i]
+		keep[i] = c.DeletedAt == nil || replies[c.ID] > 0
+
+		if keep[i] && c.DeletedAt != nil && c.ParentID != nil {
+			replies[*c.ParentID]++
+		}
+	}
+
+	for i, c := range all {
+		if keep[i] {
+			comments = append(comments, c)
+		}
+	}
+
+	return
+}
+
+// Create adds a comment, or a reply when comment.ParentID is set, to a sighting viewer can see.
+func (svc *CommentService) Create(identity domain.Identity, sightingID string, comment domain.Comment) (created domain.Comment, err error) {
+	sighting, err := svc.getSighting(identity, sightingID)
+	if err != nil {
+		return
+	}
+
+	if comment.ParentID != nil {
+		var parent domain.Comment
+
+		parent, err = svc.repository.GetComment(*comment.ParentID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && (parent.SightingID != sighting.ID || parent.DeletedAt != nil)) {
+			err = domain.ErrInvalidParent
+			return
+		}
+
+		if err != nil {
+			err = fmt.Errorf("failed to fetch comment from db: %v", err)
+			return
+		}
+	}
+
+	comment.SightingID = sighting.ID
+	comment.AuthorID = &identity.UserID
+	comment.Status = svc.moderate(comment)
+
+	mentions, err := svc.resolveMentions(comment.Body)
+	if err != nil {
+		return
+	}
+
+	id, err := svc.repository.InsertComment(comment, mentions)
+	if err != nil {
+		err = fmt.Errorf("failed to insert comment: %v", err)
+		return
+	}
+
+	return svc.getComment(id)
+}
+
+// Update edits a comment's body. Only its author can.
+func (svc *CommentService) Update(identity domain.Identity, id int, body string) (updated domain.Comment, err error) {
+	comment, err := svc.getComment(id)
+	if err != nil {
+		return
+	}
+
+	if !authoredBy(comment, identity) {
+		err = domain.ErrCommentForbidden
+		return
+	}
+
+	comment.Body = body
+
+	// a moderator's decision to hide the comment sticks through edits
+	if comment.Status != domain.CommentHidden {
+		comment.Status = svc.moderate(comment)
+	}
+
+	mentions, err := svc.resolveMentions(comment.Body)
+	if err != nil {
+		return
+	}
+
+	err = svc.repository.UpdateComment(comment, mentions)
+	if err != nil {
+		err = fmt.Errorf("failed to update comment: %v", err)
+		return
+	}
+
+	return svc.getComment(id)
+}
+
+// Delete lets authors and moderators remove a comment.
+func (svc *CommentService) Delete(identity domain.Identity, id int) (err error) {
+	comment, err := svc.getComment(id)
+	if err != nil {
+		return
+	}
+
+	if !authoredBy(comment, identity) && identity.Role != domain.RoleModerator {
+		err = domain.ErrCommentForbidden
+		return
+	}
+
+	err = svc.repository.DeleteComment(id)
+	if err != nil {
+		err = fmt.Errorf("failed to delete comment: %v", err)
+		return
+	}
+
+	return
+}
+
+// Moderate sets a comment's status, releasing held comments or hiding abusive ones.
+func (svc *CommentService) Moderate(identity domain.Identity, id int, status domain.CommentStatus) (err error) {
+	if identity.Role != domain.RoleModerator {
+		err = domain.ErrModeratorOnly
+		return
+	}
+
+	if _, err = svc.getComment(id); err != nil {
+		return
+	}
+
+	err = svc.repository.UpdateCommentStatus(id, status)
+	if err != nil {
+		err = fmt.Errorf("failed to moderate comment: %v", err)
+		return
+	}
+
+	return
+}
+
+// ListHeld returns the comments hooks held back, for moderators to review.
+func (svc *CommentService) ListHeld(identity domain.Identity) (comments []domain.Comment, err error) {
+	if identity.Role != domain.RoleModerator {
+		err = domain.ErrModeratorOnly
+		return
+	}
+
+	comments, err = svc.repository.GetCommentsByStatus(domain.CommentHeld)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch comments from db: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *CommentService) moderate(comment domain.Comment) domain.CommentStatus {
+	for _, hook := range svc.hooks {
+		if status := hook(comment); status != domain.CommentVisible {
+			return status
+		}
+	}
+
+	return domain.CommentVisible
+}
+
+// resolveMentions looks up the users mentioned as @username. Names that don't belong
+// to anyone are left as plain text.
+func (svc *CommentService) resolveMentions(body string) (ids []uuid.UUID, err error) {
+	seen := make(map[string]bool)
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		username := strings.ToLower(match[1])
+		if seen[username] || len(seen) == maxMentions {
+			continue
+		}
+
+		seen[username] = true
+
+		user, err := svc.userRepository.GetProfileByName(username)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch mentioned user from db: %v", err)
+		}
+
+		ids = append(ids, user.ID)
+	}
+
+	return
+}
+
+func (svc *CommentService) getSighting(viewer domain.Identity, id string) (sighting domain.Sighting, err error) {
+	sighting, err = svc.sightingRepository.GetSightingByID(viewer, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = domain.ErrSightingNotFound
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to fetch sighting from db: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *CommentService) getComment(id int) (comment domain.Comment, err error) {
+	comment, err = svc.repository.GetComment(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && comment.DeletedAt != nil) {
+		err = domain.ErrCommentNotFound
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to fetch comment from db: %v", err)
+		return
+	}
+
+	return
+}
+
+func authoredBy(comment domain.Comment, identity domain.Identity) bool {
+	return comment.AuthorID != nil && *comment.AuthorID == identity.UserID
+}
+
+// readable reports whether viewer may read a comment. Held and hidden comments stay
+// readable to their author, who isn't told they were moderated.
+func readable(viewer domain.Identity, comment domain.Comment) bool {
+	return comment.Status == domain.CommentVisible ||
+		viewer.Role == domain.RoleModerator ||
+		authoredBy(comment, viewer)
+}
+
+// redact blanks a comment down to its place in the thread. To everyone but its author
+// and moderators, a moderated comment looks deleted.
+func redact(comment domain.Comment) domain.Comment {
+	comment.AuthorID = nil
+	comment.AuthorUsername = ""
+	comment.Body = ""
+	comment.Mentions = nil
+
+	if comment.DeletedAt == nil {
+		comment.DeletedAt = &comment.CreatedAt
+	}
+
+	return comment
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+)
+
+func TestRedact(t *testing.T) {
+	author := uuid.New()
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	deleted := created.Add(time.Hour)
+	parent := 1
+
+	tests := []struct {
+		name        string
+		comment     domain.Comment
+		wantDeleted time.Time
+	}{
+		{
+			name: "moderated comment",
+			comment: domain.Comment{
+				ID: 2, SightingID: 3, ParentID: &parent, AuthorID: &author, AuthorUsername: "whiskers",
+				Body: "buy cheap cat food at https://spam.example.com", Status: domain.CommentHidden,
+				Mentions: []string{"tom"}, CreatedAt: created,
+			},
+			wantDeleted: created,
+		},
+		{
+			name: "deleted comment",
+			comment: domain.Comment{
+				ID: 2, SightingID: 3, AuthorID: &author, AuthorUsername: "whiskers",
+				Body: "", Status: domain.CommentVisible, CreatedAt: created, DeletedAt: &deleted,
+			},
+			wantDeleted: deleted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redact(tt.comment)
+
+			if got.AuthorID != nil || got.AuthorUsername != "" || got.Body != "" || got.Mentions != nil {
+				t.Errorf("redact() left content behind: %+v", got)
+			}
+
+			// a redacted comment keeps its place in the thread
+			if got.ID != tt.comment.ID || got.SightingID != tt.comment.SightingID || got.ParentID != tt.comment.ParentID {
+				t.Errorf("redact() moved the comment: %+v", got)
+			}
+
+			if got.DeletedAt == nil || !got.DeletedAt.Equal(tt.wantDeleted) {
+				t.Errorf("redact() DeletedAt = %v, want %v", got.DeletedAt, tt.wantDeleted)
+			}
+
+			// moderators and the author still read the comment they were handed
+			if tt.comment.AuthorID == nil || tt.comment.AuthorUsername == "" {
+				t.Error("redact() modified its argument")
+			}
+		})
+	}
+}
+
+func TestReadable(t *testing.T) {
+	author := uuid.New()
+
+	tests := []struct {
+		name   string
+		viewer domain.Identity
+		status domain.CommentStatus
+		want   bool
+	}{
+		{"visible to anonymous", domain.Identity{}, domain.CommentVisible, true},
+		{"visible to another user", domain.Identity{UserID: uuid.New()}, domain.CommentVisible, true},
+		{"held to anonymous", domain.Identity{}, domain.CommentHeld, false},
+		{"held to another user", domain.Identity{UserID: uuid.New()}, domain.CommentHeld, false},
+		{"held to its author", domain.Identity{UserID: author}, domain.CommentHeld, true},
+		{"held to a moderator", domain.Identity{UserID: uuid.New(), Role: domain.RoleModerator}, domain.CommentHeld, true},
+		{"hidden to a partner", domain.Identity{UserID: uuid.New(), Role: domain.RolePartner}, domain.CommentHidden, false},
+		{"hidden to its author", domain.Identity{UserID: author}, domain.CommentHidden, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comment := domain.Comment{AuthorID: &author, Status: tt.status}
+
+			if got := readable(tt.viewer, comment); got != tt.want {
+				t.Errorf("readable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadablePurgedAuthor(t *testing.T) {
+	// a purged author's zero ID must not match anonymous viewers
+	comment := domain.Comment{Status: domain.CommentHeld}
+
+	if readable(domain.Identity{}, comment) {
+		t.Error("readable() = true for a held comment without an author")
+	}
+}
+
+func TestHoldLinks(t *testing.T) {
+	hook := HoldLinks(2)
+
+	tests := []struct {
+		name string
+		body string
+		want domain.CommentStatus
+	}{
+		{"no links", "Saw her near the bakery again", domain.CommentVisible},
+		{"one link", "Photos at https://example.com/cat", domain.CommentVisible},
+		{"at the limit", "http://a.example.com and www.b.example.com", domain.CommentVisible},
+		{"over the limit", "https://a.example.com https://b.example.com WWW.c.example.com", domain.CommentHeld},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hook(domain.Comment{Body: tt.body}); got != tt.want {
+				t.Errorf("HoldLinks(2)() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
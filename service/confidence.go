@@ -0,0 +1,200 @@
+package service
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/papacatzzi-server/domain"
+	"github.com/papacatzzi-server/postgres"
+)
+
+// Weights of the parts of a sighting's confidence, they add up to 1.
+const (
+	baseConfidence         = 0.2
+	photoConfidence        = 0.15
+	confirmationConfidence = 0.45
+	reputationConfidence   = 0.2
+
+	// confirmations count for more when they come with a photo, or a location close to
+	// the sighting
+	confirmationPhotoBonus   = 0.5
+	confirmationNearbyBonus  = 0.5
+	confirmationNearbyMeters = 1000
+
+	// reputation is smoothed as if every reporter had this many unconfirmed sightings
+	reputationPriorSightings = 2
+
+	earthRadiusMeters = 6371000
+)
+
+// Confirm vouches for a sighting someone else reported. Confirming again replaces the
+// earlier confirmation.
+func (svc *SightingService) Confirm(identity domain.Identity, sightingID string, confirmation domain.Confirmation) (err error) {
+	sighting, err := svc.GetByID(identity, sightingID)
+	if err != nil {
+		return
+	}
+
+	if sighting.Reporter == identity.UserID.String() {
+		err = domain.ErrConfirmOwnSighting
+		return
+	}
+
+	confirmation.SightingID = sighting.ID
+	confirmation.UserID = identity.UserID
+
+	err = svc.repository.UpsertConfirmation(confirmation)
+	if err != nil {
+		err = fmt.Errorf("failed to confirm sighting: %v", err)
+		return
+	}
+
+	return svc.confirmationsChanged(sighting)
+}
+
+// Unconfirm withdraws the caller's confirmation.
+func (svc *SightingService) Unconfirm(identity domain.Identity, sightingID string) (err error) {
+	sighting, err := svc.GetByID(identity, sightingID)
+	if err != nil {
+		return
+	}
+
+	deleted, err := svc.repository.DeleteConfirmation(sighting.ID, identity.UserID)
+	if err != nil {
+		err = fmt.Errorf("failed to withdraw confirmation: %v", err)
+		return
+	}
+
+	if !deleted {
+		err = domain.ErrConfirmationNotFound
+		return
+	}
+
+	return svc.confirmationsChanged(sighting)
+}
+
+// confirmationsChanged rescores a sighting, as read before the change. When it just
+// gained its first or lost its last confirmation the reporter's reputation moved, so
+// all their sightings are rescored.
+func (svc *SightingService) confirmationsChanged(sighting domain.Sighting) (err error) {
+	defer func() {
+		if err == nil {
+			svc.publish(domain.SightingUpdated, sighting)
+		}
+	}()
+
+	confirmations, err := svc.repository.GetConfirmations(sighting.ID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch confirmations from db: %v", err)
+		return
+	}
+
+	if (sighting.ConfirmationCount > 0) == (len(confirmations) > 0) {
+		return svc.rescore(sighting.ID)
+	}
+
+	ids, err := svc.repository.GetSightingIDsByReporter(sighting.Reporter)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch sightings from db: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		if err = svc.rescore(id); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (svc *SightingService) rescore(id int) (err error) {
+	sighting, err := svc.repository.GetSightingForScoring(id)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch sighting from db: %v", err)
+		return
+	}
+
+	confirmations, err := svc.repository.GetConfirmations(id)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch confirmations from db: %v", err)
+		return
+	}
+
+	audience, err := svc.repository.GetSightingAudience(sighting)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch sighting audience from db: %v", err)
+		return
+	}
+
+	reputation := 0.0
+	if sighting.Reporter != "" {
+		total, confirmed, err := svc.repository.GetReporterStats(sighting.Reporter, id)
+		if err != nil {
+			return fmt.Errorf("failed to fetch reporter stats from db: %v", err)
+		}
+
+		reputation = float64(confirmed) / float64(total+reputationPriorSightings)
+	}
+
+	err = svc.repository.UpdateConfidence(id, confidenceScore(sighting, audience, confirmations, reputation))
+	if err != nil {
+		err = fmt.Errorf("failed to update confidence: %v", err)
+		return
+	}
+
+	return
+}
+
+// confidenceScore combines what backs a sighting up into a score from 0 to 1. Each
+// confirmation closes half of what is left of the gap, so a handful of friends can't
+// push a sighting to certainty. reputation is the share of the reporter's other sightings
+// somebody confirmed, starting low for new reporters.
+//
+// A confirmation is near the sighting when it is near where its author sees the
+// sighting. Against the exact location, a confirmer could move their confirmation
+// around and watch the score to find a coarsened or hidden sighting.
+func confidenceScore(sighting domain.Sighting, audience domain.SightingAudience, confirmations []domain.Confirmation, reputation float64) float64 {
+	score := baseConfidence
+
+	if sighting.PhotoURL != "" {
+		score += photoConfidence
+	}
+
+	weight := 0.0
+	for _, c := range confirmations {
+		weight += 1
+
+		if c.PhotoURL != "" {
+			weight += confirmationPhotoBonus
+		}
+
+		if c.Latitude == nil || c.Longitude == nil {
+			continue
+		}
+
+		// roles aren't kept with confirmations, a moderator is scored like anyone else
+		seen, ok := postgres.VisibleLocation(domain.Identity{UserID: c.UserID}, sighting, audience)
+		if ok && distanceMeters(seen.Latitude, seen.Longitude, *c.Latitude, *c.Longitude) <= confirmationNearbyMeters {
+			weight += confirmationNearbyBonus
+		}
+	}
+
+	score += confirmationConfidence * (1 - math.Pow(0.5, weight))
+	score += reputationConfidence * reputation
+
+	return math.Min(score, 1)
+}
+
+// distanceMeters is the great circle distance between two points.
+func distanceMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := math.Pi / 180
+
+	dLat := (lat2 - lat1) * toRad
+	dLng := (lng2 - lng1) * toRad
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
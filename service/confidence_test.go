@@ -0,0 +1,154 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+	"github.com/papacatzzi-server/postgres"
+)
+
+func TestConfidenceScore(t *testing.T) {
+	sighting := domain.Sighting{ID: 1, Visibility: domain.VisibilityPublic, Precision: domain.PrecisionExact, Latitude: 48.8566, Longitude: 2.3522}
+	withPhoto := sighting
+	withPhoto.PhotoURL = "https://example.com/cat.jpg"
+
+	near, far := 48.8570, 48.9566
+
+	tests := []struct {
+		name          string
+		sighting      domain.Sighting
+		confirmations []domain.Confirmation
+		reputation    float64
+		want          float64
+	}{
+		{"bare sighting", sighting, nil, 0, 0.2},
+		{"photo", withPhoto, nil, 0, 0.35},
+		{"one confirmation", sighting, []domain.Confirmation{{}}, 0, 0.2 + 0.45*0.5},
+		{"two confirmations", sighting, []domain.Confirmation{{}, {}}, 0, 0.2 + 0.45*0.75},
+		{"confirmation with a photo", sighting, []domain.Confirmation{{PhotoURL: "https://example.com/also-cat.jpg"}}, 0, 0.2 + 0.45*(1-math.Pow(0.5, 1.5))},
+		{"nearby confirmation", sighting, []domain.Confirmation{{Latitude: &near, Longitude: &sighting.Longitude}}, 0, 0.2 + 0.45*(1-math.Pow(0.5, 1.5))},
+		{"distant confirmation", sighting, []domain.Confirmation{{Latitude: &far, Longitude: &sighting.Longitude}}, 0, 0.2 + 0.45*0.5},
+		{"confirmation with only a latitude", sighting, []domain.Confirmation{{Latitude: &near}}, 0, 0.2 + 0.45*0.5},
+		{"trusted reporter", sighting, nil, 1, 0.4},
+		{"half trusted reporter", withPhoto, nil, 0.5, 0.45},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := confidenceScore(tt.sighting, domain.SightingAudience{}, tt.confirmations, tt.reputation); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("confidenceScore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfidenceScoreGrowsWithConfirmations(t *testing.T) {
+	sighting := domain.Sighting{PhotoURL: "https://example.com/cat.jpg"}
+
+	var confirmations []domain.Confirmation
+	previous := confidenceScore(sighting, domain.SightingAudience{}, nil, 1)
+
+	for i := 0; i < 50; i++ {
+		confirmations = append(confirmations, domain.Confirmation{PhotoURL: "https://example.com/also-cat.jpg"})
+
+		score := confidenceScore(sighting, domain.SightingAudience{}, confirmations, 1)
+		if score < previous || score > 1 {
+			t.Fatalf("with %d confirmations score = %v, previous %v", len(confirmations), score, previous)
+		}
+
+		previous = score
+	}
+}
+
+// The nearby bonus must not reveal more of a sighting's location than its confirmer
+// can see, or re-confirming from different spots would narrow it down.
+func TestConfidenceScoreCoarsenedSighting(t *testing.T) {
+	orgID := 3
+	member := uuid.New()
+
+	coarse := domain.Sighting{
+		ID:             7,
+		Reporter:       uuid.NewString(),
+		Visibility:     domain.VisibilityPublic,
+		Precision:      domain.Precision1km,
+		OrganizationID: &orgID,
+		Latitude:       48.8566,
+		Longitude:      2.3522,
+	}
+	audience := domain.SightingAudience{Members: map[uuid.UUID]bool{member: true}}
+
+	hidden := coarse
+	hidden.Precision = domain.PrecisionHidden
+
+	stranger := uuid.New()
+	seen, ok := postgres.VisibleLocation(domain.Identity{UserID: stranger}, coarse, audience)
+	if !ok {
+		t.Fatal("public sighting is not visible")
+	}
+
+	offset := distanceMeters(seen.Latitude, seen.Longitude, coarse.Latitude, coarse.Longitude)
+	if offset < 100 {
+		t.Fatalf("coarsened location is only %vm from the sighting, pick another ID", offset)
+	}
+
+	// beyond the exact location, on the far side from where the stranger sees it: near
+	// the sighting, but not near what the stranger can see
+	along := (confirmationNearbyMeters + 50) / offset
+	beyondLat := seen.Latitude + (coarse.Latitude-seen.Latitude)*along
+	beyondLng := seen.Longitude + (coarse.Longitude-seen.Longitude)*along
+
+	if d := distanceMeters(beyondLat, beyondLng, coarse.Latitude, coarse.Longitude); d > confirmationNearbyMeters {
+		t.Fatalf("test point is %vm from the sighting", d)
+	}
+
+	confirm := func(user uuid.UUID, lat float64, lng float64) []domain.Confirmation {
+		return []domain.Confirmation{{UserID: user, Latitude: &lat, Longitude: &lng}}
+	}
+
+	plain := baseConfidence + confirmationConfidence*0.5
+	nearby := baseConfidence + confirmationConfidence*(1-math.Pow(0.5, 1+confirmationNearbyBonus))
+
+	tests := []struct {
+		name          string
+		sighting      domain.Sighting
+		confirmations []domain.Confirmation
+		want          float64
+	}{
+		{"stranger at the coarsened location", coarse, confirm(stranger, seen.Latitude, seen.Longitude), nearby},
+		{"stranger near only the exact location", coarse, confirm(stranger, beyondLat, beyondLng), plain},
+		{"member near the exact location", coarse, confirm(member, beyondLat, beyondLng), nearby},
+		{"stranger on a hidden sighting", hidden, confirm(stranger, hidden.Latitude, hidden.Longitude), plain},
+		{"member on a hidden sighting", hidden, confirm(member, hidden.Latitude, hidden.Longitude), nearby},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := confidenceScore(tt.sighting, audience, tt.confirmations, 0); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("confidenceScore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistanceMeters(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lng1, lat2, lng2 float64
+		want                   float64
+	}{
+		{"same point", 48.8566, 2.3522, 48.8566, 2.3522, 0},
+		{"a degree of latitude", 0, 0, 1, 0, 111195},
+		{"Paris to London", 48.8566, 2.3522, 51.5074, -0.1278, 343560},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// within 0.1%, the earth isn't a sphere anyway
+			if got := distanceMeters(tt.lat1, tt.lng1, tt.lat2, tt.lng2); math.Abs(got-tt.want) > tt.want*0.001+1e-6 {
+				t.Errorf("distanceMeters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
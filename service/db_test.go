@@ -0,0 +1,246 @@
+package service
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/papacatzzi-server/domain"
+)
+
+// testDB stands in for Postgres. Queries on users read back user, or one of others,
+// when looked up by id, email or username. Identities, organizations and their
+// members are matched on the arguments of their lookups, and organization members
+// can be inserted. Every other exec succeeds, unless err is set, and other tables
+// are empty.
+type testDB struct {
+	mu         sync.Mutex
+	user       domain.User
+	others     []domain.User
+	identities []domain.OAuthIdentity
+
+	organizations []domain.Organization
+	members       []domain.OrganizationMember
+
+	err error
+
+	// onQuery runs before each query, to break something else mid request
+	onQuery func()
+}
+
+func (db *testDB) fail(err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.err = err
+}
+
+var testDBs sync.Map
+
+type testDriver struct{}
+
+func (testDriver) Open(name string) (driver.Conn, error) {
+	db, _ := testDBs.Load(name)
+	return testConn{db.(*testDB)}, nil
+}
+
+func init() {
+	sql.Register("testdb", testDriver{})
+}
+
+// newTestDB opens a database of its own that only knows user.
+func newTestDB(t *testing.T, user domain.User) (*sql.DB, *testDB) {
+	t.Helper()
+
+	fake := &testDB{user: user}
+	name := uuid.NewString()
+	testDBs.Store(name, fake)
+
+	db, err := sql.Open("testdb", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db, fake
+}
+
+type testConn struct{ db *testDB }
+
+func (c testConn) Prepare(query string) (driver.Stmt, error) { return testStmt{c.db, query}, nil }
+func (c testConn) Close() error                              { return nil }
+func (c testConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type testStmt struct {
+	db    *testDB
+	query string
+}
+
+func (s testStmt) Close() error  { return nil }
+func (s testStmt) NumInput() int { return -1 }
+
+func (s testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.err != nil || !strings.Contains(s.query, "INSERT INTO organization_members") {
+		return driver.RowsAffected(1), s.db.err
+	}
+
+	for _, m := range s.db.members {
+		if args[0] == int64(m.OrganizationID) && args[1] == m.UserID.String() {
+			return nil, &pq.Error{Code: "23505", Constraint: "organization_members_pkey"}
+		}
+	}
+
+	userID, _ := uuid.Parse(args[1].(string))
+	s.db.members = append(s.db.members, domain.OrganizationMember{
+		OrganizationID: int(args[0].(int64)),
+		UserID:         userID,
+		Role:           args[2].(string),
+	})
+
+	return driver.RowsAffected(1), nil
+}
+
+var selectPattern = regexp.MustCompile(`(?s)SELECT(.*?)FROM\s+(\w+)`)
+
+// Query answers a SELECT with the columns it asks for.
+func (s testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.db.onQuery != nil {
+		s.db.onQuery()
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.err != nil {
+		return nil, s.db.err
+	}
+
+	match := selectPattern.FindStringSubmatch(s.query)
+	if match == nil {
+		return nil, errors.New("unsupported query: " + s.query)
+	}
+
+	var records []map[string]driver.Value
+
+	switch match[2] {
+	case "users":
+		for _, u := range append([]domain.User{s.db.user}, s.db.others...) {
+			if !matchesAny(args, u.ID.String(), u.Email, u.Username) {
+				continue
+			}
+
+			records = append(records, map[string]driver.Value{
+				"id": u.ID.String(), "username": u.Username, "email": u.Email, "password": u.Password, "role": u.Role,
+				"created_at": u.CreatedAt, "is_active": u.IsActive, "deleted_at": nil, "display_name": u.DisplayName,
+				"bio": u.Bio, "avatar_url": u.AvatarURL, "home_area": u.HomeArea, "location_precision": string(u.LocationPrecision),
+				"totp_secret": u.TOTPSecret, "totp_enabled": u.TOTPEnabled,
+			})
+		}
+	case "organizations":
+		for _, o := range s.db.organizations {
+			if args[0] == int64(o.ID) {
+				records = append(records, map[string]driver.Value{"id": int64(o.ID), "name": o.Name, "created_at": o.CreatedAt})
+			}
+		}
+	case "organization_members":
+		for _, m := range s.db.members {
+			// looked up by organization, and maybe user
+			if args[0] != int64(m.OrganizationID) || (len(args) == 2 && args[1] != m.UserID.String()) {
+				continue
+			}
+
+			username := ""
+			for _, u := range append([]domain.User{s.db.user}, s.db.others...) {
+				if u.ID == m.UserID {
+					username = u.Username
+				}
+			}
+
+			records = append(records, map[string]driver.Value{
+				"organization_id": int64(m.OrganizationID), "user_id": m.UserID.String(), "username": username,
+				"role": m.Role, "created_at": m.CreatedAt,
+			})
+		}
+	case "user_identities":
+		for _, i := range s.db.identities {
+			// looked up either by provider account or by user
+			if len(args) == 2 && (args[0] != i.Provider || args[1] != i.ProviderUserID) {
+				continue
+			}
+
+			if len(args) == 1 && args[0] != i.UserID.String() {
+				continue
+			}
+
+			records = append(records, map[string]driver.Value{
+				"id": int64(i.ID), "user_id": i.UserID.String(), "provider": i.Provider,
+				"provider_user_id": i.ProviderUserID, "email": i.Email, "created_at": i.CreatedAt,
+			})
+		}
+	}
+
+	rows := &testRows{}
+	for _, column := range strings.Split(match[1], ",") {
+		rows.columns = append(rows.columns, strings.TrimSpace(column))
+	}
+
+	for _, record := range records {
+		values := make([]driver.Value, len(rows.columns))
+		for i, column := range rows.columns {
+			// joins select columns through their table alias
+			_, name, found := strings.Cut(column, ".")
+			if !found {
+				name = column
+			}
+
+			values[i] = record[name]
+		}
+
+		rows.values = append(rows.values, values)
+	}
+
+	return rows, nil
+}
+
+// matchesAny reports whether any argument is one of keys, ignoring case like the
+// lookups on users do.
+func matchesAny(args []driver.Value, keys ...string) bool {
+	for _, arg := range args {
+		for _, key := range keys {
+			if s, ok := arg.(string); ok && strings.EqualFold(s, key) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type testRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *testRows) Columns() []string { return r.columns }
+func (r *testRows) Close() error      { return nil }
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
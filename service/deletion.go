@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/papacatzzi-server/domain"
+	smtp "github.com/papacatzzi-server/email"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	AccountRestoreTokenKey  = "ACCOUNT_RESTORE_TOKEN"
+	AccountRestoreTokenType = "account_restore"
+
+	AccountDeletionCodeKey     = "ACCOUNT_DELETION_CODE"
+	AccountDeletionAttemptsKey = "ACCOUNT_DELETION_ATTEMPTS"
+
+	AccountDeletionGracePeriod = time.Hour * 24 * 30
+)
+
+// BeginAccountDeletion emails a code to confirm the deletion of an account without a
+// password, so a stolen session alone can't delete it. Accounts with a password
+// confirm with their password and get no code.
+func (svc *AuthService) BeginAccountDeletion(identity domain.Identity) (err error) {
+	user, err := svc.getUser(identity)
+	if err != nil {
+		return
+	}
+
+	if user.Password != "" {
+		return
+	}
+
+	code, err := generateCode(6)
+	if err != nil {
+		err = fmt.Errorf("failed to generate verification code: %v", err)
+		return
+	}
+
+	key := appendToKey(AccountDeletionCodeKey, user.ID.String())
+	attemptsKey := appendToKey(AccountDeletionAttemptsKey, user.ID.String())
+
+	_, err = svc.redis.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.Set(context.Background(), key, hashVerificationCode(user.Email, code), VerificationCodeExpiration)
+		pipe.Del(context.Background(), attemptsKey)
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to cache verification code: %v", err)
+		return
+	}
+
+	go func() {
+		data := map[string]string{
+			"username": user.Username,
+			"code":     code,
+		}
+
+		content := smtp.EmailContent{
+			Subject:   "Confirm deleting your account",
+			Recipient: user.Email,
+			Body:      data,
+		}
+
+		svc.mailer.Send("email/templates/account-deletion-code.html", content)
+	}()
+
+	return
+}
+
+// DeleteAccount schedules the account for deletion and logs it out everywhere. Until
+// PurgeDeletedAccounts runs after the grace period, the emailed link restores it.
+// Accounts with a password confirm with it, the others with the code from
+// BeginAccountDeletion.
+func (svc *AuthService) DeleteAccount(identity domain.Identity, password string, code string) (err error) {
+	user, err := svc.getUser(identity)
+	if err != nil {
+		return
+	}
+
+	if user.Password != "" {
+		err = svc.verifyPassword(user, password)
+	} else {
+		err = svc.verifyDeletionCode(user, code)
+	}
+
+	if err != nil {
+		return
+	}
+
+	claims := newClaims(user, AccountRestoreTokenType, AccountDeletionGracePeriod)
+
+	token, err := svc.signToken(claims)
+	if err != nil {
+		err = fmt.Errorf("failed to create account restore token: %v", err)
+		return
+	}
+
+	err = svc.redis.Set(context.Background(), appendToKey(AccountRestoreTokenKey, claims.ID), user.ID.String(), AccountDeletionGracePeriod).Err()
+	if err != nil {
+		err = fmt.Errorf("failed to cache account restore token: %v", err)
+		return
+	}
+
+	err = svc.repository.SoftDeleteUser(user.ID, time.Now())
+	if err != nil {
+		err = fmt.Errorf("failed to delete user: %v", err)
+		return
+	}
+
+	err = svc.RevokeAllSessions(user.ID)
+	if err != nil {
+		return
+	}
+
+	svc.audit(user.ID, domain.AuditAccountDeleted, "", domain.Session{ID: identity.SessionID})
+
+	go func() {
+		data := map[string]string{
+			"username": user.Username,
+			"link":     svc.frontendURL + "/account/restore?token=" + url.QueryEscape(token),
+			"days":     fmt.Sprint(int(AccountDeletionGracePeriod.Hours() / 24)),
+		}
+
+		content := smtp.EmailContent{
+			Subject:   "Your account will be deleted",
+			Recipient: user.Email,
+			Body:      data,
+		}
+
+		svc.mailer.Send("email/templates/account-deleted.html", content)
+	}()
+
+	return
+}
+
+// verifyDeletionCode checks and uses up the code sent by BeginAccountDeletion.
+func (svc *AuthService) verifyDeletionCode(user domain.User, code string) (err error) {
+	key := appendToKey(AccountDeletionCodeKey, user.ID.String())
+	attemptsKey := appendToKey(AccountDeletionAttemptsKey, user.ID.String())
+
+	cached, err := svc.redis.Get(context.Background(), key).Result()
+	if errors.Is(err, redis.Nil) {
+		err = domain.ErrIncorrectCode
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to get verification code: %v", err)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(cached), []byte(hashVerificationCode(user.Email, code))) != 1 {
+		err = svc.recordFailedVerification(key, attemptsKey)
+		return
+	}
+
+	// a code confirms a single deletion, even if the account is restored in between
+	deleted, err := svc.redis.Del(context.Background(), key, attemptsKey).Result()
+	if err != nil {
+		err = fmt.Errorf("failed to consume verification code: %v", err)
+		return
+	}
+
+	if deleted == 0 {
+		err = domain.ErrIncorrectCode
+		return
+	}
+
+	return
+}
+
+// RestoreAccount cancels a pending deletion. The user logs in again afterwards.
+func (svc *AuthService) RestoreAccount(token string) (err error) {
+	claims, err := svc.VerifyToken(token, AccountRestoreTokenType)
+	if err != nil {
+		return
+	}
+
+	// consume the token so the same link cannot restore the account after a later deletion
+	deleted, err := svc.redis.Del(context.Background(), appendToKey(AccountRestoreTokenKey, claims.ID)).Result()
+	if err != nil {
+		err = fmt.Errorf("failed to consume account restore token: %v", err)
+		return
+	}
+
+	if deleted == 0 {
+		err = domain.ErrInvalidToken
+		return
+	}
+
+	restored, err := svc.repository.RestoreUser(claims.UserID)
+	if err != nil {
+		err = fmt.Errorf("failed to restore user: %v", err)
+		return
+	}
+
+	if !restored {
+		err = domain.ErrUserAccountNotFound
+		return
+	}
+
+	svc.audit(claims.UserID, domain.AuditAccountRestored, "", domain.Session{})
+	return
+}
+
+// PurgeDeletedAccounts permanently deletes the accounts whose grace period is over.
+func (svc *AuthService) PurgeDeletedAccounts() (purged int, err error) {
+	ids, err := svc.repository.GetUsersDeletedBefore(time.Now().Add(-AccountDeletionGracePeriod))
+	if err != nil {
+		err = fmt.Errorf("failed to fetch deleted users from db: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		if err = svc.repository.PurgeUser(id); err != nil {
+			err = fmt.Errorf("failed to purge user %s: %v", id, err)
+			return
+		}
+
+		purged++
+	}
+
+	return
+}
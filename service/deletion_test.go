@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/papacatzzi-server/domain"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	const current = "old tabby password"
+
+	tests := []struct {
+		name       string
+		noPassword bool
+		password   string
+
+		// code is checked against the one sent, "123456", if sent is set
+		sent bool
+		code string
+		want error
+	}{
+		{name: "password", password: current},
+		{name: "wrong password", password: "guessed password", want: domain.ErrInvalidCredentials},
+		{name: "code instead of a password", sent: true, code: "123456", want: domain.ErrInvalidCredentials},
+		{name: "no password, emailed code", noPassword: true, sent: true, code: "123456"},
+		{name: "no password, nothing to confirm with", noPassword: true, want: domain.ErrIncorrectCode},
+		{name: "no password, no code sent", noPassword: true, code: "123456", want: domain.ErrIncorrectCode},
+		{name: "no password, wrong code", noPassword: true, sent: true, code: "654321", want: domain.ErrIncorrectCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, db, user := newTestAccount(t, current)
+			if tt.noPassword {
+				db.user.Password = ""
+				user.Password = ""
+			}
+
+			if tt.sent {
+				svc.redis.Set(context.Background(), appendToKey(AccountDeletionCodeKey, user.ID.String()), hashVerificationCode(user.Email, "123456"), 0)
+			}
+
+			session := mustCreateSession(t, &svc, user)
+
+			err := svc.DeleteAccount(domain.Identity{UserID: user.ID, SessionID: session.ID}, tt.password, tt.code)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("DeleteAccount() error = %v, want %v", err, tt.want)
+			}
+
+			// only a confirmed deletion logs the account out
+			_, err = svc.getSession(session.ID)
+			if revoked := errors.Is(err, domain.ErrSessionNotFound); revoked != (tt.want == nil) {
+				t.Errorf("session revoked = %v, want %v", revoked, tt.want == nil)
+			}
+		})
+	}
+}
+
+func TestDeletionCodeIsSingleUse(t *testing.T) {
+	svc, db, user := newTestAccount(t, "")
+	db.user.Password = ""
+
+	key := appendToKey(AccountDeletionCodeKey, user.ID.String())
+	identity := domain.Identity{UserID: user.ID}
+
+	svc.redis.Set(context.Background(), key, hashVerificationCode(user.Email, "123456"), 0)
+
+	if err := svc.DeleteAccount(identity, "", "123456"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.DeleteAccount(identity, "", "123456"); !errors.Is(err, domain.ErrIncorrectCode) {
+		t.Errorf("reused code: error = %v, want %v", err, domain.ErrIncorrectCode)
+	}
+}
+
+func TestBeginAccountDeletion(t *testing.T) {
+	for _, hasPassword := range []bool{true, false} {
+		svc, db, user := newTestAccount(t, "old tabby password")
+		if !hasPassword {
+			db.user.Password = ""
+		}
+
+		if err := svc.BeginAccountDeletion(domain.Identity{UserID: user.ID}); err != nil {
+			t.Fatal(err)
+		}
+
+		sent := svc.redis.Exists(context.Background(), appendToKey(AccountDeletionCodeKey, user.ID.String())).Val() == 1
+		if sent == hasPassword {
+			t.Errorf("with a password: %v, code sent = %v", hasPassword, sent)
+		}
+	}
+}
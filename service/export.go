@@ -0,0 +1,556 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+	smtp "github.com/papacatzzi-server/email"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DataExportKey        = "DATA_EXPORT"
+	DataExportExpiration = time.Hour * 24
+
+	maxExportPhotoSize = 20 << 20
+)
+
+// photoClient downloads sighting photos into exports. Photo URLs come from users, so
+// it refuses to connect to anything that isn't a public address.
+var photoClient = &http.Client{
+	Timeout: time.Second * 15,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: time.Second * 5,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+
+				ip := net.ParseIP(host)
+				if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+					return fmt.Errorf("refusing to fetch photo from %s", host)
+				}
+
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+// ExportData builds a ZIP of the user's personal data in the background and emails
+// them a link to download it. Sessions come from AuthService, which owns them.
+func (svc *UserService) ExportData(identity domain.Identity, sessions []domain.Session) (err error) {
+	user, err := svc.GetMe(identity)
+	if err != nil {
+		return
+	}
+
+	svc.audit(user.ID, domain.AuditDataExported, "", domain.Session{ID: identity.SessionID})
+
+	go func() {
+		token, err := svc.buildExport(user, sessions)
+		if err != nil {
+			svc.logger.Error().Err(err).Str("user", user.ID.String()).Msg("failed to build data export")
+
+			data := map[string]string{
+				"username": user.Username,
+				"link":     svc.frontendURL + "/settings/export",
+			}
+
+			content := smtp.EmailContent{
+				Subject:   "Your data export failed",
+				Recipient: user.Email,
+				Body:      data,
+			}
+
+			svc.mailer.Send("email/templates/data-export-failed.html", content)
+			return
+		}
+
+		data := map[string]string{
+			"username": user.Username,
+			"link":     svc.frontendURL + "/settings/export?token=" + url.QueryEscape(token),
+		}
+
+		content := smtp.EmailContent{
+			Subject:   "Your data export is ready",
+			Recipient: user.Email,
+			Body:      data,
+		}
+
+		svc.mailer.Send("email/templates/data-export.html", content)
+	}()
+
+	return
+}
+
+// GetExport returns the path of a finished export, only to the user it belongs to.
+func (svc *UserService) GetExport(identity domain.Identity, token string) (path string, err error) {
+	owner, err := svc.redis.Get(context.Background(), appendToKey(DataExportKey, token)).Result()
+	if errors.Is(err, redis.Nil) || (err == nil && owner != identity.UserID.String()) {
+		err = domain.ErrExportNotFound
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to get data export: %v", err)
+		return
+	}
+
+	path = svc.exportPath(token)
+
+	if _, err = os.Stat(path); err != nil {
+		err = domain.ErrExportNotFound
+		return
+	}
+
+	return
+}
+
+// PurgeExpiredExports deletes export files nobody can download anymore.
+func (svc *UserService) PurgeExpiredExports() (err error) {
+	entries, err := os.ReadDir(svc.exportsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		if time.Since(info.ModTime()) > DataExportExpiration {
+			os.Remove(filepath.Join(svc.exportsDir, entry.Name()))
+		}
+	}
+
+	return
+}
+
+type exportProfile struct {
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	DisplayName string    `json:"displayName"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatarURL"`
+	HomeArea    string    `json:"homeArea"`
+	MFAEnabled  bool      `json:"mfaEnabled"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type exportIdentity struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type exportPasskey struct {
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+type exportFollows struct {
+	Following []exportFollow `json:"following"`
+	Followers []exportFollow `json:"followers"`
+}
+
+type exportFollow struct {
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type exportMembership struct {
+	OrganizationID int    `json:"organizationId"`
+	Name           string `json:"name"`
+	Role           string `json:"role"`
+}
+
+type exportComment struct {
+	ID         int        `json:"id"`
+	SightingID int        `json:"sightingId"`
+	ParentID   *int       `json:"parentId"`
+	Body       string     `json:"body"`
+	Status     string     `json:"status"`
+	Mentions   []string   `json:"mentions"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	EditedAt   *time.Time `json:"editedAt"`
+}
+
+type exportConfirmation struct {
+	SightingID int       `json:"sightingId"`
+	PhotoURL   string    `json:"photoURL"`
+	Latitude   *float64  `json:"latitude"`
+	Longitude  *float64  `json:"longitude"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type exportNotifications struct {
+	AlertAreas  []exportAlertArea             `json:"alertAreas"`
+	Preferences exportNotificationPreferences `json:"preferences"`
+}
+
+// exportAlertArea is a polygon of [longitude, latitude] pairs, or a point and a radius.
+type exportAlertArea struct {
+	ID           int          `json:"id"`
+	Name         string       `json:"name"`
+	Polygon      [][2]float64 `json:"polygon,omitempty"`
+	Latitude     *float64     `json:"latitude,omitempty"`
+	Longitude    *float64     `json:"longitude,omitempty"`
+	RadiusMeters float64      `json:"radiusMeters,omitempty"`
+	CreatedAt    time.Time    `json:"createdAt"`
+}
+
+type exportNotificationPreferences struct {
+	Email      bool   `json:"email"`
+	InApp      bool   `json:"inApp"`
+	Push       bool   `json:"push"`
+	MaxPerHour int    `json:"maxPerHour"`
+	QuietStart string `json:"quietStart"`
+	QuietEnd   string `json:"quietEnd"`
+	TimeZone   string `json:"timeZone"`
+}
+
+type exportAuditEvent struct {
+	Type      string    `json:"type"`
+	Detail    string    `json:"detail,omitempty"`
+	SessionID string    `json:"sessionId,omitempty"`
+	IPAddress string    `json:"ipAddress,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONPoint           `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+func (svc *UserService) buildExport(user domain.User, sessions []domain.Session) (token string, err error) {
+	sightings, err := svc.sightingRepository.GetSightingsByReporter(domain.Identity{UserID: user.ID}, user.ID.String(), 0)
+	if err != nil {
+		return
+	}
+
+	identities, err := svc.repository.GetIdentities(user.ID)
+	if err != nil {
+		return
+	}
+
+	credentials, err := svc.repository.GetWebAuthnCredentials(user.ID)
+	if err != nil {
+		return
+	}
+
+	auditEvents, err := svc.repository.GetAuditEvents(user.ID)
+	if err != nil {
+		return
+	}
+
+	following, err := svc.repository.GetFollowing(user.ID)
+	if err != nil {
+		return
+	}
+
+	followers, err := svc.repository.GetFollowers(user.ID)
+	if err != nil {
+		return
+	}
+
+	organizations, err := svc.organizationRepository.GetOrganizationsByMember(user.ID)
+	if err != nil {
+		return
+	}
+
+	comments, err := svc.commentRepository.GetCommentsByAuthor(user.ID)
+	if err != nil {
+		return
+	}
+
+	confirmations, err := svc.sightingRepository.GetConfirmationsByUser(user.ID)
+	if err != nil {
+		return
+	}
+
+	areas, err := svc.notificationRepository.GetAlertAreas(user.ID)
+	if err != nil {
+		return
+	}
+
+	prefs, err := svc.notificationRepository.GetNotificationPreferences(user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		prefs, err = domain.DefaultNotificationPreferences, nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(svc.exportsDir, 0o700); err != nil {
+		return
+	}
+
+	token = uuid.NewString()
+
+	f, err := os.OpenFile(svc.exportPath(token), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	// don't leave a half written archive behind for PurgeExpiredExports to find
+	defer func() {
+		if err != nil {
+			os.Remove(svc.exportPath(token))
+		}
+	}()
+
+	archive := zip.NewWriter(f)
+
+	err = writeJSON(archive, "profile.json", exportProfile{
+		ID:          user.ID.String(),
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+		HomeArea:    user.HomeArea,
+		MFAEnabled:  user.TOTPEnabled,
+		CreatedAt:   user.CreatedAt,
+	})
+	if err != nil {
+		return
+	}
+
+	collection := geoJSONFeatureCollection{Type: "FeatureCollection", Features: make([]geoJSONFeature, 0)}
+	for _, s := range sightings {
+		photo := ""
+		if s.PhotoURL != "" {
+			photo = svc.exportPhoto(archive, s)
+		}
+
+		collection.Features = append(collection.Features, geoJSONFeature{
+			Type:     "Feature",
+			Geometry: geoJSONPoint{Type: "Point", Coordinates: [2]float64{s.Longitude, s.Latitude}},
+			Properties: map[string]interface{}{
+				"id":          s.ID,
+				"animal":      s.Animal,
+				"description": s.Description,
+				"photoURL":    s.PhotoURL,
+				"photo":       photo,
+				"visibility":  s.Visibility,
+				"timestamp":   s.Timestamp,
+			},
+		})
+	}
+
+	if err = writeJSON(archive, "sightings.geojson", collection); err != nil {
+		return
+	}
+
+	if err = writeJSON(archive, "sessions.json", sessions); err != nil {
+		return
+	}
+
+	var exportedIdentities []exportIdentity
+	for _, i := range identities {
+		exportedIdentities = append(exportedIdentities, exportIdentity{Provider: i.Provider, Email: i.Email, CreatedAt: i.CreatedAt})
+	}
+
+	if err = writeJSON(archive, "linked_accounts.json", exportedIdentities); err != nil {
+		return
+	}
+
+	var passkeys []exportPasskey
+	for _, c := range credentials {
+		passkeys = append(passkeys, exportPasskey{Name: c.Name, CreatedAt: c.CreatedAt, LastUsedAt: c.LastUsedAt})
+	}
+
+	if err = writeJSON(archive, "passkeys.json", passkeys); err != nil {
+		return
+	}
+
+	exportedFollows := exportFollows{Following: make([]exportFollow, 0), Followers: make([]exportFollow, 0)}
+	for _, f := range following {
+		exportedFollows.Following = append(exportedFollows.Following, exportFollow{Username: f.Username, CreatedAt: f.CreatedAt})
+	}
+
+	for _, f := range followers {
+		exportedFollows.Followers = append(exportedFollows.Followers, exportFollow{Username: f.Username, CreatedAt: f.CreatedAt})
+	}
+
+	if err = writeJSON(archive, "follows.json", exportedFollows); err != nil {
+		return
+	}
+
+	memberships := make([]exportMembership, 0)
+	for _, o := range organizations {
+		memberships = append(memberships, exportMembership{OrganizationID: o.ID, Name: o.Name, Role: o.Role})
+	}
+
+	if err = writeJSON(archive, "organizations.json", memberships); err != nil {
+		return
+	}
+
+	exportedComments := make([]exportComment, 0)
+	for _, c := range comments {
+		exportedComments = append(exportedComments, exportComment{
+			ID:         c.ID,
+			SightingID: c.SightingID,
+			ParentID:   c.ParentID,
+			Body:       c.Body,
+			Status:     string(c.Status),
+			Mentions:   c.Mentions,
+			CreatedAt:  c.CreatedAt,
+			EditedAt:   c.EditedAt,
+		})
+	}
+
+	if err = writeJSON(archive, "comments.json", exportedComments); err != nil {
+		return
+	}
+
+	exportedConfirmations := make([]exportConfirmation, 0)
+	for _, c := range confirmations {
+		exportedConfirmations = append(exportedConfirmations, exportConfirmation{
+			SightingID: c.SightingID,
+			PhotoURL:   c.PhotoURL,
+			Latitude:   c.Latitude,
+			Longitude:  c.Longitude,
+			CreatedAt:  c.CreatedAt,
+		})
+	}
+
+	if err = writeJSON(archive, "confirmations.json", exportedConfirmations); err != nil {
+		return
+	}
+
+	exportedAreas := make([]exportAlertArea, 0)
+	for _, a := range areas {
+		area := exportAlertArea{ID: a.ID, Name: a.Name, Polygon: a.Polygon, CreatedAt: a.CreatedAt}
+		if len(a.Polygon) == 0 {
+			area.Latitude, area.Longitude, area.RadiusMeters = &a.Latitude, &a.Longitude, a.RadiusMeters
+		}
+
+		exportedAreas = append(exportedAreas, area)
+	}
+
+	err = writeJSON(archive, "notifications.json", exportNotifications{
+		AlertAreas: exportedAreas,
+		Preferences: exportNotificationPreferences{
+			Email:      prefs.Email,
+			InApp:      prefs.InApp,
+			Push:       prefs.Push,
+			MaxPerHour: prefs.MaxPerHour,
+			QuietStart: prefs.QuietStart,
+			QuietEnd:   prefs.QuietEnd,
+			TimeZone:   prefs.TimeZone,
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	var events []exportAuditEvent
+	for _, e := range auditEvents {
+		events = append(events, exportAuditEvent{
+			Type:      string(e.Type),
+			Detail:    e.Detail,
+			SessionID: e.SessionID,
+			IPAddress: e.IPAddress,
+			UserAgent: e.UserAgent,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+
+	if err = writeJSON(archive, "audit_events.json", events); err != nil {
+		return
+	}
+
+	if err = archive.Close(); err != nil {
+		return
+	}
+
+	err = svc.redis.Set(context.Background(), appendToKey(DataExportKey, token), user.ID.String(), DataExportExpiration).Err()
+	return
+}
+
+// exportPhoto copies a sighting's photo into the archive and returns its name there.
+// Photos that can't be fetched are left out, the sighting still links to them.
+func (svc *UserService) exportPhoto(archive *zip.Writer, sighting domain.Sighting) (name string) {
+	u, err := url.Parse(sighting.PhotoURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return
+	}
+
+	res, err := photoClient.Get(u.String())
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return
+	}
+
+	name = fmt.Sprintf("photos/%d%s", sighting.ID, path.Ext(u.Path))
+
+	w, err := archive.Create(name)
+	if err != nil {
+		return ""
+	}
+
+	if _, err = io.Copy(w, io.LimitReader(res.Body, maxExportPhotoSize)); err != nil {
+		return ""
+	}
+
+	return
+}
+
+func (svc *UserService) exportPath(token string) string {
+	return filepath.Join(svc.exportsDir, token+".zip")
+}
+
+func writeJSON(archive *zip.Writer, name string, v interface{}) (err error) {
+	w, err := archive.Create(name)
+	if err != nil {
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
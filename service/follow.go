@@ -0,0 +1,43 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/papacatzzi-server/domain"
+)
+
+// Follow lets the caller see the sightings username shares with their followers.
+func (svc *UserService) Follow(identity domain.Identity, username string) (err error) {
+	followee, err := svc.getProfile(username)
+	if err != nil {
+		return
+	}
+
+	if followee.ID == identity.UserID {
+		err = domain.ErrFollowSelf
+		return
+	}
+
+	err = svc.repository.InsertFollow(identity.UserID, followee.ID)
+	if err != nil {
+		err = fmt.Errorf("failed to follow user: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *UserService) Unfollow(identity domain.Identity, username string) (err error) {
+	followee, err := svc.getProfile(username)
+	if err != nil {
+		return
+	}
+
+	err = svc.repository.DeleteFollow(identity.UserID, followee.ID)
+	if err != nil {
+		err = fmt.Errorf("failed to unfollow user: %v", err)
+		return
+	}
+
+	return
+}
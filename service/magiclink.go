@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/papacatzzi-server/domain"
+	smtp "github.com/papacatzzi-server/email"
+)
+
+const (
+	MagicLinkTokenKey        = "MAGIC_LINK_TOKEN"
+	MagicLinkTokenType       = "magic_link"
+	MagicLinkTokenExpiration = time.Minute * 15
+)
+
+// BeginMagicLinkLogin emails a single use sign in link. Unknown or inactive
+// emails are ignored so the response doesn't reveal which accounts exist.
+func (svc *AuthService) BeginMagicLinkLogin(email string) (err error) {
+	email = normalizeEmail(email)
+
+	user, err := svc.repository.GetUserByEmail(email)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !user.IsActive) {
+		return nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to fetch user from db: %v", err)
+		return
+	}
+
+	claims := newClaims(user, MagicLinkTokenType, MagicLinkTokenExpiration)
+
+	token, err := svc.signToken(claims)
+	if err != nil {
+		err = fmt.Errorf("failed to create magic link token: %v", err)
+		return
+	}
+
+	key := appendToKey(MagicLinkTokenKey, claims.ID)
+
+	err = svc.redis.Set(context.Background(), key, user.Email, MagicLinkTokenExpiration).Err()
+	if err != nil {
+		err = fmt.Errorf("failed to cache magic link token: %v", err)
+		return
+	}
+
+	go func() {
+		data := map[string]string{
+			"username": user.Username,
+			"link":     svc.frontendURL + "/login/magic?token=" + url.QueryEscape(token),
+		}
+
+		content := smtp.EmailContent{
+			Subject:   "Your Papacatzzi login link",
+			Recipient: user.Email,
+			Body:      data,
+		}
+
+		svc.mailer.Send("email/templates/magic-link.html", content)
+	}()
+
+	return
+}
+
+// CompleteMagicLinkLogin exchanges the emailed token for the same result as Login.
+func (svc *AuthService) CompleteMagicLinkLogin(token string, client domain.Session) (accessToken string, refreshToken string, mfaToken string, err error) {
+	claims, err := svc.VerifyToken(token, MagicLinkTokenType)
+	if err != nil {
+		return
+	}
+
+	// consume the token so the link cannot be used twice
+	deleted, err := svc.redis.Del(context.Background(), appendToKey(MagicLinkTokenKey, claims.ID)).Result()
+	if err != nil {
+		err = fmt.Errorf("failed to consume magic link token: %v", err)
+		return
+	}
+
+	if deleted == 0 {
+		err = domain.ErrInvalidToken
+		return
+	}
+
+	user, err := svc.repository.GetUserByID(claims.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = domain.ErrInvalidToken
+			return
+		}
+
+		err = fmt.Errorf("failed to fetch user from db: %v", err)
+		return
+	}
+
+	if user.TOTPEnabled {
+		mfaToken, err = svc.createMFAChallenge(user)
+		return
+	}
+
+	accessToken, refreshToken, err = svc.issueTokens(user, client)
+	return
+}
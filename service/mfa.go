@@ -0,0 +1,346 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/papacatzzi-server/domain"
+	"github.com/pquerna/otp/totp"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	MFATokenType       = "mfa"
+	MFATokenExpiration = time.Minute * 5
+
+	MFAChallengeKey   = "MFA_CHALLENGE"
+	TOTPEnrollmentKey = "TOTP_ENROLLMENT"
+	UsedTOTPCodeKey   = "USED_TOTP_CODE"
+
+	TOTPIssuer             = "Papacatzzi"
+	TOTPEnrollmentDuration = time.Minute * 10
+
+	maxMFAAttempts    = 5
+	recoveryCodeCount = 10
+)
+
+// BeginTOTPEnrollment generates a new secret that only takes effect once
+// ConfirmTOTPEnrollment sees a valid code for it.
+func (svc *AuthService) BeginTOTPEnrollment(identity domain.Identity) (secret string, uri string, qrCode []byte, err error) {
+	user, err := svc.getUser(identity)
+	if err != nil {
+		return
+	}
+
+	if user.TOTPEnabled {
+		err = domain.ErrMFAAlreadyEnabled
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      TOTPIssuer,
+		AccountName: user.Email,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to generate totp secret: %v", err)
+		return
+	}
+
+	pendingKey := appendToKey(TOTPEnrollmentKey, user.ID.String())
+
+	err = svc.redis.Set(context.Background(), pendingKey, key.Secret(), TOTPEnrollmentDuration).Err()
+	if err != nil {
+		err = fmt.Errorf("failed to cache totp secret: %v", err)
+		return
+	}
+
+	img, err := key.Image(256, 256)
+	if err != nil {
+		err = fmt.Errorf("failed to render totp qr code: %v", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, img); err != nil {
+		err = fmt.Errorf("failed to encode totp qr code: %v", err)
+		return
+	}
+
+	return key.Secret(), key.URL(), buf.Bytes(), nil
+}
+
+// ConfirmTOTPEnrollment enables two-factor authentication and returns the
+// recovery codes, which are only ever shown this once.
+func (svc *AuthService) ConfirmTOTPEnrollment(identity domain.Identity, code string) (recoveryCodes []string, err error) {
+	user, err := svc.getUser(identity)
+	if err != nil {
+		return
+	}
+
+	if user.TOTPEnabled {
+		err = domain.ErrMFAAlreadyEnabled
+		return
+	}
+
+	pendingKey := appendToKey(TOTPEnrollmentKey, user.ID.String())
+
+	secret, err := svc.redis.Get(context.Background(), pendingKey).Result()
+	if errors.Is(err, redis.Nil) {
+		err = domain.ErrMFAEnrollmentEnded
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to get totp secret: %v", err)
+		return
+	}
+
+	if !totp.Validate(code, secret) {
+		err = domain.ErrIncorrectCode
+		return
+	}
+
+	err = svc.repository.UpdateTOTP(user.ID, secret, true)
+	if err != nil {
+		err = fmt.Errorf("failed to enable totp: %v", err)
+		return
+	}
+
+	recoveryCodes, err = svc.replaceRecoveryCodes(user)
+	if err != nil {
+		return
+	}
+
+	svc.redis.Del(context.Background(), pendingKey)
+
+	svc.audit(user.ID, domain.AuditMFAEnabled, "", domain.Session{ID: identity.SessionID})
+	return
+}
+
+// DisableTOTP turns two-factor authentication off after checking a current code.
+func (svc *AuthService) DisableTOTP(identity domain.Identity, code string) (err error) {
+	user, err := svc.getUser(identity)
+	if err != nil {
+		return
+	}
+
+	if !user.TOTPEnabled {
+		err = domain.ErrMFANotEnabled
+		return
+	}
+
+	if err = svc.verifySecondFactor(user, code); err != nil {
+		return
+	}
+
+	err = svc.repository.UpdateTOTP(user.ID, "", false)
+	if err != nil {
+		err = fmt.Errorf("failed to disable totp: %v", err)
+		return
+	}
+
+	err = svc.repository.DeleteRecoveryCodes(user.ID)
+	if err != nil {
+		err = fmt.Errorf("failed to delete recovery codes: %v", err)
+		return
+	}
+
+	svc.audit(user.ID, domain.AuditMFADisabled, "", domain.Session{ID: identity.SessionID})
+	return
+}
+
+// RegenerateRecoveryCodes invalidates every previous recovery code.
+func (svc *AuthService) RegenerateRecoveryCodes(identity domain.Identity, code string) (recoveryCodes []string, err error) {
+	user, err := svc.getUser(identity)
+	if err != nil {
+		return
+	}
+
+	if !user.TOTPEnabled {
+		err = domain.ErrMFANotEnabled
+		return
+	}
+
+	if err = svc.verifySecondFactor(user, code); err != nil {
+		return
+	}
+
+	return svc.replaceRecoveryCodes(user)
+}
+
+// CompleteMFALogin exchanges the challenge returned by Login plus a TOTP or
+// recovery code for the usual access and refresh tokens.
+func (svc *AuthService) CompleteMFALogin(mfaToken string, code string, client domain.Session) (accessToken string, refreshToken string, err error) {
+	claims, err := svc.VerifyToken(mfaToken, MFATokenType)
+	if err != nil {
+		return
+	}
+
+	key := appendToKey(MFAChallengeKey, claims.ID)
+
+	exists, err := svc.redis.Exists(context.Background(), key).Result()
+	if err != nil {
+		err = fmt.Errorf("failed to get mfa challenge: %v", err)
+		return
+	}
+
+	if exists == 0 {
+		err = domain.ErrInvalidToken
+		return
+	}
+
+	attempts, err := svc.redis.Incr(context.Background(), key).Result()
+	if err != nil {
+		err = fmt.Errorf("failed to count mfa attempts: %v", err)
+		return
+	}
+
+	if attempts > maxMFAAttempts {
+		svc.redis.Del(context.Background(), key)
+		err = domain.ErrTooManyAttempts
+		return
+	}
+
+	user, err := svc.repository.GetUserByID(claims.UserID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch user from db: %v", err)
+		return
+	}
+
+	if err = svc.verifySecondFactor(user, code); err != nil {
+		return
+	}
+
+	// a challenge can only be completed once
+	deleted, err := svc.redis.Del(context.Background(), key).Result()
+	if err != nil {
+		err = fmt.Errorf("failed to consume mfa challenge: %v", err)
+		return
+	}
+
+	if deleted == 0 {
+		err = domain.ErrInvalidToken
+		return
+	}
+
+	return svc.issueTokens(user, client)
+}
+
+func (svc *AuthService) createMFAChallenge(user domain.User) (mfaToken string, err error) {
+	claims := newClaims(user, MFATokenType, MFATokenExpiration)
+
+	mfaToken, err = svc.signToken(claims)
+	if err != nil {
+		err = fmt.Errorf("failed to create mfa token: %v", err)
+		return
+	}
+
+	err = svc.redis.Set(context.Background(), appendToKey(MFAChallengeKey, claims.ID), 0, MFATokenExpiration).Err()
+	if err != nil {
+		err = fmt.Errorf("failed to cache mfa challenge: %v", err)
+		return
+	}
+
+	return
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code.
+func (svc *AuthService) verifySecondFactor(user domain.User, code string) (err error) {
+	code = strings.TrimSpace(code)
+
+	if len(code) == 6 {
+		if !totp.Validate(code, user.TOTPSecret) {
+			return domain.ErrIncorrectCode
+		}
+
+		// a code stays valid for its whole time step, don't let it be replayed
+		usedKey := appendToKey(UsedTOTPCodeKey, user.ID.String()+"_"+code)
+
+		fresh, err := svc.redis.SetNX(context.Background(), usedKey, 1, time.Minute*2).Result()
+		if err != nil {
+			return fmt.Errorf("failed to record totp code: %v", err)
+		}
+
+		if !fresh {
+			return domain.ErrIncorrectCode
+		}
+
+		return nil
+	}
+
+	used, err := svc.repository.UseRecoveryCode(user.ID, hashRecoveryCode(code))
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %v", err)
+	}
+
+	if !used {
+		return domain.ErrIncorrectCode
+	}
+
+	return
+}
+
+func (svc *AuthService) replaceRecoveryCodes(user domain.User) (codes []string, err error) {
+	var hashes []string
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %v", err)
+		}
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	err = svc.repository.ReplaceRecoveryCodes(user.ID, hashes)
+	if err != nil {
+		err = fmt.Errorf("failed to save recovery codes: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *AuthService) getUser(identity domain.Identity) (user domain.User, err error) {
+	user, err = svc.repository.GetUserByID(identity.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = domain.ErrUserAccountNotFound
+			return
+		}
+
+		err = fmt.Errorf("failed to fetch user from db: %v", err)
+		return
+	}
+
+	return
+}
+
+// generateRecoveryCode returns 50 random bits formatted as xxxxx-xxxxx.
+func generateRecoveryCode() (code string, err error) {
+	b := make([]byte, 10)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+
+	encoded := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	return encoded[:5] + "-" + encoded[5:10], nil
+}
+
+// recovery codes carry enough entropy that a plain hash is sufficient at rest
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
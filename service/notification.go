@@ -0,0 +1,360 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/papacatzzi-server/domain"
+	smtp "github.com/papacatzzi-server/email"
+	"github.com/papacatzzi-server/postgres"
+)
+
+const (
+	// MaxAlertAreas keeps the matcher's work per sighting bounded.
+	MaxAlertAreas = 20
+
+	// notificationLease is how long a notification being delivered is left alone
+	// before another attempt is made.
+	notificationLease   = 5 * time.Minute
+	maxDeliveryAttempts = 5
+	deliveryBatchSize   = 100
+)
+
+var errPushDisabled = errors.New("push notifications are not configured")
+
+// PushSender delivers a notification to one device, through whichever push service
+// the apps register their devices with.
+type PushSender func(token string, notification domain.Notification) error
+
+type NotificationService struct {
+	repository postgres.NotificationRepository
+	mailer     smtp.Mailer
+
+	// push is nil when no push service is configured, nothing is queued for push then.
+	push PushSender
+
+	// frontendURL is the web app that links in emails open.
+	frontendURL string
+}
+
+func NewNotificationService(repo postgres.NotificationRepository, mailer smtp.Mailer, push PushSender, frontendURL string) NotificationService {
+	return NotificationService{repository: repo, mailer: mailer, push: push, frontendURL: frontendURL}
+}
+
+// CreateArea saves an area the caller wants to hear about new sightings in.
+func (svc *NotificationService) CreateArea(identity domain.Identity, area domain.AlertArea) (id int, err error) {
+	count, err := svc.repository.CountAlertAreas(identity.UserID)
+	if err != nil {
+		err = fmt.Errorf("failed to count alert areas: %v", err)
+		return
+	}
+
+	if count >= MaxAlertAreas {
+		err = domain.ErrTooManyAlertAreas
+		return
+	}
+
+	area.UserID = identity.UserID
+
+	id, err = svc.repository.InsertAlertArea(area)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = domain.ErrInvalidAlertArea
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to insert alert area: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *NotificationService) ListAreas(identity domain.Identity) (areas []domain.AlertArea, err error) {
+	areas, err = svc.repository.GetAlertAreas(identity.UserID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch alert areas from db: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *NotificationService) DeleteArea(identity domain.Identity, id int) (err error) {
+	deleted, err := svc.repository.DeleteAlertArea(id, identity.UserID)
+	if err != nil {
+		err = fmt.Errorf("failed to delete alert area: %v", err)
+		return
+	}
+
+	if !deleted {
+		err = domain.ErrAlertAreaNotFound
+		return
+	}
+
+	return
+}
+
+func (svc *NotificationService) GetPreferences(identity domain.Identity) (prefs domain.NotificationPreferences, err error) {
+	prefs, err = svc.repository.GetNotificationPreferences(identity.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.DefaultNotificationPreferences, nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to fetch notification preferences from db: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *NotificationService) UpdatePreferences(identity domain.Identity, prefs domain.NotificationPreferences) (err error) {
+	if prefs.Push && svc.push == nil {
+		err = domain.ErrPushUnavailable
+		return
+	}
+
+	err = svc.repository.UpsertNotificationPreferences(identity.UserID, prefs)
+	if err != nil {
+		err = fmt.Errorf("failed to update notification preferences: %v", err)
+		return
+	}
+
+	return
+}
+
+// RegisterPushDevice is refused while no push service is configured, the device would
+// never hear from us.
+func (svc *NotificationService) RegisterPushDevice(identity domain.Identity, token string) (err error) {
+	if svc.push == nil {
+		err = domain.ErrPushUnavailable
+		return
+	}
+
+	err = svc.repository.InsertPushDevice(identity.UserID, token)
+	if err != nil {
+		err = fmt.Errorf("failed to register push device: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *NotificationService) UnregisterPushDevice(identity domain.Identity, token string) (err error) {
+	err = svc.repository.DeletePushDevice(identity.UserID, token)
+	if err != nil {
+		err = fmt.Errorf("failed to unregister push device: %v", err)
+		return
+	}
+
+	return
+}
+
+// List returns the caller's in-app notifications, newest first.
+func (svc *NotificationService) List(identity domain.Identity, limit int) (notifications []domain.Notification, err error) {
+	notifications, err = svc.repository.GetNotifications(identity.UserID, limit)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch notifications from db: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *NotificationService) MarkRead(identity domain.Identity, id int) (err error) {
+	found, err := svc.repository.MarkNotificationRead(id, identity.UserID)
+	if err != nil {
+		err = fmt.Errorf("failed to mark notification read: %v", err)
+		return
+	}
+
+	if !found {
+		err = domain.ErrNotificationNotFound
+		return
+	}
+
+	return
+}
+
+// Match queues notifications for everyone with an area a new sighting falls in. Users
+// over their hourly limit only get the in-app notification, email and push raised in
+// quiet hours wait until they end.
+func (svc *NotificationService) Match(sightingID int) (err error) {
+	matches, err := svc.repository.GetAreaMatches(sightingID)
+	if err != nil {
+		err = fmt.Errorf("failed to match sighting against alert areas: %v", err)
+		return
+	}
+
+	now := time.Now()
+
+	var notifications []domain.Notification
+	for _, m := range matches {
+		areaID := m.AreaID
+		notification := domain.Notification{
+			UserID:     m.UserID,
+			SightingID: sightingID,
+			AreaID:     &areaID,
+			DeliverAt:  now,
+		}
+
+		if m.Preferences.InApp {
+			n := notification
+			n.Channel, n.Status = domain.ChannelInApp, domain.NotificationSent
+			notifications = append(notifications, n)
+		}
+
+		if m.RecentAlerts >= m.Preferences.MaxPerHour {
+			continue
+		}
+
+		notification.Status = domain.NotificationPending
+		notification.DeliverAt = quietHoursEnd(m.Preferences, now)
+
+		if m.Preferences.Email {
+			n := notification
+			n.Channel = domain.ChannelEmail
+			notifications = append(notifications, n)
+		}
+
+		if m.Preferences.Push && svc.push != nil {
+			n := notification
+			n.Channel = domain.ChannelPush
+			notifications = append(notifications, n)
+		}
+	}
+
+	if len(notifications) == 0 {
+		return
+	}
+
+	err = svc.repository.InsertNotifications(notifications)
+	if err != nil {
+		err = fmt.Errorf("failed to queue notifications: %v", err)
+		return
+	}
+
+	return
+}
+
+// quietHoursEnd returns when an alert raised at now may go out, which is when the
+// user's quiet hours end if now falls in them.
+func quietHoursEnd(prefs domain.NotificationPreferences, now time.Time) time.Time {
+	start, err := time.Parse("15:04", prefs.QuietStart)
+	if err != nil {
+		return now
+	}
+
+	end, err := time.Parse("15:04", prefs.QuietEnd)
+	if err != nil {
+		return now
+	}
+
+	loc, err := time.LoadLocation(prefs.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+
+	// quiet hours usually span midnight
+	quiet := minute >= startMinute && minute < endMinute
+	if startMinute > endMinute {
+		quiet = minute >= startMinute || minute < endMinute
+	}
+
+	if !quiet {
+		return now
+	}
+
+	until := time.Date(local.Year(), local.Month(), local.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+	if !until.After(local) {
+		until = until.AddDate(0, 0, 1)
+	}
+
+	return until
+}
+
+// Deliver sends a batch of due email and push notifications. Failed ones are retried
+// once their lease is up, and given up on after maxDeliveryAttempts.
+func (svc *NotificationService) Deliver() (delivered int, err error) {
+	notifications, err := svc.repository.ClaimNotifications(time.Now(), notificationLease, deliveryBatchSize)
+	if err != nil {
+		err = fmt.Errorf("failed to claim notifications: %v", err)
+		return
+	}
+
+	for _, n := range notifications {
+		status := domain.NotificationSent
+
+		if deliveryErr := svc.deliver(n); deliveryErr != nil {
+			if n.Attempts < maxDeliveryAttempts {
+				continue
+			}
+
+			status = domain.NotificationFailed
+		}
+
+		err = svc.repository.UpdateNotificationStatus(n.ID, status)
+		if err != nil {
+			err = fmt.Errorf("failed to update notification status: %v", err)
+			return
+		}
+
+		if status == domain.NotificationSent {
+			delivered++
+		}
+	}
+
+	return
+}
+
+func (svc *NotificationService) deliver(n domain.Notification) (err error) {
+	switch n.Channel {
+	case domain.ChannelEmail:
+		data := map[string]string{
+			"animal":   n.Animal,
+			"area":     n.AreaName,
+			"link":     svc.frontendURL + "/sightings/" + strconv.Itoa(n.SightingID),
+			"settings": svc.frontendURL + "/settings/notifications",
+		}
+
+		content := smtp.EmailContent{
+			Subject:   "New " + n.Animal + " sighting near " + n.AreaName,
+			Recipient: n.Recipient,
+			Body:      data,
+		}
+
+		return svc.mailer.Send("email/templates/sighting-alert.html", content)
+
+	case domain.ChannelPush:
+		if svc.push == nil {
+			return errPushDisabled
+		}
+
+		tokens, err := svc.repository.GetPushDevices(n.UserID)
+		if err != nil {
+			return err
+		}
+
+		for _, token := range tokens {
+			err = svc.push(token, n)
+			if errors.Is(err, errPushDeviceGone) {
+				err = svc.repository.DeletePushDevice(n.UserID, token)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return
+}
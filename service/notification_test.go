@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+)
+
+func TestQuietHoursEnd(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefs := func(start string, end string, zone string) domain.NotificationPreferences {
+		return domain.NotificationPreferences{QuietStart: start, QuietEnd: end, TimeZone: zone}
+	}
+
+	tests := []struct {
+		name  string
+		prefs domain.NotificationPreferences
+		now   time.Time
+		want  time.Time
+	}{
+		{
+			name:  "no quiet hours",
+			prefs: prefs("", "", "UTC"),
+			now:   time.Date(2026, 5, 4, 23, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, 5, 4, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "before overnight quiet hours",
+			prefs: prefs("22:00", "07:00", "UTC"),
+			now:   time.Date(2026, 5, 4, 21, 59, 0, 0, time.UTC),
+			want:  time.Date(2026, 5, 4, 21, 59, 0, 0, time.UTC),
+		},
+		{
+			name:  "late evening in overnight quiet hours",
+			prefs: prefs("22:00", "07:00", "UTC"),
+			now:   time.Date(2026, 5, 4, 23, 30, 0, 0, time.UTC),
+			want:  time.Date(2026, 5, 5, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "early morning in overnight quiet hours",
+			prefs: prefs("22:00", "07:00", "UTC"),
+			now:   time.Date(2026, 5, 5, 3, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, 5, 5, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "quiet hours just ended",
+			prefs: prefs("22:00", "07:00", "UTC"),
+			now:   time.Date(2026, 5, 5, 7, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, 5, 5, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "daytime quiet hours",
+			prefs: prefs("12:00", "14:00", "UTC"),
+			now:   time.Date(2026, 5, 5, 13, 15, 0, 0, time.UTC),
+			want:  time.Date(2026, 5, 5, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "outside daytime quiet hours",
+			prefs: prefs("12:00", "14:00", "UTC"),
+			now:   time.Date(2026, 5, 5, 23, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, 5, 5, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "quiet hours in the user's time zone",
+			prefs: prefs("22:00", "07:00", "Europe/Paris"),
+			now:   time.Date(2026, 5, 4, 21, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, 5, 5, 7, 0, 0, 0, paris),
+		},
+		{
+			name:  "not yet quiet in the user's time zone",
+			prefs: prefs("22:00", "07:00", "Europe/Paris"),
+			now:   time.Date(2026, 5, 4, 19, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, 5, 4, 19, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "quiet hours ending on a daylight saving change",
+			prefs: prefs("22:00", "07:00", "Europe/Paris"),
+			now:   time.Date(2026, 3, 28, 23, 0, 0, 0, paris),
+			want:  time.Date(2026, 3, 29, 7, 0, 0, 0, paris),
+		},
+		{
+			name:  "unknown time zone falls back to UTC",
+			prefs: prefs("22:00", "07:00", "Mars/Olympus_Mons"),
+			now:   time.Date(2026, 5, 4, 23, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, 5, 5, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "malformed quiet hours are ignored",
+			prefs: prefs("10pm", "07:00", "UTC"),
+			now:   time.Date(2026, 5, 4, 23, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, 5, 4, 23, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quietHoursEnd(tt.prefs, tt.now); !got.Equal(tt.want) {
+				t.Errorf("quietHoursEnd() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPushUnavailable(t *testing.T) {
+	svc := NotificationService{}
+	identity := domain.Identity{UserID: uuid.New()}
+
+	prefs := domain.DefaultNotificationPreferences
+	prefs.Push = true
+
+	if err := svc.UpdatePreferences(identity, prefs); !errors.Is(err, domain.ErrPushUnavailable) {
+		t.Errorf("UpdatePreferences() error = %v, want %v", err, domain.ErrPushUnavailable)
+	}
+
+	if err := svc.RegisterPushDevice(identity, "device-token"); !errors.Is(err, domain.ErrPushUnavailable) {
+		t.Errorf("RegisterPushDevice() error = %v, want %v", err, domain.ErrPushUnavailable)
+	}
+}
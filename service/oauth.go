@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	OAuthStateKey           = "OAUTH_STATE"
+	OAuthStateExpiration    = time.Minute * 10
+	OAuthCodeKey            = "OAUTH_CODE"
+	OAuthCodeExpiration     = time.Minute
+	PKCEChallengeMethodS256 = "S256"
+)
+
+// oauthState is kept for the round trip through the provider. A LinkUserID means a
+// logged in user is linking the provider instead of logging in with it.
+type oauthState struct {
+	RedirectURI         string `json:"redirect_uri"`
+	CodeChallenge       string `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
+	LinkUserID          string `json:"link_user_id,omitempty"`
+}
+
+// oauthCode is what a one time authorization code can be exchanged for.
+type oauthCode struct {
+	UserID              uuid.UUID `json:"user_id"`
+	RedirectURI         string    `json:"redirect_uri"`
+	CodeChallenge       string    `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string    `json:"code_challenge_method,omitempty"`
+}
+
+// BeginOAuth returns the state to send through the provider's consent screen. The
+// redirect URI must already be checked against the allow-list. Clients that can't keep
+// a secret, like our mobile apps, send a PKCE challenge that ExchangeOAuthCode verifies.
+func (svc *AuthService) BeginOAuth(redirectURI string, codeChallenge string, codeChallengeMethod string) (state string, err error) {
+	return svc.createOAuthState(oauthState{
+		RedirectURI:         redirectURI,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: codeChallengeMethod,
+	})
+}
+
+// BeginOAuthLink is BeginOAuth for a logged in user linking another provider.
+func (svc *AuthService) BeginOAuthLink(identity domain.Identity, redirectURI string) (state string, err error) {
+	return svc.createOAuthState(oauthState{
+		RedirectURI: redirectURI,
+		LinkUserID:  identity.UserID.String(),
+	})
+}
+
+// CompleteOAuth handles the provider's callback for state. It returns where to send the
+// browser and, for logins, a one time code to exchange at ExchangeOAuthCode. Tokens never
+// travel in the redirect URL.
+//
+// An account is never linked just because the provider reports a matching email, not
+// every provider verifies it. Users link providers explicitly from a logged in session.
+func (svc *AuthService) CompleteOAuth(state string, provider string, providerUserID string, email string) (redirectURI string, code string, err error) {
+	data, err := svc.redis.GetDel(context.Background(), appendToKey(OAuthStateKey, state)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		err = domain.ErrInvalidToken
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to get oauth state: %v", err)
+		return
+	}
+
+	var pending oauthState
+	if err = json.Unmarshal(data, &pending); err != nil {
+		err = fmt.Errorf("failed to parse oauth state: %v", err)
+		return
+	}
+
+	redirectURI = pending.RedirectURI
+
+	if pending.LinkUserID != "" {
+		err = svc.linkIdentity(pending.LinkUserID, provider, providerUserID, email)
+		return
+	}
+
+	user, err := svc.oauthUser(provider, providerUserID, email)
+	if err != nil {
+		return
+	}
+
+	code = uuid.NewString()
+
+	data, err = json.Marshal(oauthCode{
+		UserID:              user.ID,
+		RedirectURI:         pending.RedirectURI,
+		CodeChallenge:       pending.CodeChallenge,
+		CodeChallengeMethod: pending.CodeChallengeMethod,
+	})
+	if err != nil {
+		return
+	}
+
+	err = svc.redis.Set(context.Background(), appendToKey(OAuthCodeKey, hashOAuthCode(code)), data, OAuthCodeExpiration).Err()
+	if err != nil {
+		err = fmt.Errorf("failed to cache oauth code: %v", err)
+		return
+	}
+
+	return
+}
+
+// ExchangeOAuthCode redeems a code from CompleteOAuth for tokens, or for an mfa token
+// when the user has two-factor authentication. A code can only be redeemed once.
+func (svc *AuthService) ExchangeOAuthCode(code string, codeVerifier string, redirectURI string, client domain.Session) (accessToken string, refreshToken string, mfaToken string, err error) {
+	data, err := svc.redis.GetDel(context.Background(), appendToKey(OAuthCodeKey, hashOAuthCode(code))).Bytes()
+	if errors.Is(err, redis.Nil) {
+		err = domain.ErrInvalidAuthorizationCode
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to get oauth code: %v", err)
+		return
+	}
+
+	var issued oauthCode
+	if err = json.Unmarshal(data, &issued); err != nil {
+		err = fmt.Errorf("failed to parse oauth code: %v", err)
+		return
+	}
+
+	if issued.RedirectURI != redirectURI {
+		err = domain.ErrInvalidAuthorizationCode
+		return
+	}
+
+	if !verifyCodeChallenge(issued.CodeChallenge, issued.CodeChallengeMethod, codeVerifier) {
+		err = domain.ErrInvalidAuthorizationCode
+		return
+	}
+
+	user, err := svc.repository.GetUserByID(issued.UserID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch user from db: %v", err)
+		return
+	}
+
+	if user.TOTPEnabled {
+		mfaToken, err = svc.createMFAChallenge(user)
+		return
+	}
+
+	accessToken, refreshToken, err = svc.issueTokens(user, client)
+	return
+}
+
+// oauthUser finds the user a provider account is linked to, or creates one for it.
+func (svc *AuthService) oauthUser(provider string, providerUserID string, email string) (user domain.User, err error) {
+	email = normalizeEmail(email)
+
+	identity, err := svc.repository.GetIdentity(provider, providerUserID)
+	if err == nil {
+		user, err = svc.repository.GetUserByID(identity.UserID)
+		if err != nil {
+			err = fmt.Errorf("failed to fetch user from db: %v", err)
+			return
+		}
+
+		return
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		err = fmt.Errorf("failed to fetch oauth identity from db: %v", err)
+		return
+	}
+
+	if email != "" {
+		_, err = svc.repository.GetUserByEmail(email)
+		if err == nil {
+			err = domain.ErrOAuthAccountExists
+			return
+		}
+
+		if !errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("failed to fetch user by email from db: %v", err)
+			return
+		}
+	}
+
+	user = domain.User{
+		Email:     email,
+		CreatedAt: time.Now(),
+		IsActive:  true,
+	}
+
+	// auto generate username for oauth users, can update later
+	suffix, err := generateCode(12)
+	if err != nil {
+		err = fmt.Errorf("failed to generate username: %v", err)
+		return
+	}
+	user.Username = "AnonymousUser" + suffix
+
+	user.ID, err = svc.repository.InsertUserWithIdentity(user, domain.OAuthIdentity{
+		Provider:       provider,
+		ProviderUserID: providerUserID,
+		Email:          email,
+		CreatedAt:      user.CreatedAt,
+	})
+	if errors.Is(err, domain.ErrEmailTaken) {
+		err = domain.ErrOAuthAccountExists
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to insert user: %v", err)
+		return
+	}
+
+	return
+}
+
+// linkIdentity links the provider account to the user that started the link flow.
+func (svc *AuthService) linkIdentity(id string, provider string, providerUserID string, email string) (err error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		err = fmt.Errorf("failed to parse oauth link user: %v", err)
+		return
+	}
+
+	existing, err := svc.repository.GetIdentity(provider, providerUserID)
+	if err == nil {
+		if existing.UserID != userID {
+			err = domain.ErrOAuthIdentityTaken
+		}
+		return
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		err = fmt.Errorf("failed to fetch oauth identity from db: %v", err)
+		return
+	}
+
+	identities, err := svc.repository.GetIdentities(userID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch oauth identities from db: %v", err)
+		return
+	}
+
+	for _, i := range identities {
+		if i.Provider == provider {
+			err = domain.ErrOAuthProviderLinked
+			return
+		}
+	}
+
+	err = svc.repository.InsertIdentity(domain.OAuthIdentity{
+		UserID:         userID,
+		Provider:       provider,
+		ProviderUserID: providerUserID,
+		Email:          email,
+		CreatedAt:      time.Now(),
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to insert oauth identity: %v", err)
+		return
+	}
+
+	svc.audit(userID, domain.AuditProviderLinked, provider, domain.Session{})
+	return
+}
+
+func (svc *AuthService) ListIdentities(identity domain.Identity) (identities []domain.OAuthIdentity, err error) {
+	identities, err = svc.repository.GetIdentities(identity.UserID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch oauth identities from db: %v", err)
+		return
+	}
+
+	return
+}
+
+// UnlinkIdentity removes a linked provider as long as the user keeps another way to log in.
+func (svc *AuthService) UnlinkIdentity(identity domain.Identity, provider string) (err error) {
+	user, err := svc.getUser(identity)
+	if err != nil {
+		return
+	}
+
+	identities, err := svc.repository.GetIdentities(user.ID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch oauth identities from db: %v", err)
+		return
+	}
+
+	credentials, err := svc.repository.GetWebAuthnCredentials(user.ID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch passkeys from db: %v", err)
+		return
+	}
+
+	linked, others := false, 0
+	for _, i := range identities {
+		if i.Provider == provider {
+			linked = true
+		} else {
+			others++
+		}
+	}
+
+	if !linked {
+		err = domain.ErrOAuthIdentityNotFound
+		return
+	}
+
+	if user.Password == "" && len(credentials) == 0 && others == 0 {
+		err = domain.ErrLastLoginMethod
+		return
+	}
+
+	deleted, err := svc.repository.DeleteIdentity(user.ID, provider)
+	if err != nil {
+		err = fmt.Errorf("failed to delete oauth identity: %v", err)
+		return
+	}
+
+	if !deleted {
+		err = domain.ErrOAuthIdentityNotFound
+		return
+	}
+
+	svc.audit(user.ID, domain.AuditProviderUnlinked, provider, domain.Session{ID: identity.SessionID})
+	return
+}
+
+func (svc *AuthService) createOAuthState(pending oauthState) (state string, err error) {
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return
+	}
+
+	state = uuid.NewString()
+
+	err = svc.redis.Set(context.Background(), appendToKey(OAuthStateKey, state), data, OAuthStateExpiration).Err()
+	if err != nil {
+		err = fmt.Errorf("failed to cache oauth state: %v", err)
+		return
+	}
+
+	return
+}
+
+// verifyCodeChallenge checks a PKCE verifier (RFC 7636). Codes issued without a
+// challenge must not be redeemed with a verifier either.
+func verifyCodeChallenge(challenge string, method string, verifier string) bool {
+	if challenge == "" {
+		return verifier == ""
+	}
+
+	// only S256 is supported, plain would hand the verifier to anyone who sees the redirect
+	if method != PKCEChallengeMethodS256 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+func hashOAuthCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+)
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	const (
+		verifier  = "dBjftJeZ4CVP-mB92K9uhvbIzAqGHgvgRMsn9hGGgEk"
+		challenge = "IMfoUudcU49NMh7qHgUbAGeUe-FFmekzuTZR8ndEKJc"
+	)
+
+	tests := []struct {
+		name      string
+		challenge string
+		method    string
+		verifier  string
+		want      bool
+	}{
+		{"matching verifier", challenge, PKCEChallengeMethodS256, verifier, true},
+		{"wrong verifier", challenge, PKCEChallengeMethodS256, verifier + "x", false},
+		{"missing verifier", challenge, PKCEChallengeMethodS256, "", false},
+		{"plain method", verifier, "plain", verifier, false},
+		{"no method", challenge, "", verifier, false},
+		{"challenge as verifier", challenge, PKCEChallengeMethodS256, challenge, false},
+		{"no challenge and no verifier", "", "", "", true},
+		{"verifier without challenge", "", "", verifier, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyCodeChallenge(tt.challenge, tt.method, tt.verifier); got != tt.want {
+				t.Errorf("verifyCodeChallenge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOAuthUser(t *testing.T) {
+	user := testUser()
+	linked := domain.OAuthIdentity{ID: 1, UserID: user.ID, Provider: "github", ProviderUserID: "1001"}
+
+	tests := []struct {
+		name           string
+		provider       string
+		providerUserID string
+		email          string
+		want           error
+	}{
+		{name: "linked account", provider: "github", providerUserID: "1001", email: "other@example.com"},
+		{name: "email of an existing account", provider: "google", providerUserID: "2002", email: user.Email, want: domain.ErrOAuthAccountExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, db, _ := newTestAuthService(t, user)
+			db.identities = []domain.OAuthIdentity{linked}
+
+			got, err := svc.oauthUser(tt.provider, tt.providerUserID, tt.email)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("oauthUser() error = %v, want %v", err, tt.want)
+			}
+
+			if err == nil && got.ID != user.ID {
+				t.Errorf("oauthUser() = %v, want %v", got.ID, user.ID)
+			}
+		})
+	}
+}
+
+func TestLinkIdentity(t *testing.T) {
+	user := testUser()
+	someoneElse := uuid.New()
+
+	tests := []struct {
+		name           string
+		identities     []domain.OAuthIdentity
+		provider       string
+		providerUserID string
+		want           error
+	}{
+		{name: "new provider", provider: "github", providerUserID: "1001"},
+		{
+			name:           "already linked to this user",
+			identities:     []domain.OAuthIdentity{{ID: 1, UserID: user.ID, Provider: "github", ProviderUserID: "1001"}},
+			provider:       "github",
+			providerUserID: "1001",
+		},
+		{
+			name:           "linked to another user",
+			identities:     []domain.OAuthIdentity{{ID: 1, UserID: someoneElse, Provider: "github", ProviderUserID: "1001"}},
+			provider:       "github",
+			providerUserID: "1001",
+			want:           domain.ErrOAuthIdentityTaken,
+		},
+		{
+			name:           "another account from the same provider",
+			identities:     []domain.OAuthIdentity{{ID: 1, UserID: user.ID, Provider: "github", ProviderUserID: "1001"}},
+			provider:       "github",
+			providerUserID: "3003",
+			want:           domain.ErrOAuthProviderLinked,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, db, _ := newTestAuthService(t, user)
+			db.identities = tt.identities
+
+			if err := svc.linkIdentity(user.ID.String(), tt.provider, tt.providerUserID, ""); !errors.Is(err, tt.want) {
+				t.Errorf("linkIdentity() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnlinkIdentity(t *testing.T) {
+	github := domain.OAuthIdentity{ID: 1, Provider: "github", ProviderUserID: "1001"}
+	google := domain.OAuthIdentity{ID: 2, Provider: "google", ProviderUserID: "2002"}
+
+	tests := []struct {
+		name       string
+		password   string
+		identities []domain.OAuthIdentity
+		provider   string
+		want       error
+	}{
+		{name: "not linked", identities: []domain.OAuthIdentity{github}, provider: "google", want: domain.ErrOAuthIdentityNotFound},
+		{name: "only way to log in", identities: []domain.OAuthIdentity{github}, provider: "github", want: domain.ErrLastLoginMethod},
+		{name: "has a password", password: "$argon2id$stored", identities: []domain.OAuthIdentity{github}, provider: "github"},
+		{name: "has another provider", identities: []domain.OAuthIdentity{github, google}, provider: "github"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := testUser()
+			user.Password = tt.password
+
+			svc, db, _ := newTestAuthService(t, user)
+			for _, i := range tt.identities {
+				i.UserID = user.ID
+				db.identities = append(db.identities, i)
+			}
+
+			if err := svc.UnlinkIdentity(domain.Identity{UserID: user.ID}, tt.provider); !errors.Is(err, tt.want) {
+				t.Errorf("UnlinkIdentity() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
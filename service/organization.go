@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+	smtp "github.com/papacatzzi-server/email"
+	"github.com/papacatzzi-server/postgres"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	OrgInviteKey        = "ORG_INVITE"
+	OrgInviteExpiration = time.Hour * 24 * 7
+)
+
+type OrganizationService struct {
+	repository     postgres.OrganizationRepository
+	userRepository postgres.UserRepository
+	redis          *redis.Client
+	mailer         smtp.Mailer
+	frontendURL    string
+}
+
+func NewOrganizationService(
+	repo postgres.OrganizationRepository,
+	userRepo postgres.UserRepository,
+	redis *redis.Client,
+	mailer smtp.Mailer,
+	frontendURL string,
+) OrganizationService {
+	return OrganizationService{
+		repository:     repo,
+		userRepository: userRepo,
+		redis:          redis,
+		mailer:         mailer,
+		frontendURL:    frontendURL,
+	}
+}
+
+type orgInvite struct {
+	OrganizationID int
+	Email          string
+	Role           string
+}
+
+// Create starts an organization with the caller as its owner.
+func (svc *OrganizationService) Create(identity domain.Identity, name string) (org domain.Organization, err error) {
+	org.ID, err = svc.repository.InsertOrganization(domain.Organization{Name: name}, identity.UserID)
+	if err != nil {
+		err = fmt.Errorf("failed to create organization: %v", err)
+		return
+	}
+
+	org, err = svc.repository.GetOrganization(org.ID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch organization from db: %v", err)
+		return
+	}
+
+	org.Role = domain.OrgRoleOwner
+	return
+}
+
+func (svc *OrganizationService) List(identity domain.Identity) (orgs []domain.Organization, err error) {
+	orgs, err = svc.repository.GetOrganizationsByMember(identity.UserID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch organizations from db: %v", err)
+		return
+	}
+
+	return
+}
+
+// Get returns an organization and its members. Only members can see them.
+func (svc *OrganizationService) Get(identity domain.Identity, orgID int) (org domain.Organization, members []domain.OrganizationMember, err error) {
+	caller, err := svc.member(identity, orgID)
+	if err != nil {
+		return
+	}
+
+	org, err = svc.repository.GetOrganization(orgID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch organization from db: %v", err)
+		return
+	}
+
+	org.Role = caller.Role
+
+	members, err = svc.repository.GetMembers(orgID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch members from db: %v", err)
+		return
+	}
+
+	return
+}
+
+// Delete removes the organization. Its sightings stay with their reporters.
+func (svc *OrganizationService) Delete(identity domain.Identity, orgID int) (err error) {
+	if _, err = svc.memberWithRole(identity, orgID, domain.OrgRoleOwner); err != nil {
+		return
+	}
+
+	err = svc.repository.DeleteOrganization(orgID)
+	if err != nil {
+		err = fmt.Errorf("failed to delete organization: %v", err)
+		return
+	}
+
+	return
+}
+
+// Invite emails a link to join the organization. Coordinators can invite
+// coordinators and volunteers, only owners can invite other owners.
+func (svc *OrganizationService) Invite(identity domain.Identity, orgID int, email string, role string) (err error) {
+	email = normalizeEmail(email)
+
+	caller, err := svc.memberWithRole(identity, orgID, domain.OrgRoleOwner, domain.OrgRoleCoordinator)
+	if err != nil {
+		return
+	}
+
+	if role == domain.OrgRoleOwner && caller.Role != domain.OrgRoleOwner {
+		err = domain.ErrOrganizationForbidden
+		return
+	}
+
+	org, err := svc.repository.GetOrganization(orgID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch organization from db: %v", err)
+		return
+	}
+
+	data, err := json.Marshal(orgInvite{OrganizationID: orgID, Email: email, Role: role})
+	if err != nil {
+		return
+	}
+
+	token := uuid.NewString()
+
+	err = svc.redis.Set(context.Background(), appendToKey(OrgInviteKey, token), data, OrgInviteExpiration).Err()
+	if err != nil {
+		err = fmt.Errorf("failed to cache invite: %v", err)
+		return
+	}
+
+	go func() {
+		data := map[string]string{
+			"inviter":      caller.Username,
+			"organization": org.Name,
+			"role":         role,
+			"link":         svc.frontendURL + "/invites/accept?token=" + url.QueryEscape(token),
+		}
+
+		content := smtp.EmailContent{
+			Subject:   "You're invited to join " + org.Name,
+			Recipient: email,
+			Body:      data,
+		}
+
+		svc.mailer.Send("email/templates/org-invite.html", content)
+	}()
+
+	return
+}
+
+// AcceptInvite adds the caller to the organization they were invited to. The invite
+// only works for the account with the address it was sent to.
+func (svc *OrganizationService) AcceptInvite(identity domain.Identity, token string) (org domain.Organization, err error) {
+	key := appendToKey(OrgInviteKey, token)
+
+	data, err := svc.redis.Get(context.Background(), key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		err = domain.ErrInviteNotFound
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to get invite: %v", err)
+		return
+	}
+
+	var invite orgInvite
+	if err = json.Unmarshal(data, &invite); err != nil {
+		return
+	}
+
+	user, err := svc.userRepository.GetUserByID(identity.UserID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch user from db: %v", err)
+		return
+	}
+
+	if normalizeEmail(user.Email) != invite.Email {
+		err = domain.ErrInviteEmailMismatch
+		return
+	}
+
+	role := invite.Role
+
+	err = svc.repository.InsertMember(domain.OrganizationMember{
+		OrganizationID: invite.OrganizationID,
+		UserID:         user.ID,
+		Role:           role,
+	})
+	if errors.Is(err, domain.ErrAlreadyMember) {
+		// accepting twice is harmless, answer with the membership the user already has
+		var member domain.OrganizationMember
+
+		member, err = svc.repository.GetMember(invite.OrganizationID, user.ID)
+		if err != nil {
+			err = fmt.Errorf("failed to fetch member from db: %v", err)
+			return
+		}
+
+		role = member.Role
+	} else if err != nil {
+		err = fmt.Errorf("failed to add member: %v", err)
+		return
+	}
+
+	svc.redis.Del(context.Background(), key)
+
+	org, err = svc.repository.GetOrganization(invite.OrganizationID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch organization from db: %v", err)
+		return
+	}
+
+	org.Role = role
+	return
+}
+
+// UpdateMemberRole is reserved for owners.
+func (svc *OrganizationService) UpdateMemberRole(identity domain.Identity, orgID int, userID uuid.UUID, role string) (err error) {
+	if _, err = svc.memberWithRole(identity, orgID, domain.OrgRoleOwner); err != nil {
+		return
+	}
+
+	if _, err = svc.getMember(orgID, userID); err != nil {
+		return
+	}
+
+	err = svc.repository.UpdateMemberRole(orgID, userID, role)
+	if err != nil && !errors.Is(err, domain.ErrLastOwner) {
+		err = fmt.Errorf("failed to update member: %v", err)
+		return
+	}
+
+	return
+}
+
+// RemoveMember lets members leave, owners remove anyone and coordinators remove volunteers.
+func (svc *OrganizationService) RemoveMember(identity domain.Identity, orgID int, userID uuid.UUID) (err error) {
+	caller, err := svc.member(identity, orgID)
+	if err != nil {
+		return
+	}
+
+	target, err := svc.getMember(orgID, userID)
+	if err != nil {
+		return
+	}
+
+	allowed := caller.UserID == target.UserID ||
+		caller.Role == domain.OrgRoleOwner ||
+		(caller.Role == domain.OrgRoleCoordinator && target.Role == domain.OrgRoleVolunteer)
+
+	if !allowed {
+		err = domain.ErrOrganizationForbidden
+		return
+	}
+
+	deleted, err := svc.repository.DeleteMember(orgID, userID)
+	if err != nil && !errors.Is(err, domain.ErrLastOwner) {
+		err = fmt.Errorf("failed to remove member: %v", err)
+		return
+	}
+
+	if err == nil && !deleted {
+		err = domain.ErrMemberNotFound
+	}
+
+	return
+}
+
+// member returns the caller's membership. Non-members get ErrOrganizationNotFound,
+// so organizations can't be discovered by guessing IDs.
+func (svc *OrganizationService) member(identity domain.Identity, orgID int) (member domain.OrganizationMember, err error) {
+	member, err = svc.repository.GetMember(orgID, identity.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = domain.ErrOrganizationNotFound
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to fetch member from db: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *OrganizationService) memberWithRole(identity domain.Identity, orgID int, roles ...string) (member domain.OrganizationMember, err error) {
+	member, err = svc.member(identity, orgID)
+	if err != nil {
+		return
+	}
+
+	for _, role := range roles {
+		if member.Role == role {
+			return
+		}
+	}
+
+	err = domain.ErrOrganizationForbidden
+	return
+}
+
+func (svc *OrganizationService) getMember(orgID int, userID uuid.UUID) (member domain.OrganizationMember, err error) {
+	member, err = svc.repository.GetMember(orgID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = domain.ErrMemberNotFound
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to fetch member from db: %v", err)
+		return
+	}
+
+	return
+}
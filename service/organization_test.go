@@ -0,0 +1,177 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+	smtp "github.com/papacatzzi-server/email"
+	"github.com/papacatzzi-server/postgres"
+	"github.com/redis/go-redis/v9"
+)
+
+const testOrgID = 7
+
+func newTestOrganizationService(t *testing.T, user domain.User) (OrganizationService, *testDB, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	db, fake := newTestDB(t, user)
+	fake.organizations = []domain.Organization{{ID: testOrgID, Name: "Harbor Street Colony"}}
+
+	svc := NewOrganizationService(
+		postgres.NewOrganizationRepository(db),
+		postgres.NewUserRepository(db),
+		redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		smtp.Mailer{},
+		"http://localhost:5173",
+	)
+
+	return svc, fake, mr
+}
+
+func mustCacheInvite(t *testing.T, mr *miniredis.Miniredis, email string, role string) (token string) {
+	t.Helper()
+
+	data, err := json.Marshal(orgInvite{OrganizationID: testOrgID, Email: email, Role: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token = uuid.NewString()
+	mr.Set(appendToKey(OrgInviteKey, token), string(data))
+	return
+}
+
+func TestAcceptInvite(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// role the user already has, if any
+		member    string
+		userEmail string
+		email     string
+		role      string
+		token     string
+		want      error
+
+		wantRole string
+	}{
+		{name: "new member", email: "cat@example.com", role: domain.OrgRoleVolunteer, wantRole: domain.OrgRoleVolunteer},
+		{name: "address in another case", userEmail: "Cat@Example.com", email: "cat@example.com", role: domain.OrgRoleCoordinator, wantRole: domain.OrgRoleCoordinator},
+		{name: "sent to someone else", email: "tabby@example.com", role: domain.OrgRoleVolunteer, want: domain.ErrInviteEmailMismatch},
+		{name: "unknown invite", token: "not-an-invite", want: domain.ErrInviteNotFound},
+		{
+			name:     "already a member",
+			member:   domain.OrgRoleCoordinator,
+			email:    "cat@example.com",
+			role:     domain.OrgRoleVolunteer,
+			wantRole: domain.OrgRoleCoordinator,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := testUser()
+			if tt.userEmail != "" {
+				user.Email = tt.userEmail
+			}
+
+			svc, db, mr := newTestOrganizationService(t, user)
+
+			if tt.member != "" {
+				db.members = []domain.OrganizationMember{{OrganizationID: testOrgID, UserID: user.ID, Role: tt.member}}
+			}
+
+			token := tt.token
+			if token == "" {
+				token = mustCacheInvite(t, mr, tt.email, tt.role)
+			}
+
+			org, err := svc.AcceptInvite(domain.Identity{UserID: user.ID}, token)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("AcceptInvite() error = %v, want %v", err, tt.want)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if org.ID != testOrgID || org.Role != tt.wantRole {
+				t.Errorf("AcceptInvite() = organization %d as %q, want %d as %q", org.ID, org.Role, testOrgID, tt.wantRole)
+			}
+
+			member, err := svc.getMember(testOrgID, user.ID)
+			if err != nil || member.Role != tt.wantRole {
+				t.Errorf("membership = %q (%v), want %q", member.Role, err, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestAcceptInviteTwice(t *testing.T) {
+	user := testUser()
+	svc, _, mr := newTestOrganizationService(t, user)
+	identity := domain.Identity{UserID: user.ID}
+
+	first := mustCacheInvite(t, mr, user.Email, domain.OrgRoleVolunteer)
+	second := mustCacheInvite(t, mr, user.Email, domain.OrgRoleVolunteer)
+
+	if _, err := svc.AcceptInvite(identity, first); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second invite to the same member is answered with the membership
+	org, err := svc.AcceptInvite(identity, second)
+	if err != nil {
+		t.Fatalf("accepting a second invite failed: %v", err)
+	}
+
+	if org.Role != domain.OrgRoleVolunteer {
+		t.Errorf("role = %q, want %q", org.Role, domain.OrgRoleVolunteer)
+	}
+
+	// and an accepted invite is used up
+	if _, err = svc.AcceptInvite(identity, first); !errors.Is(err, domain.ErrInviteNotFound) {
+		t.Errorf("reusing an invite: error = %v, want %v", err, domain.ErrInviteNotFound)
+	}
+}
+
+func TestInvite(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller string
+		role   string
+		want   error
+	}{
+		{name: "owner invites an owner", caller: domain.OrgRoleOwner, role: domain.OrgRoleOwner},
+		{name: "coordinator invites a volunteer", caller: domain.OrgRoleCoordinator, role: domain.OrgRoleVolunteer},
+		{name: "coordinator invites an owner", caller: domain.OrgRoleCoordinator, role: domain.OrgRoleOwner, want: domain.ErrOrganizationForbidden},
+		{name: "volunteer invites", caller: domain.OrgRoleVolunteer, role: domain.OrgRoleVolunteer, want: domain.ErrOrganizationForbidden},
+		{name: "not a member", role: domain.OrgRoleVolunteer, want: domain.ErrOrganizationNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := testUser()
+			svc, db, mr := newTestOrganizationService(t, user)
+
+			if tt.caller != "" {
+				db.members = []domain.OrganizationMember{{OrganizationID: testOrgID, UserID: user.ID, Role: tt.caller}}
+			}
+
+			err := svc.Invite(domain.Identity{UserID: user.ID}, testOrgID, "Tabby@Example.com", tt.role)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Invite() error = %v, want %v", err, tt.want)
+			}
+
+			invites := len(mr.Keys())
+			if (invites == 1) != (tt.want == nil) || invites > 1 {
+				t.Errorf("%d invites stored", invites)
+			}
+		})
+	}
+}
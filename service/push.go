@@ -0,0 +1,69 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/papacatzzi-server/domain"
+)
+
+// errPushDeviceGone is returned by a PushSender for a device token the push service
+// no longer knows, the device is forgotten instead of retried.
+var errPushDeviceGone = errors.New("push device is no longer registered")
+
+var pushClient = &http.Client{Timeout: time.Second * 10}
+
+// pushMessage is what the push gateway receives for every device.
+type pushMessage struct {
+	Token      string `json:"token"`
+	Title      string `json:"title"`
+	Body       string `json:"body"`
+	Link       string `json:"link"`
+	SightingID int    `json:"sightingId"`
+}
+
+// NewWebhookPushSender posts notifications to a push gateway that relays them to FCM
+// or APNs, whichever the token belongs to. Requests carry secret as a bearer token.
+// The gateway answers 404 or 410 for tokens the push service dropped.
+func NewWebhookPushSender(url string, secret string, frontendURL string) PushSender {
+	return func(token string, n domain.Notification) (err error) {
+		body, err := json.Marshal(pushMessage{
+			Token:      token,
+			Title:      "New " + n.Animal + " sighting",
+			Body:       "Spotted near " + n.AreaName,
+			Link:       frontendURL + "/sightings/" + strconv.Itoa(n.SightingID),
+			SightingID: n.SightingID,
+		})
+		if err != nil {
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+secret)
+
+		res, err := pushClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to reach push gateway: %v", err)
+		}
+		defer res.Body.Close()
+
+		switch {
+		case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+			return errPushDeviceGone
+		case res.StatusCode >= 300:
+			return fmt.Errorf("push gateway answered %s", res.Status)
+		}
+
+		return
+	}
+}
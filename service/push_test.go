@@ -0,0 +1,71 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/papacatzzi-server/domain"
+)
+
+func TestWebhookPushSender(t *testing.T) {
+	n := domain.Notification{SightingID: 12, Animal: "cat", AreaName: "Home"}
+
+	t.Run("delivered", func(t *testing.T) {
+		var got pushMessage
+		gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+			}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Error(err)
+			}
+		}))
+		defer gateway.Close()
+
+		send := NewWebhookPushSender(gateway.URL, "secret", "https://example.com")
+		if err := send("device", n); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+
+		want := pushMessage{
+			Token:      "device",
+			Title:      "New cat sighting",
+			Body:       "Spotted near Home",
+			Link:       "https://example.com/sightings/12",
+			SightingID: 12,
+		}
+		if got != want {
+			t.Errorf("message = %+v, want %+v", got, want)
+		}
+	})
+
+	tests := []struct {
+		status int
+		gone   bool
+	}{
+		{status: http.StatusGone, gone: true},
+		{status: http.StatusNotFound, gone: true},
+		{status: http.StatusInternalServerError, gone: false},
+		{status: http.StatusUnauthorized, gone: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer gateway.Close()
+
+			err := NewWebhookPushSender(gateway.URL, "secret", "https://example.com")("device", n)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if errors.Is(err, errPushDeviceGone) != tt.gone {
+				t.Errorf("err = %v, gone = %v", err, tt.gone)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// Authenticate verifies an access token and checks that its session has not been revoked.
+func (svc *AuthService) Authenticate(accessToken string) (identity domain.Identity, err error) {
+	claims, err := svc.VerifyToken(accessToken, AccessTokenType)
+	if err != nil {
+		return
+	}
+
+	exists, err := svc.redis.Exists(context.Background(), appendToKey(SessionKey, claims.SessionID)).Result()
+	if err != nil {
+		err = fmt.Errorf("failed to get session: %v", err)
+		return
+	}
+
+	if exists == 0 {
+		err = domain.ErrInvalidToken
+		return
+	}
+
+	identity = domain.Identity{
+		UserID:    claims.UserID,
+		Email:     claims.Email,
+		Role:      claims.Role,
+		SessionID: claims.SessionID,
+	}
+
+	return
+}
+
+func (svc *AuthService) ListSessions(userID uuid.UUID) (sessions []domain.Session, err error) {
+	indexKey := appendToKey(UserSessionsKey, userID.String())
+
+	ids, err := svc.redis.SMembers(context.Background(), indexKey).Result()
+	if err != nil {
+		err = fmt.Errorf("failed to list sessions: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		session, err := svc.getSession(id)
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			// expired sessions are only dropped from the index lazily
+			svc.redis.SRem(context.Background(), indexKey, id)
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+
+	return
+}
+
+// RevokeSession logs out a single device. Access tokens issued for it stop working immediately.
+func (svc *AuthService) RevokeSession(userID uuid.UUID, id string) (err error) {
+	session, err := svc.getSession(id)
+	if err != nil {
+		return
+	}
+
+	if session.UserID != userID {
+		err = domain.ErrSessionNotFound
+		return
+	}
+
+	_, err = svc.redis.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.Del(context.Background(), appendToKey(SessionKey, id))
+		pipe.SRem(context.Background(), appendToKey(UserSessionsKey, userID.String()), id)
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to revoke session: %v", err)
+		return
+	}
+
+	return
+}
+
+// RevokeAllSessions logs the user out everywhere.
+func (svc *AuthService) RevokeAllSessions(userID uuid.UUID) (err error) {
+	indexKey := appendToKey(UserSessionsKey, userID.String())
+
+	ids, err := svc.redis.SMembers(context.Background(), indexKey).Result()
+	if err != nil {
+		err = fmt.Errorf("failed to list sessions: %v", err)
+		return
+	}
+
+	keys := []string{indexKey}
+	for _, id := range ids {
+		keys = append(keys, appendToKey(SessionKey, id))
+	}
+
+	err = svc.redis.Del(context.Background(), keys...).Err()
+	if err != nil {
+		err = fmt.Errorf("failed to revoke sessions: %v", err)
+		return
+	}
+
+	return
+}
+
+// RevokeOtherSessions logs the user out everywhere except the session in keep.
+func (svc *AuthService) RevokeOtherSessions(userID uuid.UUID, keep string) (err error) {
+	indexKey := appendToKey(UserSessionsKey, userID.String())
+
+	ids, err := svc.redis.SMembers(context.Background(), indexKey).Result()
+	if err != nil {
+		err = fmt.Errorf("failed to list sessions: %v", err)
+		return
+	}
+
+	_, err = svc.redis.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			if id == keep {
+				continue
+			}
+
+			pipe.Del(context.Background(), appendToKey(SessionKey, id))
+			pipe.SRem(context.Background(), indexKey, id)
+		}
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to revoke sessions: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *AuthService) createSession(user domain.User, client domain.Session) (session domain.Session, err error) {
+	now := time.Now()
+
+	session = domain.Session{
+		ID:         uuid.NewString(),
+		UserID:     user.ID,
+		DeviceName: client.DeviceName,
+		IPAddress:  client.IPAddress,
+		UserAgent:  client.UserAgent,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+
+	key := appendToKey(SessionKey, session.ID)
+	indexKey := appendToKey(UserSessionsKey, user.ID.String())
+
+	_, err = svc.redis.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.HSet(context.Background(), key, map[string]interface{}{
+			"user_id":      session.UserID.String(),
+			"device_name":  session.DeviceName,
+			"ip_address":   session.IPAddress,
+			"user_agent":   session.UserAgent,
+			"created_at":   session.CreatedAt.Unix(),
+			"last_used_at": session.LastUsedAt.Unix(),
+		})
+		pipe.Expire(context.Background(), key, RefreshTokenExpiration)
+		pipe.SAdd(context.Background(), indexKey, session.ID)
+		pipe.Expire(context.Background(), indexKey, RefreshTokenExpiration)
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to create session: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *AuthService) getSession(id string) (session domain.Session, err error) {
+	fields, err := svc.redis.HGetAll(context.Background(), appendToKey(SessionKey, id)).Result()
+	if err != nil {
+		err = fmt.Errorf("failed to get session: %v", err)
+		return
+	}
+
+	if len(fields) == 0 {
+		err = domain.ErrSessionNotFound
+		return
+	}
+
+	userID, err := uuid.Parse(fields["user_id"])
+	if err != nil {
+		err = fmt.Errorf("failed to parse session user: %v", err)
+		return
+	}
+
+	createdAt, _ := strconv.ParseInt(fields["created_at"], 10, 64)
+	lastUsedAt, _ := strconv.ParseInt(fields["last_used_at"], 10, 64)
+
+	session = domain.Session{
+		ID:         id,
+		UserID:     userID,
+		DeviceName: fields["device_name"],
+		IPAddress:  fields["ip_address"],
+		UserAgent:  fields["user_agent"],
+		CreatedAt:  time.Unix(createdAt, 0),
+		LastUsedAt: time.Unix(lastUsedAt, 0),
+	}
+
+	return
+}
+
+var errRefreshTokenGone = errors.New("refresh token was already exchanged")
+
+// exchangeRefreshTokenScript rotates a session's refresh token and records activity on
+// it in one step. Nothing changes unless the old token is still unused and the session
+// still exists, so a refresh racing a revocation cannot bring the session back.
+var exchangeRefreshTokenScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if redis.call("EXISTS", KEYS[4]) == 0 then
+	return -1
+end
+redis.call("DEL", KEYS[1])
+redis.call("SET", KEYS[2], ARGV[1], "PX", ARGV[2])
+redis.call("SET", KEYS[3], ARGV[1], "EX", ARGV[3])
+redis.call("HSET", KEYS[4], unpack(ARGV, 4))
+redis.call("EXPIRE", KEYS[4], ARGV[3])
+redis.call("EXPIRE", KEYS[5], ARGV[3])
+return 1
+`)
+
+// exchangeRefreshToken replaces the refresh token in old with the one whose ID is next,
+// slides the session's expiry and records the client on it. The rotated token is
+// remembered until it would have expired anyway so reuse can be detected.
+func (svc *AuthService) exchangeRefreshToken(session domain.Session, client domain.Session, old *claims, next string) (err error) {
+	keys := []string{
+		appendToKey(RefreshTokenKey, old.ID),
+		appendToKey(RotatedRefreshTokenKey, old.ID),
+		appendToKey(RefreshTokenKey, next),
+		appendToKey(SessionKey, session.ID),
+		appendToKey(UserSessionsKey, session.UserID.String()),
+	}
+
+	args := []interface{}{
+		session.ID,
+		max(time.Until(old.ExpiresAt.Time).Milliseconds(), 1),
+		int(RefreshTokenExpiration.Seconds()),
+		"ip_address", client.IPAddress,
+		"user_agent", client.UserAgent,
+		"last_used_at", time.Now().Unix(),
+	}
+
+	if client.DeviceName != "" {
+		args = append(args, "device_name", client.DeviceName)
+	}
+
+	exchanged, err := exchangeRefreshTokenScript.Run(context.Background(), svc.redis, keys, args...).Int()
+	if err != nil {
+		err = fmt.Errorf("failed to rotate refresh token: %v", err)
+		return
+	}
+
+	switch exchanged {
+	case 0:
+		err = errRefreshTokenGone
+	case -1:
+		err = domain.ErrInvalidToken
+	}
+
+	return
+}
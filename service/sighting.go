@@ -1,26 +1,144 @@
 package service
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+
 	"github.com/papacatzzi-server/domain"
+	"github.com/papacatzzi-server/log"
 	"github.com/papacatzzi-server/postgres"
+	"github.com/redis/go-redis/v9"
 )
 
 type SightingService struct {
-	repository postgres.SightingRepository
+	logger                 log.Logger
+	repository             postgres.SightingRepository
+	organizationRepository postgres.OrganizationRepository
+	redis                  *redis.Client
+	hub                    *sightingHub
+	notifications          NotificationService
+}
+
+func NewSightingService(
+	logger log.Logger,
+	repo postgres.SightingRepository,
+	orgRepo postgres.OrganizationRepository,
+	redis *redis.Client,
+	notifications NotificationService,
+) SightingService {
+	return SightingService{
+		logger:                 logger,
+		repository:             repo,
+		organizationRepository: orgRepo,
+		redis:                  redis,
+		hub:                    newSightingHub(redis, repo),
+		notifications:          notifications,
+	}
 }
 
-func NewSightingService(repo postgres.SightingRepository) SightingService {
-	return SightingService{repository: repo}
+func (svc *SightingService) List(viewer domain.Identity, filter domain.SightingFilter) (sightings []domain.Sighting, err error) {
+	return svc.repository.GetSightingsByCoordinates(viewer, filter.MinLng, filter.MinLat, filter.MaxLng, filter.MaxLat, filter.MinConfidence)
 }
 
-func (svc *SightingService) List(minLng, minLat, maxLng, maxLat float64) (sightings []domain.Sighting, err error) {
-	return svc.repository.GetSightingsByCoordinates(minLng, minLat, maxLng, maxLat)
+func (svc *SightingService) GetByID(viewer domain.Identity, id string) (sighting domain.Sighting, err error) {
+	sighting, err = svc.repository.GetSightingByID(viewer, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = domain.ErrSightingNotFound
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to fetch sighting from db: %v", err)
+		return
+	}
+
+	return
 }
 
-func (svc *SightingService) GetByID(id string) (sighting domain.Sighting, err error) {
-	return svc.repository.GetSightingByID(id)
+// Create records a sighting reported by the caller. Sightings are public unless the
+// reporter limits them, and can only be shared with the reporter's own organizations.
+func (svc *SightingService) Create(identity domain.Identity, sighting domain.Sighting) (err error) {
+	sighting.Reporter = identity.UserID.String()
+
+	if sighting.OrganizationID != nil {
+		_, err = svc.organizationRepository.GetMember(*sighting.OrganizationID, identity.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = domain.ErrOrganizationNotFound
+			return
+		}
+
+		if err != nil {
+			err = fmt.Errorf("failed to fetch member from db: %v", err)
+			return
+		}
+	}
+
+	if sighting.Visibility == "" {
+		sighting.Visibility = domain.VisibilityPublic
+	}
+
+	sighting.ID, err = svc.repository.InsertSighting(sighting)
+	if err != nil {
+		err = fmt.Errorf("failed to insert sighting: %v", err)
+		return
+	}
+
+	if err = svc.rescore(sighting.ID); err != nil {
+		return
+	}
+
+	svc.publish(domain.SightingCreated, sighting)
+
+	// matching runs against every saved area, the reporter shouldn't wait for it
+	go func() {
+		if err := svc.notifications.Match(sighting.ID); err != nil {
+			svc.logger.Error().Err(err).Int("sighting", sighting.ID).Msg("failed to match sighting against alert areas")
+		}
+	}()
+
+	return
 }
 
-func (svc *SightingService) Create(sighting domain.Sighting) (err error) {
-	return svc.repository.InsertSighting(sighting)
+// Delete removes a sighting. Reporters can delete their own, moderators any they can see.
+func (svc *SightingService) Delete(identity domain.Identity, id string) (err error) {
+	sighting, err := svc.GetByID(identity, id)
+	if err != nil {
+		return
+	}
+
+	if sighting.Reporter != identity.UserID.String() && identity.Role != domain.RoleModerator {
+		err = domain.ErrSightingForbidden
+		return
+	}
+
+	// streams need it as stored to tell who was looking at it
+	sighting, err = svc.repository.GetSightingForStream(sighting.ID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch sighting from db: %v", err)
+		return
+	}
+
+	err = svc.repository.DeleteSighting(sighting.ID)
+	if err != nil {
+		err = fmt.Errorf("failed to delete sighting: %v", err)
+		return
+	}
+
+	svc.publish(domain.SightingDeleted, sighting)
+
+	// reputation counts every sighting of the reporter, so the rest of theirs move too
+	ids, err := svc.repository.GetSightingIDsByReporter(sighting.Reporter)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch sightings from db: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		if err = svc.rescore(id); err != nil {
+			return
+		}
+	}
+
+	return
 }
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/papacatzzi-server/domain"
+	"github.com/papacatzzi-server/postgres"
+	"github.com/redis/go-redis/v9"
+)
+
+// SightingEventsChannel carries sighting changes between server instances. Messages
+// hold exact locations, they are filtered per subscriber before leaving the service.
+const SightingEventsChannel = "SIGHTING_EVENTS"
+
+// subscriberBuffer is how many messages a slow subscriber can fall behind before it
+// starts missing them.
+const subscriberBuffer = 64
+
+type sightingMessage struct {
+	Type domain.SightingEventType `json:"type"`
+	ID   int                      `json:"id"`
+
+	// Sighting is set for deleted sightings, as they were stored, since they can't be
+	// read back anymore. Everything else is read back once it arrives.
+	Sighting *domain.Sighting `json:"sighting,omitempty"`
+}
+
+// sightingUpdate is a message resolved once for every stream on this instance. The
+// sighting's location is exact.
+type sightingUpdate struct {
+	Type     domain.SightingEventType
+	Sighting domain.Sighting
+	Audience domain.SightingAudience
+}
+
+// sightingHub shares one Redis subscription between every stream on this instance.
+type sightingHub struct {
+	redis      *redis.Client
+	repository postgres.SightingRepository
+	once       sync.Once
+
+	mu          sync.Mutex
+	subscribers map[chan sightingUpdate]struct{}
+}
+
+func newSightingHub(redis *redis.Client, repo postgres.SightingRepository) *sightingHub {
+	return &sightingHub{redis: redis, repository: repo, subscribers: make(map[chan sightingUpdate]struct{})}
+}
+
+func (h *sightingHub) subscribe() (updates chan sightingUpdate, cancel func()) {
+	h.once.Do(func() { go h.run() })
+
+	updates = make(chan sightingUpdate, subscriberBuffer)
+
+	h.mu.Lock()
+	h.subscribers[updates] = struct{}{}
+	h.mu.Unlock()
+
+	cancel = func() {
+		h.mu.Lock()
+		delete(h.subscribers, updates)
+		h.mu.Unlock()
+	}
+
+	return
+}
+
+// run resolves messages and fans them out until the process exits, go-redis
+// resubscribes on its own after a lost connection.
+func (h *sightingHub) run() {
+	pubsub := h.redis.Subscribe(context.Background(), SightingEventsChannel)
+
+	for msg := range pubsub.Channel() {
+		var m sightingMessage
+		if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+			continue
+		}
+
+		// a sighting deleted since the message was sent, or a lookup failure a stream
+		// has no way to report, is dropped for everyone
+		update, err := h.resolve(m)
+		if err != nil {
+			continue
+		}
+
+		h.mu.Lock()
+		for subscriber := range h.subscribers {
+			select {
+			case subscriber <- update:
+			default:
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// resolve looks up everything subscribers are checked against, once per message
+// rather than once per subscriber.
+func (h *sightingHub) resolve(m sightingMessage) (update sightingUpdate, err error) {
+	update.Type = m.Type
+
+	if m.Sighting != nil {
+		update.Sighting = *m.Sighting
+	} else {
+		update.Sighting, err = h.repository.GetSightingForStream(m.ID)
+		if err != nil {
+			return
+		}
+	}
+
+	update.Audience, err = h.repository.GetSightingAudience(update.Sighting)
+	return
+}
+
+// Stream sends viewer the changes to sightings inside filter, as they would see them
+// through List, until ctx is done. Clients that pan the map send new filters.
+func (svc *SightingService) Stream(ctx context.Context, viewer domain.Identity, filter domain.SightingFilter, filters <-chan domain.SightingFilter) <-chan domain.SightingEvent {
+	events := make(chan domain.SightingEvent)
+	updates, cancel := svc.hub.subscribe()
+
+	go func() {
+		defer close(events)
+		defer cancel()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case f, ok := <-filters:
+				if !ok {
+					filters = nil
+					continue
+				}
+
+				filter = f
+
+			case u := <-updates:
+				event, ok := eventFor(viewer, filter, u)
+				if !ok {
+					continue
+				}
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events
+}
+
+// eventFor turns an update into the event viewer gets, if any. Deleted sightings are
+// only announced to those List would have shown them to, and only by their ID.
+func eventFor(viewer domain.Identity, filter domain.SightingFilter, u sightingUpdate) (event domain.SightingEvent, ok bool) {
+	sighting, ok := postgres.VisibleLocation(viewer, u.Sighting, u.Audience)
+	if !ok {
+		return
+	}
+
+	if !filter.Contains(sighting.Latitude, sighting.Longitude) || sighting.Confidence < filter.MinConfidence {
+		return event, false
+	}
+
+	if u.Type == domain.SightingDeleted {
+		sighting = domain.Sighting{ID: sighting.ID}
+	}
+
+	return domain.SightingEvent{Type: u.Type, Sighting: sighting}, true
+}
+
+// publish tells every instance's subscribers about a change. Streams are best effort,
+// a failure here must not fail the change itself.
+func (svc *SightingService) publish(eventType domain.SightingEventType, sighting domain.Sighting) {
+	m := sightingMessage{Type: eventType, ID: sighting.ID}
+	if eventType == domain.SightingDeleted {
+		m.Sighting = &sighting
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+
+	if err = svc.redis.Publish(context.Background(), SightingEventsChannel, data).Err(); err != nil {
+		svc.logger.Error().Err(err).Int("sighting", sighting.ID).Msg("failed to publish sighting event")
+	}
+}
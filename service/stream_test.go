@@ -0,0 +1,92 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+)
+
+func TestEventFor(t *testing.T) {
+	reporter, follower := uuid.New(), uuid.New()
+
+	paris := domain.SightingFilter{MinLng: 2.2, MinLat: 48.8, MaxLng: 2.5, MaxLat: 48.9}
+	elsewhere := domain.SightingFilter{MinLng: 2.36, MinLat: 48.86, MaxLng: 2.4, MaxLat: 48.9}
+
+	sighting := func(visibility domain.Visibility, precision domain.LocationPrecision) domain.Sighting {
+		return domain.Sighting{
+			ID:         3,
+			Animal:     "cat",
+			Reporter:   reporter.String(),
+			Visibility: visibility,
+			Precision:  precision,
+			Latitude:   48.8566,
+			Longitude:  2.3522,
+			Confidence: 0.5,
+		}
+	}
+
+	audience := domain.SightingAudience{Followers: map[uuid.UUID]bool{follower: true}}
+
+	tests := []struct {
+		name      string
+		viewer    domain.Identity
+		filter    domain.SightingFilter
+		eventType domain.SightingEventType
+		sighting  domain.Sighting
+		want      bool
+	}{
+		{"created in view", domain.Identity{}, paris, domain.SightingCreated, sighting(domain.VisibilityPublic, domain.PrecisionExact), true},
+		{"created out of view", domain.Identity{}, elsewhere, domain.SightingCreated, sighting(domain.VisibilityPublic, domain.PrecisionExact), false},
+		{"created below min confidence", domain.Identity{}, domain.SightingFilter{MinLng: 2.2, MinLat: 48.8, MaxLng: 2.5, MaxLat: 48.9, MinConfidence: 0.6}, domain.SightingCreated, sighting(domain.VisibilityPublic, domain.PrecisionExact), false},
+		{"private created", domain.Identity{UserID: follower}, paris, domain.SightingCreated, sighting(domain.VisibilityPrivate, domain.PrecisionExact), false},
+		{"deleted in view", domain.Identity{}, paris, domain.SightingDeleted, sighting(domain.VisibilityPublic, domain.PrecisionExact), true},
+		{"deleted private", domain.Identity{}, paris, domain.SightingDeleted, sighting(domain.VisibilityPrivate, domain.PrecisionExact), false},
+		{"deleted private to its reporter", domain.Identity{UserID: reporter}, paris, domain.SightingDeleted, sighting(domain.VisibilityPrivate, domain.PrecisionExact), true},
+		{"deleted followers only to a stranger", domain.Identity{UserID: uuid.New()}, paris, domain.SightingDeleted, sighting(domain.VisibilityFollowers, domain.PrecisionExact), false},
+		{"deleted followers only to a follower", domain.Identity{UserID: follower}, paris, domain.SightingDeleted, sighting(domain.VisibilityFollowers, domain.PrecisionExact), true},
+		{"deleted with a hidden location", domain.Identity{}, paris, domain.SightingDeleted, sighting(domain.VisibilityPublic, domain.PrecisionHidden), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, ok := eventFor(tt.viewer, tt.filter, sightingUpdate{Type: tt.eventType, Sighting: tt.sighting, Audience: audience})
+			if ok != tt.want {
+				t.Fatalf("eventFor() ok = %v, want %v", ok, tt.want)
+			}
+
+			if !ok {
+				return
+			}
+
+			if event.Type != tt.eventType || event.Sighting.ID != tt.sighting.ID {
+				t.Errorf("eventFor() = %+v", event)
+			}
+
+			// deleted events only ever carry the ID
+			if tt.eventType == domain.SightingDeleted && event.Sighting != (domain.Sighting{ID: tt.sighting.ID}) {
+				t.Errorf("deleted event carries more than the ID: %+v", event.Sighting)
+			}
+		})
+	}
+}
+
+func TestEventForCoarsenedLocation(t *testing.T) {
+	s := domain.Sighting{
+		ID:         3,
+		Reporter:   uuid.NewString(),
+		Visibility: domain.VisibilityPublic,
+		Precision:  domain.Precision1km,
+		Latitude:   48.8566,
+		Longitude:  2.3522,
+	}
+
+	event, ok := eventFor(domain.Identity{}, domain.SightingFilter{MinLng: -180, MinLat: -90, MaxLng: 180, MaxLat: 90}, sightingUpdate{Type: domain.SightingCreated, Sighting: s})
+	if !ok {
+		t.Fatal("eventFor() dropped a public sighting")
+	}
+
+	if event.Sighting.Latitude == s.Latitude && event.Sighting.Longitude == s.Longitude {
+		t.Error("eventFor() sent the exact location of a coarsened sighting")
+	}
+}
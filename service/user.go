@@ -0,0 +1,157 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/papacatzzi-server/domain"
+	smtp "github.com/papacatzzi-server/email"
+	"github.com/papacatzzi-server/log"
+	"github.com/papacatzzi-server/postgres"
+	"github.com/redis/go-redis/v9"
+)
+
+const profileSightingsLimit = 20
+
+type UserService struct {
+	logger                 log.Logger
+	repository             postgres.UserRepository
+	sightingRepository     postgres.SightingRepository
+	organizationRepository postgres.OrganizationRepository
+	commentRepository      postgres.CommentRepository
+	notificationRepository postgres.NotificationRepository
+	redis                  *redis.Client
+	mailer                 smtp.Mailer
+	exportsDir             string
+	frontendURL            string
+}
+
+func NewUserService(
+	logger log.Logger,
+	repo postgres.UserRepository,
+	sightingRepo postgres.SightingRepository,
+	orgRepo postgres.OrganizationRepository,
+	commentRepo postgres.CommentRepository,
+	notificationRepo postgres.NotificationRepository,
+	redis *redis.Client,
+	mailer smtp.Mailer,
+	exportsDir string,
+	frontendURL string,
+) UserService {
+	return UserService{
+		logger:                 logger,
+		repository:             repo,
+		sightingRepository:     sightingRepo,
+		organizationRepository: orgRepo,
+		commentRepository:      commentRepo,
+		notificationRepository: notificationRepo,
+		redis:                  redis,
+		mailer:                 mailer,
+		exportsDir:             exportsDir,
+		frontendURL:            frontendURL,
+	}
+}
+
+func (svc *UserService) GetMe(identity domain.Identity) (user domain.User, err error) {
+	user, err = svc.repository.GetUserByID(identity.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = domain.ErrUserAccountNotFound
+			return
+		}
+
+		err = fmt.Errorf("failed to fetch user from db: %v", err)
+		return
+	}
+
+	return
+}
+
+// UpdateMe applies the fields set in update. OAuth users start out with a generated
+// username, this is where they pick a real one.
+func (svc *UserService) UpdateMe(identity domain.Identity, update domain.ProfileUpdate) (user domain.User, err error) {
+	user, err = svc.GetMe(identity)
+	if err != nil {
+		return
+	}
+
+	// changing only the case of your own username is not a conflict
+	if update.Username != nil && !strings.EqualFold(*update.Username, user.Username) {
+		_, err = svc.repository.GetUserByName(*update.Username)
+		if err == nil {
+			err = domain.ErrUsernameExists
+			return
+		}
+
+		if !errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("failed to fetch username from db: %v", err)
+			return
+		}
+	}
+
+	if update.Username != nil {
+		user.Username = *update.Username
+	}
+
+	if update.DisplayName != nil {
+		user.DisplayName = *update.DisplayName
+	}
+
+	if update.Bio != nil {
+		user.Bio = *update.Bio
+	}
+
+	if update.AvatarURL != nil {
+		user.AvatarURL = *update.AvatarURL
+	}
+
+	if update.HomeArea != nil {
+		user.HomeArea = *update.HomeArea
+	}
+
+	if update.LocationPrecision != nil {
+		user.LocationPrecision = *update.LocationPrecision
+	}
+
+	err = svc.repository.UpdateProfile(user)
+	if err != nil {
+		err = fmt.Errorf("failed to update profile: %w", err)
+		return
+	}
+
+	return
+}
+
+// GetProfile returns a user's public profile along with their recent sightings, located
+// as precisely as viewer may see them.
+func (svc *UserService) GetProfile(viewer domain.Identity, username string) (user domain.User, sightings []domain.Sighting, err error) {
+	user, err = svc.getProfile(username)
+	if err != nil {
+		return
+	}
+
+	sightings, err = svc.sightingRepository.GetSightingsByReporter(viewer, user.ID.String(), profileSightingsLimit)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch sightings from db: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *UserService) getProfile(username string) (user domain.User, err error) {
+	user, err = svc.repository.GetProfileByName(username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = domain.ErrUserAccountNotFound
+			return
+		}
+
+		err = fmt.Errorf("failed to fetch profile from db: %v", err)
+		return
+	}
+
+	return
+}
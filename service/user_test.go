@@ -0,0 +1,64 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+	"github.com/papacatzzi-server/log"
+	"github.com/papacatzzi-server/postgres"
+	"github.com/rs/zerolog"
+)
+
+func newTestUserService(t *testing.T, user domain.User) (UserService, *testDB) {
+	t.Helper()
+
+	db, fake := newTestDB(t, user)
+	nop := zerolog.Nop()
+
+	return UserService{logger: log.Logger{Logger: &nop}, repository: postgres.NewUserRepository(db)}, fake
+}
+
+func TestUpdateMe(t *testing.T) {
+	name := func(s string) *string { return &s }
+
+	tests := []struct {
+		name     string
+		update   domain.ProfileUpdate
+		want     error
+		username string
+	}{
+		{name: "profile only", update: domain.ProfileUpdate{Bio: name("Feeds the colony on 5th")}, username: "whiskers"},
+		{name: "same username", update: domain.ProfileUpdate{Username: name("whiskers")}, username: "whiskers"},
+		{name: "free username", update: domain.ProfileUpdate{Username: name("mittens")}, username: "mittens"},
+		{name: "taken username", update: domain.ProfileUpdate{Username: name("tabby")}, want: domain.ErrUsernameExists},
+		{name: "taken in another case", update: domain.ProfileUpdate{Username: name("TABBY")}, want: domain.ErrUsernameExists},
+		{name: "recasing your own", update: domain.ProfileUpdate{Username: name("Whiskers")}, username: "Whiskers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := testUser()
+			svc, db := newTestUserService(t, user)
+			db.others = []domain.User{{ID: uuid.New(), Username: "tabby", Email: "tabby@example.com"}}
+
+			got, err := svc.UpdateMe(domain.Identity{UserID: user.ID}, tt.update)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("UpdateMe() error = %v, want %v", err, tt.want)
+			}
+
+			if err == nil && got.Username != tt.username {
+				t.Errorf("username = %q, want %q", got.Username, tt.username)
+			}
+		})
+	}
+}
+
+func TestGetMeUnknownUser(t *testing.T) {
+	svc, _ := newTestUserService(t, testUser())
+
+	if _, err := svc.GetMe(domain.Identity{UserID: uuid.New()}); !errors.Is(err, domain.ErrUserAccountNotFound) {
+		t.Errorf("GetMe() error = %v, want %v", err, domain.ErrUserAccountNotFound)
+	}
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/papacatzzi-server/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	WebAuthnRegistrationKey = "WEBAUTHN_REGISTRATION"
+	WebAuthnLoginKey        = "WEBAUTHN_LOGIN"
+
+	WebAuthnCeremonyExpiration = time.Minute * 5
+)
+
+// webAuthnUser adapts a user and their passkeys to what the webauthn library expects.
+// The user handle is the account's UUID, so no extra column is needed to find the
+// user again during a discoverable login.
+type webAuthnUser struct {
+	user        domain.User
+	credentials []domain.WebAuthnCredential
+}
+
+func (u webAuthnUser) WebAuthnID() []byte {
+	id := u.user.ID
+	return id[:]
+}
+
+func (u webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u webAuthnUser) WebAuthnCredentials() (credentials []webauthn.Credential) {
+	for _, c := range u.credentials {
+		credentials = append(credentials, c.Credential)
+	}
+
+	return
+}
+
+// BeginWebAuthnRegistration returns the options the browser needs to create a passkey.
+func (svc *AuthService) BeginWebAuthnRegistration(identity domain.Identity) (options *protocol.CredentialCreation, err error) {
+	user, err := svc.getWebAuthnUser(identity.UserID)
+	if err != nil {
+		return
+	}
+
+	var exclusions []protocol.CredentialDescriptor
+	for _, c := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, c.Descriptor())
+	}
+
+	options, session, err := svc.webauthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		err = fmt.Errorf("failed to begin passkey registration: %v", err)
+		return
+	}
+
+	err = svc.cacheWebAuthnSession(appendToKey(WebAuthnRegistrationKey, identity.UserID.String()), session)
+	return
+}
+
+// FinishWebAuthnRegistration verifies the browser's attestation and saves the new passkey.
+func (svc *AuthService) FinishWebAuthnRegistration(identity domain.Identity, name string, response *protocol.ParsedCredentialCreationData) (err error) {
+	user, err := svc.getWebAuthnUser(identity.UserID)
+	if err != nil {
+		return
+	}
+
+	session, err := svc.takeWebAuthnSession(appendToKey(WebAuthnRegistrationKey, identity.UserID.String()))
+	if err != nil {
+		return
+	}
+
+	credential, err := svc.webauthn.CreateCredential(user, session, response)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", domain.ErrPasskeyVerification, err)
+		return
+	}
+
+	err = svc.repository.InsertWebAuthnCredential(domain.WebAuthnCredential{
+		UserID:     identity.UserID,
+		Name:       name,
+		Credential: *credential,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to insert passkey: %v", err)
+		return
+	}
+
+	svc.audit(identity.UserID, domain.AuditPasskeyAdded, name, domain.Session{ID: identity.SessionID})
+	return
+}
+
+// BeginWebAuthnLogin starts a discoverable login, the browser offers whichever passkeys it holds for us.
+func (svc *AuthService) BeginWebAuthnLogin() (options *protocol.CredentialAssertion, err error) {
+	options, session, err := svc.webauthn.BeginDiscoverableLogin()
+	if err != nil {
+		err = fmt.Errorf("failed to begin passkey login: %v", err)
+		return
+	}
+
+	err = svc.cacheWebAuthnSession(appendToKey(WebAuthnLoginKey, session.Challenge), session)
+	return
+}
+
+// FinishWebAuthnLogin verifies the assertion and issues tokens like Login. A passkey
+// already proves possession and user verification, so no TOTP challenge follows.
+func (svc *AuthService) FinishWebAuthnLogin(response *protocol.ParsedCredentialAssertionData, client domain.Session) (accessToken string, refreshToken string, err error) {
+	challenge := response.Response.CollectedClientData.Challenge
+
+	session, err := svc.takeWebAuthnSession(appendToKey(WebAuthnLoginKey, challenge))
+	if err != nil {
+		return
+	}
+
+	var owner webAuthnUser
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		id, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+
+		owner, err = svc.getWebAuthnUser(id)
+		return owner, err
+	}
+
+	_, credential, err := svc.webauthn.ValidatePasskeyLogin(findUser, session, response)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", domain.ErrPasskeyVerification, err)
+		return
+	}
+
+	if credential.Authenticator.CloneWarning {
+		err = fmt.Errorf("%w: sign counter went backwards, authenticator may be cloned", domain.ErrPasskeyVerification)
+		return
+	}
+
+	for _, c := range owner.credentials {
+		if !bytes.Equal(c.Credential.ID, credential.ID) {
+			continue
+		}
+
+		c.Credential = *credential
+		if err = svc.repository.UpdateWebAuthnCredential(c, time.Now()); err != nil {
+			err = fmt.Errorf("failed to update passkey: %v", err)
+			return
+		}
+	}
+
+	return svc.issueTokens(owner.user, client)
+}
+
+func (svc *AuthService) ListWebAuthnCredentials(identity domain.Identity) (credentials []domain.WebAuthnCredential, err error) {
+	credentials, err = svc.repository.GetWebAuthnCredentials(identity.UserID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch passkeys from db: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *AuthService) DeleteWebAuthnCredential(identity domain.Identity, id []byte) (err error) {
+	deleted, err := svc.repository.DeleteWebAuthnCredential(identity.UserID, id)
+	if err != nil {
+		err = fmt.Errorf("failed to delete passkey: %v", err)
+		return
+	}
+
+	if !deleted {
+		err = domain.ErrPasskeyNotFound
+		return
+	}
+
+	svc.audit(identity.UserID, domain.AuditPasskeyRemoved, "", domain.Session{ID: identity.SessionID})
+	return
+}
+
+func (svc *AuthService) getWebAuthnUser(id uuid.UUID) (user webAuthnUser, err error) {
+	user.user, err = svc.repository.GetUserByID(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = domain.ErrUserAccountNotFound
+			return
+		}
+
+		err = fmt.Errorf("failed to fetch user from db: %v", err)
+		return
+	}
+
+	user.credentials, err = svc.repository.GetWebAuthnCredentials(id)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch passkeys from db: %v", err)
+		return
+	}
+
+	return
+}
+
+func (svc *AuthService) cacheWebAuthnSession(key string, session *webauthn.SessionData) (err error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return
+	}
+
+	err = svc.redis.Set(context.Background(), key, data, WebAuthnCeremonyExpiration).Err()
+	if err != nil {
+		err = fmt.Errorf("failed to cache passkey challenge: %v", err)
+		return
+	}
+
+	return
+}
+
+// takeWebAuthnSession returns the ceremony state and deletes it so a challenge is only answered once.
+func (svc *AuthService) takeWebAuthnSession(key string) (session webauthn.SessionData, err error) {
+	data, err := svc.redis.GetDel(context.Background(), key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		err = fmt.Errorf("%w: challenge expired", domain.ErrPasskeyVerification)
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to get passkey challenge: %v", err)
+		return
+	}
+
+	err = json.Unmarshal(data, &session)
+	return
+}